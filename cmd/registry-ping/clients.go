@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/wutscho/registry-ping/internal/config"
+	"github.com/wutscho/registry-ping/internal/httpcache"
+	"github.com/wutscho/registry-ping/internal/registry"
+)
+
+// registryClients builds the HTTP client of each scraper.
+type registryClients struct {
+	cfg    *config.Config
+	logger *slog.Logger
+	// instrument wraps a connection-level transport with logging, tracing
+	// and metrics.
+	instrument func(http.RoundTripper) http.RoundTripper
+}
+
+// forHost returns a client for the registry host as written in image refs
+// ("docker.io" for Docker Hub), connecting as configured in cfg.Registries.
+// Requests are retried with backoff and rate limits tracked by a
+// registry.Transport, behind the response cache if enabled. The timeout
+// applies to each request including its retries.
+func (c *registryClients) forHost(host string) (*http.Client, error) {
+	rc, ok := c.cfg.Registries[host]
+	if !ok {
+		rc.Timeout = c.cfg.HTTPTimeout
+	}
+	base, err := registry.NewHTTPTransport(registry.HTTPOptions{
+		ProxyURL:           rc.Proxy,
+		CAFile:             rc.CAFile,
+		CertFile:           rc.CertFile,
+		KeyFile:            rc.KeyFile,
+		InsecureSkipVerify: rc.InsecureSkipVerify,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("registry %s: %w", host, err)
+	}
+
+	var rt http.RoundTripper = registry.NewTransport(c.instrument(base), registry.WithTransportLogger(c.logger))
+	if c.cfg.HTTPCacheDir != "" {
+		rt = httpcache.NewTransport(rt, c.cfg.HTTPCacheDir, httpcache.WithLogger(c.logger))
+	}
+	return &http.Client{Timeout: rc.Timeout.Std(), Transport: rt}, nil
+}
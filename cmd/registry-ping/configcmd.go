@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/wutscho/registry-ping/internal/config"
+)
+
+const configUsage = `usage: registry-ping config check [-config path]
+
+Validates the config file and prints every problem with its position.
+Exits non-zero if the config is invalid.
+`
+
+// runConfigCommand implements the "config" subcommand and returns the exit code.
+func runConfigCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "check" {
+		fmt.Fprint(stderr, configUsage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("config check", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configPath := fs.String("config", "config.yaml", "path to config file")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		var cfgErr *config.Error
+		if errors.As(err, &cfgErr) {
+			for _, p := range cfgErr.Problems {
+				fmt.Fprintln(stderr, p)
+			}
+		} else {
+			fmt.Fprintln(stderr, err)
+		}
+		return 1
+	}
+
+	fmt.Fprintf(stdout, "%s: ok (%d images, %d notifiers)\n", *configPath, len(cfg.Images), len(cfg.Notifiers))
+	return 0
+}
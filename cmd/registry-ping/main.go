@@ -2,40 +2,349 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
 	"time"
 
+	"github.com/wutscho/registry-ping/internal/api"
 	"github.com/wutscho/registry-ping/internal/checker"
 	"github.com/wutscho/registry-ping/internal/config"
+	"github.com/wutscho/registry-ping/internal/daemon"
+	"github.com/wutscho/registry-ping/internal/helm"
+	"github.com/wutscho/registry-ping/internal/logging"
+	"github.com/wutscho/registry-ping/internal/metrics"
 	"github.com/wutscho/registry-ping/internal/notify"
 	"github.com/wutscho/registry-ping/internal/registry"
-	"github.com/wutscho/registry-ping/internal/registry/dockerhub"
+	"github.com/wutscho/registry-ping/internal/registry/oci"
+	"github.com/wutscho/registry-ping/internal/sigv4"
 	"github.com/wutscho/registry-ping/internal/state"
+	"github.com/wutscho/registry-ping/internal/tracing"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(runConfigCommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
 	configPath := flag.String("config", "config.yaml", "path to config file")
+	interval := flag.Duration("interval", 0, "run continuously, checking every interval (e.g. 6h); 0 checks once and exits")
+	listen := flag.String("listen", "", "address to serve the dashboard, status API and /metrics on in daemon mode (e.g. :9090)")
+	metricsFile := flag.String("metrics-file", "", "write metrics to this file after each run, for the node_exporter textfile collector")
+	verbose := flag.Bool("v", false, "log at debug level, including every registry request")
 	flag.Parse()
 
 	cfg, err := config.Load(*configPath)
 	if err != nil {
-		log.Fatalf("load config: %v", err)
+		fmt.Fprintf(os.Stderr, "load config: %v\n", err)
+		os.Exit(1)
 	}
+	logger, err := newLogger(cfg.Log, *verbose, *interval > 0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
 
-	httpClient := &http.Client{Timeout: 10 * time.Second}
-	scraperRegistry := registry.NewScraperRegistry(
-		dockerhub.NewDockerHubScraper(httpClient),
-	)
-	stateStore := state.NewJSONStateStore(cfg.StateFile)
-	notifier := notify.NewStdoutNotifier()
-	c := checker.NewChecker(scraperRegistry, stateStore, notifier)
+	m := metrics.New()
+	tracer := newTracer(cfg, logger)
+	instrument := func(next http.RoundTripper) http.RoundTripper {
+		return m.Transport(tracer.Transport(logging.Transport(next, logger)))
+	}
+	// Notifier and S3 state requests are not registry traffic: they are
+	// traced and logged, but not counted in the request metrics.
+	httpClient := &http.Client{
+		Timeout:   cfg.HTTPTimeout.Std(),
+		Transport: tracer.Transport(logging.Transport(nil, logger)),
+	}
+	clients := &registryClients{cfg: cfg, logger: logger, instrument: instrument}
+	scrapers, err := newScrapers(cfg, clients, logger)
+	if err != nil {
+		logger.Error("build http client", "err", err)
+		os.Exit(1)
+	}
+	scraperRegistry := registry.NewScraperRegistry(scrapers...)
+	if err := setMirrors(scraperRegistry, cfg.Mirrors, clients, logger); err != nil {
+		logger.Error("build http client", "err", err)
+		os.Exit(1)
+	}
+	charts := helm.NewClient(clients.forHost, append(chartEndpoints(cfg), helm.WithCredentials(func(host string) (string, string) {
+		rc := cfg.Registries[host]
+		return rc.Username, rc.Password
+	}), helm.WithLogger(logger))...)
+	stateStore := newStateStore(cfg, httpClient, logger)
+	tracker := api.NewTracker()
+	build := func(cfg *config.Config) daemon.Runner {
+		var r daemon.Runner = checker.NewChecker(scraperRegistry, stateStore, newNotifier(cfg, httpClient, logger),
+			checker.WithMetrics(m), checker.WithResultHook(tracker.Record), checker.WithLogger(logger),
+			checker.WithTracer(tracer), checker.WithCharts(charts))
+		if *metricsFile != "" {
+			r = textfileRunner{Runner: r, metrics: m, path: *metricsFile, logger: logger}
+		}
+		return r
+	}
+
+	if *interval > 0 {
+		d := daemon.New(*configPath, cfg, *interval, build, daemon.WithLogger(logger))
+		var handler http.Handler
+		if *listen != "" {
+			handler = newHTTPHandler(api.NewServer(d, stateStore, tracker, api.WithLogger(logger)), m)
+		}
+		err := runDaemon(d, *listen, handler, logger)
+		shutdownTracer(tracer, logger)
+		if err != nil {
+			os.Exit(1)
+		}
+		return
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout.Std())
 	defer cancel()
 
-	if err := c.Run(ctx, cfg.Images); err != nil {
-		log.Fatalf("checker: %v", err)
+	r := build(cfg)
+	err = r.Run(ctx, cfg.Images)
+	if len(cfg.Charts) > 0 {
+		err = errors.Join(err, r.RunCharts(ctx, cfg.Charts))
+	}
+	shutdownTracer(tracer, logger)
+	if err != nil {
+		logger.Error("check run failed", "err", err)
+		os.Exit(1)
+	}
+}
+
+// newLogger creates the stderr logger. Without a configured level, the
+// daemon logs at info and a single run at warn, so cron mails only carry
+// notifications and problems. verbose forces debug.
+func newLogger(cfg config.LogConfig, verbose, daemonMode bool) (*slog.Logger, error) {
+	level := slog.LevelWarn
+	if daemonMode {
+		level = slog.LevelInfo
+	}
+	if cfg.Level != "" {
+		var err error
+		if level, err = logging.ParseLevel(cfg.Level); err != nil {
+			return nil, err
+		}
+	}
+	if verbose {
+		level = slog.LevelDebug
+	}
+	return logging.New(os.Stderr, level, cfg.Format)
+}
+
+// newTracer returns the configured span exporter, or nil to disable tracing.
+// The OTLP exporter gets its own client so exports are not traced themselves.
+func newTracer(cfg *config.Config, logger *slog.Logger) *tracing.Tracer {
+	tc := cfg.Tracing
+	if tc == nil {
+		return nil
+	}
+	var exp tracing.Exporter
+	if tc.File != "" {
+		exp = tracing.NewFileExporter(tc.File)
+	} else {
+		exp = tracing.NewOTLPExporter(&http.Client{Timeout: cfg.HTTPTimeout.Std()}, tc.Endpoint, tc.Headers)
+	}
+	opts := []tracing.Option{tracing.WithLogger(logger)}
+	if tc.Propagate {
+		opts = append(opts, tracing.WithPropagation())
+	}
+	return tracing.NewTracer(exp, tc.ServiceName, opts...)
+}
+
+// shutdownTracer exports the spans of the last run before the process exits.
+func shutdownTracer(tracer *tracing.Tracer, logger *slog.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := tracer.Shutdown(ctx); err != nil {
+		logger.Warn("tracing: dropped spans", "err", err)
+	}
+}
+
+// setMirrors declares the configured mirrors of each upstream host. Each
+// mirror gets the client configured for its own host.
+func setMirrors(reg *registry.ScraperRegistry, mirrors map[string]config.MirrorConfig, clients *registryClients, logger *slog.Logger) error {
+	for host, mc := range mirrors {
+		mode := registry.MirrorFallback
+		if mc.Mode == "first" {
+			mode = registry.MirrorFirst
+		}
+		sources := make([]registry.Source, 0, len(mc.Endpoints))
+		for _, e := range mc.Endpoints {
+			u, err := url.Parse(e.URL)
+			if err != nil {
+				return fmt.Errorf("mirror %s: %w", e.URL, err)
+			}
+			client, err := clients.forHost(u.Host)
+			if err != nil {
+				return err
+			}
+			sources = append(sources, registry.Source{
+				Name: u.Host,
+				Scraper: oci.NewScraper(client, e.URL,
+					oci.WithBasicAuth(e.Username, e.Password),
+					oci.WithRepositoryPrefix(e.Prefix),
+					oci.WithLogger(logger)),
+			})
+		}
+		reg.SetMirrors(host, mode, sources...)
+	}
+	return nil
+}
+
+// chartEndpoints returns the options reading OCI charts from the
+// configured registry URLs and mirrors, as images are. The url of GitLab
+// and ECR registries is their API rather than the registry, so it is not
+// used for charts.
+func chartEndpoints(cfg *config.Config) []helm.Option {
+	var opts []helm.Option
+	for host, rc := range cfg.Registries {
+		if rc.URL != "" && rc.Type != "gitlab" && rc.Type != "ecr" {
+			opts = append(opts, helm.WithRegistryURL(host, rc.URL))
+		}
+	}
+	for host, mc := range cfg.Mirrors {
+		mode := registry.MirrorFallback
+		if mc.Mode == "first" {
+			mode = registry.MirrorFirst
+		}
+		mirrors := make([]helm.Mirror, 0, len(mc.Endpoints))
+		for _, e := range mc.Endpoints {
+			mirrors = append(mirrors, helm.Mirror{URL: e.URL, Username: e.Username, Password: e.Password, Prefix: e.Prefix})
+		}
+		opts = append(opts, helm.WithMirrors(host, mode, mirrors...))
+	}
+	return opts
+}
+
+// runDaemon runs d until SIGINT or SIGTERM. SIGHUP reloads the config; it
+// is also reloaded when its files change. If listen is set, handler is
+// served on it. An error stopping d has been logged.
+func runDaemon(d *daemon.Daemon, listen string, handler http.Handler, logger *slog.Logger) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			d.Reload()
+		}
+	}()
+
+	if listen != "" {
+		srv := &http.Server{Addr: listen, Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("listen", "addr", listen, "err", err)
+				os.Exit(1)
+			}
+		}()
+		defer srv.Close()
+	}
+
+	if err := d.Run(ctx); err != nil {
+		logger.Error("daemon stopped", "err", err)
+		return err
+	}
+	return nil
+}
+
+// newHTTPHandler combines the status API and dashboard with /metrics.
+func newHTTPHandler(server *api.Server, m *metrics.Metrics) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/", server.Handler())
+	mux.Handle("GET /metrics", m.Registry().Handler())
+	return mux
+}
+
+// textfileRunner writes the metrics file after every run.
+type textfileRunner struct {
+	daemon.Runner
+	metrics *metrics.Metrics
+	path    string
+	logger  *slog.Logger
+}
+
+func (r textfileRunner) Run(ctx context.Context, images []config.ImageEntry) error {
+	err := r.Runner.Run(ctx, images)
+	if werr := r.metrics.Registry().WriteFile(r.path); werr != nil {
+		r.logger.Error("write metrics file", "path", r.path, "err", werr)
+	}
+	return err
+}
+
+func (r textfileRunner) RunCharts(ctx context.Context, charts []config.ChartEntry) error {
+	err := r.Runner.RunCharts(ctx, charts)
+	if werr := r.metrics.Registry().WriteFile(r.path); werr != nil {
+		r.logger.Error("write metrics file", "path", r.path, "err", werr)
+	}
+	return err
+}
+
+// newStateStore returns the S3 backend if configured, the JSON file otherwise.
+// S3 credentials not set in the config are taken from the standard AWS
+// environment variables.
+func newStateStore(cfg *config.Config, client *http.Client, logger *slog.Logger) state.StateStore {
+	s3 := cfg.StateS3
+	if s3 == nil {
+		return state.NewJSONStateStore(cfg.StateFile, state.WithLogger(logger))
+	}
+
+	creds := sigv4.Credentials{
+		AccessKeyID:     s3.AccessKeyID,
+		SecretAccessKey: s3.SecretAccessKey,
+		SessionToken:    s3.SessionToken,
+	}
+	if creds.AccessKeyID == "" {
+		var err error
+		if creds, err = sigv4.LoadCredentials(""); err != nil {
+			logger.Debug("no AWS credentials for the S3 state", "err", err)
+		}
+	}
+
+	return state.NewS3StateStore(client, state.S3Options{
+		Endpoint:    s3.Endpoint,
+		Region:      s3.Region,
+		Bucket:      s3.Bucket,
+		Key:         s3.Key,
+		PathStyle:   s3.PathStyle,
+		Credentials: creds,
+	}, state.WithLogger(logger))
+}
+
+// newNotifier builds one sink per configured notifier, in name order.
+// Without configured notifiers it falls back to stdout.
+func newNotifier(cfg *config.Config, client *http.Client, logger *slog.Logger) notify.Notifier {
+	if len(cfg.Notifiers) == 0 {
+		return notify.NewStdoutNotifier()
+	}
+
+	names := make([]string, 0, len(cfg.Notifiers))
+	for name := range cfg.Notifiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	sinks := make([]notify.Sink, 0, len(names))
+	for _, name := range names {
+		n := cfg.Notifiers[name]
+		var notifier notify.Notifier
+		switch n.Type {
+		case "webhook":
+			notifier = notify.NewWebhookNotifier(client, n.URL, n.Headers, notify.WithLogger(logger))
+		default:
+			notifier = notify.NewStdoutNotifier()
+		}
+		sinks = append(sinks, notify.Sink{Name: name, Notifier: notifier})
 	}
+	return notify.NewMulti(sinks...)
 }
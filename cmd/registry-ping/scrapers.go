@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+
+	"github.com/wutscho/registry-ping/internal/config"
+	"github.com/wutscho/registry-ping/internal/registry"
+	"github.com/wutscho/registry-ping/internal/registry/acr"
+	"github.com/wutscho/registry-ping/internal/registry/dockerhub"
+	"github.com/wutscho/registry-ping/internal/registry/ecr"
+	"github.com/wutscho/registry-ping/internal/registry/ghcr"
+	"github.com/wutscho/registry-ping/internal/registry/gitlab"
+	"github.com/wutscho/registry-ping/internal/registry/google"
+	"github.com/wutscho/registry-ping/internal/registry/harbor"
+	"github.com/wutscho/registry-ping/internal/registry/plugin"
+	"github.com/wutscho/registry-ping/internal/registry/quay"
+	"github.com/wutscho/registry-ping/internal/sigv4"
+)
+
+// newScrapers returns a scraper for every registry configured with a type
+// (see registryType), in host order, then the configured plugins in order,
+// followed by the built-in scrapers of the well-known public registries.
+// Of those, quay.io, ghcr.io and registry.gitlab.com take their credentials
+// from cfg.Registries, ECR from the AWS environment and shared files, and
+// Google from GOOGLE_APPLICATION_CREDENTIALS; Docker Hub and ACR are read
+// anonymously.
+func newScrapers(cfg *config.Config, clients *registryClients, logger *slog.Logger) ([]registry.Scraper, error) {
+	hosts := make([]string, 0, len(cfg.Registries))
+	for host, rc := range cfg.Registries {
+		if registryType(host, rc) != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Strings(hosts)
+
+	var scrapers []registry.Scraper
+	for _, host := range hosts {
+		rc := cfg.Registries[host]
+		client, err := clients.forHost(host)
+		if err != nil {
+			return nil, err
+		}
+		baseURL := rc.URL
+		if baseURL == "" {
+			baseURL = "https://" + host
+		}
+		switch registryType(host, rc) {
+		case "quay":
+			scrapers = append(scrapers, quay.NewQuayScraper(client,
+				append(quayAuth(rc), quay.WithBaseURL(baseURL), quay.WithHosts(host), quay.WithLogger(logger))...))
+		case "gitlab":
+			scrapers = append(scrapers, gitlab.NewGitLabScraper(client,
+				append(gitlabAuth(rc), gitlab.WithBaseURL(baseURL), gitlab.WithHosts(host), gitlab.WithLogger(logger))...))
+		case "harbor":
+			opts := []harbor.Option{harbor.WithHosts(host), harbor.WithLogger(logger)}
+			if rc.Username != "" {
+				opts = append(opts, harbor.WithRobotAccount(rc.Username, rc.Password))
+			}
+			if rc.ScanOverview {
+				opts = append(opts, harbor.WithScanOverview())
+			}
+			scrapers = append(scrapers, harbor.NewHarborScraper(client, baseURL, opts...))
+		case "ecr":
+			creds, err := sigv4.LoadCredentials(rc.AWSProfile)
+			if err != nil {
+				return nil, fmt.Errorf("registry %s: %w", host, err)
+			}
+			opts := []ecr.Option{ecr.WithCredentials(creds), ecr.WithHosts(host), ecr.WithOwnPublicRegistry(), ecr.WithLogger(logger)}
+			if rc.URL != "" {
+				opts = append(opts, ecr.WithEndpoint(rc.URL))
+			}
+			scrapers = append(scrapers, ecr.NewECRScraper(client, opts...))
+		case "google":
+			opts := []google.Option{google.WithHosts(host), google.WithLogger(logger)}
+			if rc.URL != "" {
+				opts = append(opts, google.WithRegistryURL(rc.URL))
+			}
+			if sa, err := googleAccount(rc.CredentialsFile); err != nil {
+				return nil, fmt.Errorf("registry %s: %w", host, err)
+			} else if sa != nil {
+				opts = append(opts, google.WithServiceAccount(sa))
+			}
+			scrapers = append(scrapers, google.NewGoogleScraper(client, opts...))
+		case "acr":
+			opts := []acr.Option{acr.WithHosts(host), acr.WithLogger(logger)}
+			if rc.URL != "" {
+				opts = append(opts, acr.WithBaseURL(rc.URL))
+			}
+			switch {
+			case rc.Token != "":
+				opts = append(opts, acr.WithAADRefreshToken(rc.Token, rc.Tenant))
+			case rc.Username != "":
+				opts = append(opts, acr.WithBasicAuth(rc.Username, rc.Password))
+			}
+			scrapers = append(scrapers, acr.NewACRScraper(client, opts...))
+		}
+	}
+
+	for _, pc := range cfg.Plugins {
+		env := make([]string, 0, len(pc.Env))
+		for k, v := range pc.Env {
+			env = append(env, k+"="+v)
+		}
+		sort.Strings(env)
+		scrapers = append(scrapers, plugin.NewPluginScraper(pc.Name, pc.Command,
+			plugin.WithHosts(pc.Hosts...),
+			plugin.WithEnv(env...),
+			plugin.WithTimeout(pc.Timeout.Std()),
+			plugin.WithLogger(logger)))
+	}
+
+	dockerHubClient, err := clients.forHost("docker.io")
+	if err != nil {
+		return nil, err
+	}
+	quayClient, err := clients.forHost("quay.io")
+	if err != nil {
+		return nil, err
+	}
+	ghcrClient, err := clients.forHost("ghcr.io")
+	if err != nil {
+		return nil, err
+	}
+	gitlabClient, err := clients.forHost("registry.gitlab.com")
+	if err != nil {
+		return nil, err
+	}
+	ecrClient, err := clients.forHost("public.ecr.aws")
+	if err != nil {
+		return nil, err
+	}
+	googleClient, err := clients.forHost("gcr.io")
+	if err != nil {
+		return nil, err
+	}
+	googleOpts := []google.Option{google.WithLogger(logger)}
+	if sa, err := googleAccount(""); err != nil {
+		return nil, fmt.Errorf("google: %w", err)
+	} else if sa != nil {
+		googleOpts = append(googleOpts, google.WithServiceAccount(sa))
+	}
+	acrClient, err := clients.forHost("azurecr.io")
+	if err != nil {
+		return nil, err
+	}
+	// ECR Public images are resolved to digests anonymously; the API is only
+	// asked for push times of a public registry declared with type ecr.
+	awsCreds, err := sigv4.LoadCredentials("")
+	if err != nil {
+		logger.Debug("no AWS credentials for ECR", "err", err)
+	}
+	return append(scrapers,
+		dockerhub.NewDockerHubScraper(dockerHubClient, dockerhub.WithLogger(logger)),
+		quay.NewQuayScraper(quayClient, append(quayAuth(cfg.Registries["quay.io"]), quay.WithLogger(logger))...),
+		ghcr.NewGHCRScraper(ghcrClient, ghcr.WithToken(cfg.Registries["ghcr.io"].Token), ghcr.WithLogger(logger)),
+		gitlab.NewGitLabScraper(gitlabClient, append(gitlabAuth(cfg.Registries["registry.gitlab.com"]), gitlab.WithLogger(logger))...),
+		ecr.NewECRScraper(ecrClient, ecr.WithCredentials(awsCreds), ecr.WithLogger(logger)),
+		google.NewGoogleScraper(googleClient, googleOpts...),
+		acr.NewACRScraper(acrClient, acr.WithLogger(logger)),
+	), nil
+}
+
+// registryType returns the type of a configured registry. Azure Container
+// Registry and Google hosts are of type "acr" and "google" without one, so
+// that they are read with their own client and credentials rather than by
+// the built-in scrapers.
+func registryType(host string, rc config.RegistryConfig) string {
+	switch {
+	case rc.Type != "":
+		return rc.Type
+	case acr.NewACRScraper(nil).CanHandle(host):
+		return "acr"
+	case google.NewGoogleScraper(nil).CanHandle(host):
+		return "google"
+	}
+	return ""
+}
+
+// quayAuth returns the credential options for a Quay registry.
+func quayAuth(rc config.RegistryConfig) []quay.Option {
+	switch {
+	case rc.Token != "":
+		return []quay.Option{quay.WithToken(rc.Token)}
+	case rc.Username != "":
+		return []quay.Option{quay.WithRobotAccount(rc.Username, rc.Password)}
+	}
+	return nil
+}
+
+// gitlabAuth returns the credential options for a GitLab registry. As with
+// docker login, the user name "gitlab-ci-token" marks a CI job token.
+func gitlabAuth(rc config.RegistryConfig) []gitlab.Option {
+	switch {
+	case rc.Token != "":
+		return []gitlab.Option{gitlab.WithToken(rc.Token)}
+	case rc.Username == "gitlab-ci-token":
+		return []gitlab.Option{gitlab.WithJobToken(rc.Password)}
+	}
+	return nil
+}
+
+// googleAccount loads the service account key at path, or the one named
+// by GOOGLE_APPLICATION_CREDENTIALS. It returns nil without either.
+func googleAccount(path string) (*google.ServiceAccount, error) {
+	if path == "" {
+		path = os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	}
+	if path == "" {
+		return nil, nil
+	}
+	return google.LoadServiceAccount(path)
+}
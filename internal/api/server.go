@@ -0,0 +1,336 @@
+// Package api serves the HTTP status API and web dashboard.
+package api
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/wutscho/registry-ping/internal/config"
+	"github.com/wutscho/registry-ping/internal/daemon"
+	"github.com/wutscho/registry-ping/internal/helm"
+	"github.com/wutscho/registry-ping/internal/registry"
+	"github.com/wutscho/registry-ping/internal/state"
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+var dashboard = template.Must(template.New("dashboard.html").Funcs(template.FuncMap{
+	"when": func(t *time.Time) string {
+		if t == nil {
+			return "–"
+		}
+		return t.UTC().Format("2006-01-02 15:04:05Z")
+	},
+}).ParseFS(templateFS, "templates/dashboard.html"))
+
+// Backend is the running checker; *daemon.Daemon implements it.
+type Backend interface {
+	Config() *config.Config
+	Check(ctx context.Context, refs []string) error
+}
+
+// Server serves the status API and dashboard.
+type Server struct {
+	backend Backend
+	store   state.StateStore
+	tracker *Tracker
+	logger  *slog.Logger
+	// async runs webhook-triggered checks without blocking the response.
+	async func(func())
+
+	// Webhook-triggered refs waiting to be checked, and whether a worker
+	// is checking them.
+	mu       sync.Mutex
+	pending  []string
+	draining bool
+}
+
+// Option is a functional option for Server.
+type Option func(*Server)
+
+// WithLogger sets the logger for background webhook checks
+// (default slog.Default()).
+func WithLogger(l *slog.Logger) Option {
+	return func(s *Server) {
+		s.logger = l
+	}
+}
+
+// NewServer creates a Server reading image state from store and check
+// results from tracker.
+func NewServer(backend Backend, store state.StateStore, tracker *Tracker, opts ...Option) *Server {
+	s := &Server{
+		backend: backend,
+		store:   store,
+		tracker: tracker,
+		logger:  slog.Default(),
+		async:   func(f func()) { go f() },
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// Handler returns the HTTP handler:
+//
+//	GET  /                     HTML dashboard
+//	POST /check                dashboard "check now" form (optional ref field)
+//	GET  /api/images           all configured images
+//	GET  /api/images/{ref...}  one image including its change history
+//	GET  /api/charts           all configured Helm charts
+//	POST /api/check            check all images and charts, or those given as ?ref=
+//	POST /hooks/dockerhub      Docker Hub repository webhook
+//	POST /hooks/distribution   CNCF distribution registry notifications
+//	POST /hooks/harbor         Harbor webhook
+//
+// The webhook endpoints only exist if webhooks are configured. The check
+// endpoints reject cross-origin browser requests (judged by Sec-Fetch-Site
+// and Origin), so other web pages cannot make a visitor trigger checks;
+// clients outside a browser, such as curl, send neither header.
+func (s *Server) Handler() http.Handler {
+	csrf := http.NewCrossOriginProtection()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.handleDashboard)
+	mux.Handle("POST /check", csrf.Handler(http.HandlerFunc(s.handleCheckForm)))
+	mux.HandleFunc("GET /api/images", s.handleList)
+	mux.HandleFunc("GET /api/images/{ref...}", s.handleDetail)
+	mux.HandleFunc("GET /api/charts", s.handleCharts)
+	mux.Handle("POST /api/check", csrf.Handler(http.HandlerFunc(s.handleCheck)))
+	mux.HandleFunc("POST /hooks/dockerhub", s.handleWebhook(parseDockerHub))
+	mux.HandleFunc("POST /hooks/distribution", s.handleWebhook(parseDistribution))
+	mux.HandleFunc("POST /hooks/harbor", s.handleWebhook(parseHarbor))
+	return mux
+}
+
+// imageStatus is the JSON representation of a tracked image or chart. For
+// a chart, LastPushed is when its latest version was released.
+type imageStatus struct {
+	Ref                  string               `json:"ref"`
+	Source               string               `json:"source,omitempty"`
+	Labels               map[string]string    `json:"labels,omitempty"`
+	Notifiers            []string             `json:"notifiers,omitempty"`
+	LastPushed           *time.Time           `json:"last_pushed"`
+	Digest               string               `json:"digest,omitempty"`
+	Version              string               `json:"version,omitempty"`
+	AppVersion           string               `json:"app_version,omitempty"`
+	LastCheck            *time.Time           `json:"last_check"`
+	LastError            string               `json:"last_error,omitempty"`
+	PendingNotifications int                  `json:"pending_notifications"`
+	History              []state.HistoryEntry `json:"history,omitempty"`
+}
+
+// stateKey returns the key the state of entry is stored under.
+func stateKey(entry config.ImageEntry) string {
+	if ref, err := registry.ParseImageRef(entry.Ref); err == nil {
+		return ref.String()
+	}
+	return entry.Ref
+}
+
+// chartKey returns the key the state of a chart entry is stored under.
+func chartKey(entry config.ChartEntry) string {
+	if ref, err := helm.ParseChartRef(entry.Ref); err == nil {
+		return ref.String()
+	}
+	return entry.Ref
+}
+
+// status combines entry with its saved state, if found, and its last check.
+func (s *Server) status(entry config.ImageEntry, saved state.ImageState, found, withHistory bool) imageStatus {
+	st := imageStatus{
+		Ref:       stateKey(entry),
+		Source:    entry.Source,
+		Labels:    entry.Labels,
+		Notifiers: entry.Notifiers,
+	}
+	s.addState(&st, saved, found, withHistory)
+	return st
+}
+
+// chartStatus combines a chart entry with its saved state, if found, and
+// its last check.
+func (s *Server) chartStatus(entry config.ChartEntry, saved state.ImageState, found bool) imageStatus {
+	st := imageStatus{
+		Ref:       chartKey(entry),
+		Source:    entry.Source,
+		Labels:    entry.Labels,
+		Notifiers: entry.Notifiers,
+	}
+	s.addState(&st, saved, found, false)
+	return st
+}
+
+// addState fills in the saved state and last check of st.
+func (s *Server) addState(st *imageStatus, saved state.ImageState, found, withHistory bool) {
+	if found {
+		pushed := saved.LastPushed
+		st.LastPushed = &pushed
+		st.Digest = saved.Digest
+		st.Version = saved.Version
+		st.AppVersion = saved.AppVersion
+		st.PendingNotifications = len(saved.Outbox)
+		if withHistory {
+			st.History = saved.History
+		}
+	}
+	if res, ok := s.tracker.get(st.Ref); ok {
+		checked := res.CheckedAt
+		st.LastCheck = &checked
+		st.LastError = res.Err
+	}
+}
+
+// statuses returns the status of every configured image and chart, reading
+// the state once.
+func (s *Server) statuses() (images, charts []imageStatus, err error) {
+	saved, err := s.store.LoadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg := s.backend.Config()
+	images = make([]imageStatus, 0, len(cfg.Images))
+	for _, entry := range cfg.Images {
+		st, found := saved[stateKey(entry)]
+		images = append(images, s.status(entry, st, found, false))
+	}
+	charts = make([]imageStatus, 0, len(cfg.Charts))
+	for _, entry := range cfg.Charts {
+		st, found := saved[chartKey(entry)]
+		charts = append(charts, s.chartStatus(entry, st, found))
+	}
+	return images, charts, nil
+}
+
+func (s *Server) handleList(w http.ResponseWriter, _ *http.Request) {
+	images, _, err := s.statuses()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, images)
+}
+
+func (s *Server) handleCharts(w http.ResponseWriter, _ *http.Request) {
+	_, charts, err := s.statuses()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, charts)
+}
+
+func (s *Server) handleDetail(w http.ResponseWriter, r *http.Request) {
+	want := r.PathValue("ref")
+	ref, err := registry.ParseImageRef(want)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	for _, entry := range s.backend.Config().Images {
+		if other, err := registry.ParseImageRef(entry.Ref); err != nil || other != ref {
+			continue
+		}
+		saved, found, err := s.store.Load(stateKey(entry))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, s.status(entry, saved, found, true))
+		return
+	}
+	writeError(w, http.StatusNotFound, daemon.ErrUnknownImage)
+}
+
+type checkResponse struct {
+	Images []imageStatus `json:"images"`
+	Charts []imageStatus `json:"charts,omitempty"`
+	Error  string        `json:"error,omitempty"`
+}
+
+func (s *Server) handleCheck(w http.ResponseWriter, r *http.Request) {
+	refs := r.URL.Query()["ref"]
+	err := s.backend.Check(r.Context(), refs)
+	if errors.Is(err, daemon.ErrUnknownImage) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	images, charts, serr := s.statuses()
+	if serr != nil {
+		writeError(w, http.StatusInternalServerError, serr)
+		return
+	}
+	if len(refs) > 0 {
+		images, charts = filterStatuses(images, refs), filterStatuses(charts, refs)
+	}
+	resp := checkResponse{Images: images, Charts: charts}
+	if err != nil {
+		// Per-image failures are reported in the statuses as well.
+		resp.Error = err.Error()
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// filterStatuses returns the statuses of the image or chart refs.
+func filterStatuses(statuses []imageStatus, refs []string) []imageStatus {
+	want := make(map[string]bool, len(refs))
+	for _, r := range refs {
+		if ref, err := registry.ParseImageRef(r); err == nil {
+			want[ref.String()] = true
+		}
+		if ref, err := helm.ParseChartRef(r); err == nil {
+			want[ref.String()] = true
+		}
+	}
+	var out []imageStatus
+	for _, st := range statuses {
+		if want[st.Ref] {
+			out = append(out, st)
+		}
+	}
+	return out
+}
+
+func (s *Server) handleCheckForm(w http.ResponseWriter, r *http.Request) {
+	var refs []string
+	if ref := r.FormValue("ref"); ref != "" {
+		refs = []string{ref}
+	}
+	// Failures show up in the dashboard's error column.
+	if err := s.backend.Check(r.Context(), refs); errors.Is(err, daemon.ErrUnknownImage) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (s *Server) handleDashboard(w http.ResponseWriter, _ *http.Request) {
+	images, charts, err := s.statuses()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = dashboard.Execute(w, struct{ Images, Charts []imageStatus }{images, charts})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,228 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wutscho/registry-ping/internal/checker"
+	"github.com/wutscho/registry-ping/internal/config"
+	"github.com/wutscho/registry-ping/internal/daemon"
+	"github.com/wutscho/registry-ping/internal/state"
+)
+
+var (
+	ts1 = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	ts2 = time.Date(2026, 2, 4, 17, 56, 28, 0, time.UTC)
+)
+
+type fakeBackend struct {
+	cfg     *config.Config
+	tracker *Tracker
+	checked [][]string
+}
+
+func (b *fakeBackend) Config() *config.Config { return b.cfg }
+
+func (b *fakeBackend) Check(_ context.Context, refs []string) error {
+	b.checked = append(b.checked, refs)
+	for _, r := range refs {
+		if r == "redis:7" {
+			return fmt.Errorf("%q: %w", r, daemon.ErrUnknownImage)
+		}
+	}
+	b.tracker.Record(checker.Result{Ref: "php:8.2.30-fpm", CheckedAt: ts2})
+	b.tracker.Record(checker.Result{Ref: "ghcr.io/org/img:latest", CheckedAt: ts2, Err: errors.New("no scraper")})
+	b.tracker.Record(checker.Result{Ref: "oci://ghcr.io/org/charts/app", CheckedAt: ts2})
+	return nil
+}
+
+func newTestServer(t *testing.T) (*httptest.Server, *fakeBackend) {
+	t.Helper()
+	store := state.NewJSONStateStore(filepath.Join(t.TempDir(), "state.json"))
+	require.NoError(t, store.Save("php:8.2.30-fpm", state.ImageState{
+		LastPushed: ts2,
+		Digest:     "sha256:beef",
+		History: []state.HistoryEntry{
+			{Pushed: ts1, DetectedAt: ts1},
+			{Pushed: ts2, Digest: "sha256:beef", DetectedAt: ts2},
+		},
+	}))
+	require.NoError(t, store.Save("oci://ghcr.io/org/charts/app", state.ImageState{
+		LastPushed: ts1,
+		Version:    "1.4.0",
+		AppVersion: "2.0.1",
+	}))
+
+	tracker := NewTracker()
+	backend := &fakeBackend{
+		cfg: &config.Config{Images: []config.ImageEntry{
+			{Ref: "php:8.2.30-fpm", Labels: map[string]string{"team": "web"}},
+			{Ref: "ghcr.io/org/img:latest"},
+		}, Charts: []config.ChartEntry{
+			{Ref: "oci://ghcr.io/org/charts/app", Notifiers: []string{"ops"}},
+		}},
+		tracker: tracker,
+	}
+	server := httptest.NewServer(NewServer(backend, store, tracker).Handler())
+	t.Cleanup(server.Close)
+	return server, backend
+}
+
+func decode[T any](t *testing.T, resp *http.Response) T {
+	t.Helper()
+	defer resp.Body.Close()
+	var v T
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&v))
+	return v
+}
+
+func TestServer_List(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	resp, err := http.Get(server.URL + "/api/images")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	list := decode[[]imageStatus](t, resp)
+
+	require.Len(t, list, 2)
+	assert.Equal(t, "php:8.2.30-fpm", list[0].Ref)
+	assert.Equal(t, ts2, *list[0].LastPushed)
+	assert.Equal(t, "sha256:beef", list[0].Digest)
+	assert.Equal(t, "web", list[0].Labels["team"])
+	assert.Nil(t, list[0].LastCheck)
+	assert.Empty(t, list[0].History, "history is only part of the detail view")
+	assert.Nil(t, list[1].LastPushed)
+}
+
+func TestServer_Detail(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	resp, err := http.Get(server.URL + "/api/images/library/php:8.2.30-fpm")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	detail := decode[imageStatus](t, resp)
+	assert.Equal(t, "php:8.2.30-fpm", detail.Ref)
+	require.Len(t, detail.History, 2)
+	assert.Equal(t, "sha256:beef", detail.History[1].Digest)
+
+	resp, err = http.Get(server.URL + "/api/images/redis:7")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestServer_CheckNow(t *testing.T) {
+	server, backend := newTestServer(t)
+
+	resp, err := http.Post(server.URL+"/api/check?ref=php:8.2.30-fpm", "", nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	result := decode[checkResponse](t, resp)
+
+	assert.Equal(t, [][]string{{"php:8.2.30-fpm"}}, backend.checked)
+	require.Len(t, result.Images, 1)
+	assert.Equal(t, ts2, *result.Images[0].LastCheck)
+	assert.Empty(t, result.Images[0].LastError)
+
+	resp, err = http.Post(server.URL+"/api/check", "", nil)
+	require.NoError(t, err)
+	result = decode[checkResponse](t, resp)
+	require.Len(t, result.Images, 2)
+	assert.Equal(t, "no scraper", result.Images[1].LastError)
+
+	resp, err = http.Post(server.URL+"/api/check?ref=redis:7", "", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestServer_Charts(t *testing.T) {
+	server, backend := newTestServer(t)
+
+	resp, err := http.Get(server.URL + "/api/charts")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	list := decode[[]imageStatus](t, resp)
+	require.Len(t, list, 1)
+	assert.Equal(t, "oci://ghcr.io/org/charts/app", list[0].Ref)
+	assert.Equal(t, "1.4.0", list[0].Version)
+	assert.Equal(t, "2.0.1", list[0].AppVersion)
+	assert.Equal(t, []string{"ops"}, list[0].Notifiers)
+	assert.Nil(t, list[0].LastCheck)
+
+	resp, err = http.Post(server.URL+"/api/check?ref=oci://ghcr.io/org/charts/app", "", nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	result := decode[checkResponse](t, resp)
+	assert.Equal(t, [][]string{{"oci://ghcr.io/org/charts/app"}}, backend.checked)
+	assert.Empty(t, result.Images)
+	require.Len(t, result.Charts, 1)
+	assert.Equal(t, "oci://ghcr.io/org/charts/app", result.Charts[0].Ref)
+	assert.Equal(t, ts2, *result.Charts[0].LastCheck)
+}
+
+func TestServer_CheckRejectsCrossOrigin(t *testing.T) {
+	server, backend := newTestServer(t)
+
+	for _, path := range []string{"/check", "/api/check"} {
+		for name, header := range map[string][2]string{
+			"cross-site fetch": {"Sec-Fetch-Site", "cross-site"},
+			"foreign origin":   {"Origin", "https://evil.example"},
+		} {
+			req, err := http.NewRequest(http.MethodPost, server.URL+path, nil)
+			require.NoError(t, err)
+			req.Header.Set(header[0], header[1])
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusForbidden, resp.StatusCode, "%s %s", path, name)
+		}
+	}
+	assert.Empty(t, backend.checked)
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/api/check", nil)
+	require.NoError(t, err)
+	req.Header.Set("Sec-Fetch-Site", "same-origin")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestServer_Dashboard(t *testing.T) {
+	server, backend := newTestServer(t)
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	resp, err := client.PostForm(server.URL+"/check", url.Values{"ref": {"php:8.2.30-fpm"}})
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusSeeOther, resp.StatusCode)
+	assert.Equal(t, [][]string{{"php:8.2.30-fpm"}}, backend.checked)
+
+	resp, err = http.Get(server.URL + "/")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	body := string(data)
+	assert.Contains(t, body, "php:8.2.30-fpm")
+	assert.Contains(t, body, "2026-02-04 17:56:28Z")
+	assert.Contains(t, body, `<span class="error">no scraper</span>`)
+	assert.Contains(t, body, "oci://ghcr.io/org/charts/app")
+	assert.Contains(t, body, "1.4.0")
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"sync"
+	"time"
+
+	"github.com/wutscho/registry-ping/internal/checker"
+)
+
+// checkStatus is the outcome of the most recent check of one image.
+type checkStatus struct {
+	CheckedAt time.Time
+	Err       string
+}
+
+// Tracker remembers the last check result per image. Results are kept in
+// memory only; after a restart they are filled in by the first run.
+type Tracker struct {
+	mu      sync.RWMutex
+	results map[string]checkStatus
+}
+
+// NewTracker creates an empty Tracker.
+func NewTracker() *Tracker {
+	return &Tracker{results: make(map[string]checkStatus)}
+}
+
+// Record stores r. It is meant to be passed to checker.WithResultHook.
+func (t *Tracker) Record(r checker.Result) {
+	st := checkStatus{CheckedAt: r.CheckedAt}
+	if r.Err != nil {
+		st.Err = r.Err.Error()
+	}
+	t.mu.Lock()
+	t.results[r.Ref] = st
+	t.mu.Unlock()
+}
+
+func (t *Tracker) get(ref string) (checkStatus, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	st, ok := t.results[ref]
+	return st, ok
+}
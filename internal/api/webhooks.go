@@ -0,0 +1,255 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/wutscho/registry-ping/internal/registry"
+)
+
+// maxWebhookBody limits the size of accepted webhook payloads.
+const maxWebhookBody = 1 << 20
+
+// dockerHubCallbackHost is the only host Docker Hub sends callback URLs for.
+const dockerHubCallbackHost = "registry.hub.docker.com"
+
+// pushedImage is a tag reported as pushed by a webhook. The payload is only
+// used to decide which configured images to check; their state always
+// comes from a regular fetch.
+type pushedImage struct {
+	host string // as in the payload, "" for Docker Hub
+	repo string // "org/img" or "img"
+	tag  string
+}
+
+func (p pushedImage) ref() string {
+	if p.host == "" {
+		return p.repo + ":" + p.tag
+	}
+	return p.host + "/" + p.repo + ":" + p.tag
+}
+
+// webhookParser extracts the pushed images from a webhook request body.
+type webhookParser func(r *http.Request) ([]pushedImage, error)
+
+// handleWebhook authenticates a webhook, maps the pushed tags to configured
+// images and checks those in the background.
+func (s *Server) handleWebhook(parse webhookParser) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hooks := s.backend.Config().Webhooks
+		if hooks == nil {
+			http.NotFound(w, r)
+			return
+		}
+		if !authorized(r, hooks.Secret) {
+			writeError(w, http.StatusUnauthorized, errors.New("invalid webhook secret"))
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxWebhookBody)
+		pushed, err := parse(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		refs := s.matchConfigured(pushed)
+		if len(refs) == 0 {
+			writeJSON(w, http.StatusOK, map[string][]string{"checking": {}})
+			return
+		}
+		s.logger.Info("webhook: checking pushed images", "refs", refs)
+		s.enqueue(refs)
+		writeJSON(w, http.StatusAccepted, map[string][]string{"checking": refs})
+	}
+}
+
+// enqueue adds refs to the pending webhook checks and starts a worker
+// unless one is running. A burst of webhooks is checked by that single
+// worker, with the refs pushed meanwhile coalesced into its next check.
+func (s *Server) enqueue(refs []string) {
+	s.mu.Lock()
+	for _, ref := range refs {
+		if !slices.Contains(s.pending, ref) {
+			s.pending = append(s.pending, ref)
+		}
+	}
+	start := !s.draining
+	s.draining = true
+	s.mu.Unlock()
+
+	if start {
+		s.async(s.drain)
+	}
+}
+
+// drain checks the pending refs until there are none left.
+func (s *Server) drain() {
+	for {
+		s.mu.Lock()
+		refs := s.pending
+		s.pending = nil
+		if len(refs) == 0 {
+			s.draining = false
+			s.mu.Unlock()
+			return
+		}
+		s.mu.Unlock()
+
+		if err := s.backend.Check(context.Background(), refs); err != nil {
+			s.logger.Error("webhook check failed", "refs", refs, "err", err)
+		}
+	}
+}
+
+// authorized checks the shared secret in the Authorization header (with or
+// without "Bearer ") or the token query parameter, in constant time.
+func authorized(r *http.Request, secret string) bool {
+	candidates := []string{r.URL.Query().Get("token")}
+	if h := r.Header.Get("Authorization"); h != "" {
+		candidates = append(candidates, h, strings.TrimPrefix(h, "Bearer "))
+	}
+	ok := false
+	for _, c := range candidates {
+		if c != "" && subtle.ConstantTimeCompare([]byte(c), []byte(secret)) == 1 {
+			ok = true
+		}
+	}
+	return ok
+}
+
+// matchConfigured returns the configured refs that were pushed, in config
+// order. Docker Hub host aliases are treated as equal (see
+// registry.CanonicalHost).
+func (s *Server) matchConfigured(pushed []pushedImage) []string {
+	want := make(map[string]bool, len(pushed))
+	for _, p := range pushed {
+		if ref, err := registry.ParseImageRef(p.ref()); err == nil {
+			want[matchKey(ref)] = true
+		}
+	}
+	var refs []string
+	for _, entry := range s.backend.Config().Images {
+		ref, err := registry.ParseImageRef(entry.Ref)
+		if err != nil || !want[matchKey(ref)] {
+			continue
+		}
+		refs = append(refs, ref.String())
+		delete(want, matchKey(ref)) // a ref is checked once even if pushed twice
+	}
+	return refs
+}
+
+func matchKey(ref registry.ImageRef) string {
+	ref.Host = registry.CanonicalHost(ref.Host)
+	if ref.Host == "docker.io" && ref.Namespace == "" {
+		ref.Namespace = "library"
+	}
+	return ref.String()
+}
+
+type dockerHubPayload struct {
+	CallbackURL string `json:"callback_url"`
+	PushData    struct {
+		Tag string `json:"tag"`
+	} `json:"push_data"`
+	Repository struct {
+		RepoName string `json:"repo_name"`
+	} `json:"repository"`
+}
+
+// parseDockerHub parses a Docker Hub repository webhook. Requiring a Docker
+// Hub callback URL is only a sanity check against payloads of other
+// sources; anyone can copy the field, so authenticity rests on the token.
+func parseDockerHub(r *http.Request) ([]pushedImage, error) {
+	var p dockerHubPayload
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		return nil, fmt.Errorf("decode docker hub payload: %w", err)
+	}
+	u, err := url.Parse(p.CallbackURL)
+	if err != nil || u.Scheme != "https" || u.Host != dockerHubCallbackHost {
+		return nil, fmt.Errorf("invalid docker hub callback_url %q", p.CallbackURL)
+	}
+	if p.Repository.RepoName == "" || p.PushData.Tag == "" {
+		return nil, errors.New("docker hub payload lacks repository or tag")
+	}
+	return []pushedImage{{repo: p.Repository.RepoName, tag: p.PushData.Tag}}, nil
+}
+
+type distributionEnvelope struct {
+	Events []struct {
+		Action string `json:"action"`
+		Target struct {
+			Repository string `json:"repository"`
+			URL        string `json:"url"`
+			Tag        string `json:"tag"`
+		} `json:"target"`
+		Request struct {
+			Host string `json:"host"`
+		} `json:"request"`
+	} `json:"events"`
+}
+
+// parseDistribution parses a CNCF distribution (registry:2) notification
+// envelope. Only tag pushes are considered; blob and digest-only manifest
+// pushes do not move a tag.
+func parseDistribution(r *http.Request) ([]pushedImage, error) {
+	var env distributionEnvelope
+	if err := json.NewDecoder(r.Body).Decode(&env); err != nil {
+		return nil, fmt.Errorf("decode distribution envelope: %w", err)
+	}
+	var pushed []pushedImage
+	for _, ev := range env.Events {
+		if ev.Action != "push" || ev.Target.Tag == "" {
+			continue
+		}
+		host := ev.Request.Host
+		if u, err := url.Parse(ev.Target.URL); err == nil && u.Host != "" {
+			host = u.Host
+		}
+		pushed = append(pushed, pushedImage{host: host, repo: ev.Target.Repository, tag: ev.Target.Tag})
+	}
+	return pushed, nil
+}
+
+type harborPayload struct {
+	Type      string `json:"type"`
+	EventData struct {
+		Resources []struct {
+			Tag         string `json:"tag"`
+			ResourceURL string `json:"resource_url"`
+		} `json:"resources"`
+	} `json:"event_data"`
+}
+
+// parseHarbor parses a Harbor webhook; only PUSH_ARTIFACT events are used.
+func parseHarbor(r *http.Request) ([]pushedImage, error) {
+	var p harborPayload
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		return nil, fmt.Errorf("decode harbor payload: %w", err)
+	}
+	if p.Type != "PUSH_ARTIFACT" {
+		return nil, nil
+	}
+	var pushed []pushedImage
+	for _, res := range p.EventData.Resources {
+		if res.Tag == "" {
+			continue
+		}
+		// resource_url is "host/project/repo:tag".
+		name := strings.TrimSuffix(res.ResourceURL, ":"+res.Tag)
+		host, repo, ok := strings.Cut(name, "/")
+		if !ok {
+			continue
+		}
+		pushed = append(pushed, pushedImage{host: host, repo: repo, tag: res.Tag})
+	}
+	return pushed, nil
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wutscho/registry-ping/internal/config"
+	"github.com/wutscho/registry-ping/internal/state"
+)
+
+const testSecret = "s3cr3t"
+
+func newWebhookServer(t *testing.T, hooks *config.WebhooksConfig) (*httptest.Server, *fakeBackend) {
+	t.Helper()
+	tracker := NewTracker()
+	backend := &fakeBackend{
+		cfg: &config.Config{
+			Webhooks: hooks,
+			Images: []config.ImageEntry{
+				{Ref: "myorg/app:latest"},
+				{Ref: "registry.example.com:5000/team/api:1.0"},
+				{Ref: "harbor.example.com/library/nginx:v1"},
+			},
+		},
+		tracker: tracker,
+	}
+	s := NewServer(backend, state.NewJSONStateStore(filepath.Join(t.TempDir(), "state.json")), tracker)
+	s.async = func(f func()) { f() }
+	server := httptest.NewServer(s.Handler())
+	t.Cleanup(server.Close)
+	return server, backend
+}
+
+func postHook(t *testing.T, url, auth, body string) (*http.Response, map[string][]string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	require.NoError(t, err)
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	if resp.StatusCode >= 400 {
+		resp.Body.Close()
+		return resp, nil
+	}
+	return resp, decode[map[string][]string](t, resp)
+}
+
+const dockerHubBody = `{
+  "callback_url": "https://registry.hub.docker.com/u/myorg/app/hook/2141b5bi5i5b02bec211i4eeih0242eg11000a/",
+  "push_data": {"pushed_at": 1417566161, "pusher": "ci", "tag": "latest"},
+  "repository": {"name": "app", "namespace": "myorg", "repo_name": "myorg/app"}
+}`
+
+func TestWebhook_DockerHub(t *testing.T) {
+	server, backend := newWebhookServer(t, &config.WebhooksConfig{Secret: testSecret})
+
+	resp, body := postHook(t, server.URL+"/hooks/dockerhub?token="+testSecret, "", dockerHubBody)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Equal(t, []string{"myorg/app:latest"}, body["checking"])
+	assert.Equal(t, [][]string{{"myorg/app:latest"}}, backend.checked)
+}
+
+func TestWebhook_DockerHubForgedCallback(t *testing.T) {
+	server, backend := newWebhookServer(t, &config.WebhooksConfig{Secret: testSecret})
+	forged := strings.Replace(dockerHubBody, "registry.hub.docker.com", "evil.example.com", 1)
+
+	resp, _ := postHook(t, server.URL+"/hooks/dockerhub?token="+testSecret, "", forged)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Empty(t, backend.checked)
+}
+
+func TestWebhook_Distribution(t *testing.T) {
+	server, backend := newWebhookServer(t, &config.WebhooksConfig{Secret: testSecret})
+	body := `{"events": [
+	  {"action": "push", "target": {"mediaType": "application/octet-stream", "repository": "team/api", "digest": "sha256:aa"},
+	   "request": {"host": "registry.example.com:5000"}},
+	  {"action": "push", "target": {"mediaType": "application/vnd.oci.image.index.v1+json", "repository": "team/api",
+	   "url": "https://registry.example.com:5000/v2/team/api/manifests/sha256:bb", "tag": "1.0"}},
+	  {"action": "pull", "target": {"repository": "team/api", "tag": "1.0"}, "request": {"host": "registry.example.com:5000"}},
+	  {"action": "push", "target": {"repository": "team/other", "tag": "1.0"}, "request": {"host": "registry.example.com:5000"}}
+	]}`
+
+	resp, got := postHook(t, server.URL+"/hooks/distribution", "Bearer "+testSecret, body)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Equal(t, []string{"registry.example.com:5000/team/api:1.0"}, got["checking"])
+	assert.Equal(t, [][]string{{"registry.example.com:5000/team/api:1.0"}}, backend.checked)
+}
+
+func TestWebhook_Harbor(t *testing.T) {
+	server, backend := newWebhookServer(t, &config.WebhooksConfig{Secret: testSecret})
+	body := `{"type": "PUSH_ARTIFACT", "occur_at": 1680502371, "operator": "robot$ci",
+	  "event_data": {"resources": [{"digest": "sha256:cc", "tag": "v1", "resource_url": "harbor.example.com/library/nginx:v1"}],
+	  "repository": {"name": "nginx", "namespace": "library", "repo_full_name": "library/nginx"}}}`
+
+	// Harbor sends the configured auth header value as is.
+	resp, got := postHook(t, server.URL+"/hooks/harbor", testSecret, body)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Equal(t, []string{"harbor.example.com/library/nginx:v1"}, got["checking"])
+	assert.Len(t, backend.checked, 1)
+}
+
+func TestWebhook_NoMatch(t *testing.T) {
+	server, backend := newWebhookServer(t, &config.WebhooksConfig{Secret: testSecret})
+	body := strings.ReplaceAll(dockerHubBody, `"tag": "latest"`, `"tag": "dev"`)
+
+	resp, got := postHook(t, server.URL+"/hooks/dockerhub?token="+testSecret, "", body)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, got["checking"])
+	assert.Empty(t, backend.checked)
+}
+
+func TestWebhook_Unauthorized(t *testing.T) {
+	server, backend := newWebhookServer(t, &config.WebhooksConfig{Secret: testSecret})
+
+	for _, auth := range []string{"", "Bearer wrong", "wrong"} {
+		resp, _ := postHook(t, server.URL+"/hooks/dockerhub", auth, dockerHubBody)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "auth %q", auth)
+	}
+	assert.Empty(t, backend.checked)
+}
+
+func TestWebhook_DisabledWithoutConfig(t *testing.T) {
+	server, _ := newWebhookServer(t, nil)
+
+	resp, _ := postHook(t, server.URL+"/hooks/dockerhub?token="+testSecret, "", dockerHubBody)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestWebhook_DockerHubHostAliases(t *testing.T) {
+	server, backend := newWebhookServer(t, &config.WebhooksConfig{Secret: testSecret})
+
+	for _, host := range []string{"docker.io", "index.docker.io", "registry-1.docker.io"} {
+		body := `{"events": [{"action": "push", "target": {"repository": "myorg/app", "tag": "latest"}, "request": {"host": "` + host + `"}}]}`
+		resp, got := postHook(t, server.URL+"/hooks/distribution", "Bearer "+testSecret, body)
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode, host)
+		assert.Equal(t, []string{"myorg/app:latest"}, got["checking"], host)
+	}
+	assert.Len(t, backend.checked, 3)
+}
+
+func TestWebhook_ChecksCoalesced(t *testing.T) {
+	backend := &fakeBackend{cfg: &config.Config{}, tracker: NewTracker()}
+	s := NewServer(backend, state.NewJSONStateStore(filepath.Join(t.TempDir(), "state.json")), backend.tracker)
+	var workers []func()
+	s.async = func(f func()) { workers = append(workers, f) }
+
+	s.enqueue([]string{"myorg/app:latest"})
+	s.enqueue([]string{"myorg/app:latest", "nginx:1.25"})
+	require.Len(t, workers, 1, "one worker for a burst of webhooks")
+
+	workers[0]()
+	assert.Equal(t, [][]string{{"myorg/app:latest", "nginx:1.25"}}, backend.checked)
+
+	s.enqueue([]string{"nginx:1.25"})
+	require.Len(t, workers, 2, "a new worker once the last one finished")
+}
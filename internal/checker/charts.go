@@ -0,0 +1,158 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/wutscho/registry-ping/internal/config"
+	"github.com/wutscho/registry-ping/internal/helm"
+	"github.com/wutscho/registry-ping/internal/metrics"
+	"github.com/wutscho/registry-ping/internal/notify"
+	"github.com/wutscho/registry-ping/internal/registry"
+	"github.com/wutscho/registry-ping/internal/state"
+	"github.com/wutscho/registry-ping/internal/tracing"
+)
+
+// RunCharts checks the charts for new releases. Like Run, it returns the
+// combined errors of all charts.
+func (c *Checker) RunCharts(ctx context.Context, charts []config.ChartEntry) error {
+	ctx, span := c.tracer.Start(ctx, "run charts", tracing.Int("charts", len(charts)))
+	defer span.Finish()
+
+	var errs []error
+	for _, entry := range charts {
+		err := c.check(ctx, "chart.ref", entry.Ref, func(ctx context.Context, span *tracing.Span) (string, error) {
+			return c.checkChart(ctx, span, entry)
+		})
+		if err != nil {
+			errs = append(errs, inSource(entry.Source, err))
+		}
+		if c.onResult != nil {
+			key := entry.Ref
+			if ref, perr := helm.ParseChartRef(entry.Ref); perr == nil {
+				key = ref.String()
+			}
+			c.onResult(Result{Ref: key, CheckedAt: c.now().UTC(), Err: err})
+		}
+	}
+
+	err := errors.Join(errs...)
+	span.SetAttributes(tracing.Int("errors", len(errs)))
+	span.SetError(err)
+	return err
+}
+
+// checkChart compares the latest release of a chart with the stored one.
+// A higher version, or the same version republished with another digest,
+// is a change; a lower one, left after the latest was yanked, is ignored.
+// The state is kept like an image's, under the chart ref, with the
+// release's creation time (or the detection time) as LastPushed.
+func (c *Checker) checkChart(ctx context.Context, span *tracing.Span, entry config.ChartEntry) (string, error) {
+	ref, err := helm.ParseChartRef(entry.Ref)
+	if err != nil {
+		return "", fmt.Errorf("parse chart ref %q: %w", entry.Ref, err)
+	}
+	host := ref.Host()
+	span.SetAttributes(tracing.String("registry.host", metrics.RegistryLabel(host)))
+	if c.charts == nil {
+		return "", fmt.Errorf("no chart client for %s", ref)
+	}
+
+	key := ref.String()
+	base := notify.ChangeEvent{Chart: key}
+	log := c.logger.With("chart", key)
+	if entry.Source != "" {
+		log = log.With("config", entry.Source)
+	}
+	st, found, err := c.load(ctx, key)
+	if err != nil {
+		return "", fmt.Errorf("load state for %s: %w", ref, err)
+	}
+	if found {
+		c.metrics.ChartReleased(key, host, st.LastPushed)
+	}
+
+	// Retry deliveries left over from earlier runs before looking for new releases.
+	var errs []error
+	if changed, err := c.deliver(ctx, base, &st); changed {
+		if saveErr := c.save(ctx, key, st); saveErr != nil {
+			return "", fmt.Errorf("save state for %s: %w", ref, saveErr)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("notify for %s: %w", ref, err))
+		}
+	}
+
+	start := c.now()
+	rel, err := c.charts.Latest(ctx, ref)
+	elapsed := c.now().Sub(start)
+	c.metrics.CheckDuration(host, elapsed)
+	if err != nil {
+		class := registry.ErrorClass(err)
+		c.metrics.FetchError(host, class)
+		log.Debug("fetch failed", "class", class, "duration", elapsed, "err", err)
+		span.SetAttributes(tracing.String("error.class", class))
+		return "", errors.Join(append(errs, fmt.Errorf("fetch %s: %w", ref, err))...)
+	}
+	c.metrics.ChartReleased(key, host, rel.Created)
+	c.metrics.ChartCheckSucceeded(key, host, c.now())
+
+	pushed := rel.Created
+	if pushed.IsZero() {
+		pushed = c.now().UTC()
+	}
+
+	outcome := outcomeChanged
+	var ev state.PendingEvent
+	switch {
+	case !found:
+		outcome = outcomeFirstSeen
+		ev = c.newPendingEvent(log, entry.Notifiers, time.Time{}, pushed, true)
+	case rel.Version == st.Version && (rel.Digest == "" || st.Digest == "" || rel.Digest == st.Digest):
+		log.Debug("no change", "version", rel.Version, "digest", rel.Digest, "duration", elapsed)
+		return outcomeUnchanged, errors.Join(errs...)
+	case rel.Version == st.Version, helm.Newer(rel.Version, st.Version):
+		ev = c.newPendingEvent(log, entry.Notifiers, st.LastPushed, pushed, false)
+		ev.OldVersion = st.Version
+		ev.OldAppVersion = st.AppVersion
+	default:
+		// The recorded version was yanked or the index is stale; wait
+		// for a version above it.
+		log.Info("latest release is older than the recorded one, ignoring it", "version", rel.Version, "recorded_version", st.Version)
+		return outcomeUnchanged, errors.Join(errs...)
+	}
+	ev.NewVersion = rel.Version
+	ev.NewAppVersion = rel.AppVersion
+	st.Outbox = append(st.Outbox, ev)
+	log.Info("change detected", "old_version", st.Version, "new_version", rel.Version,
+		"old_app_version", st.AppVersion, "new_app_version", rel.AppVersion, "digest", rel.Digest, "first_seen", !found)
+	st.LastPushed = pushed
+	st.Digest = rel.Digest
+	st.Version = rel.Version
+	st.AppVersion = rel.AppVersion
+	st.AddHistory(state.HistoryEntry{
+		Pushed:     pushed,
+		Digest:     rel.Digest,
+		Version:    rel.Version,
+		AppVersion: rel.AppVersion,
+		DetectedAt: c.now().UTC(),
+	})
+
+	// Persist the change and its pending notification together before delivering.
+	if err := c.save(ctx, key, st); err != nil {
+		return "", errors.Join(append(errs, fmt.Errorf("save state for %s: %w", ref, err))...)
+	}
+	changed, err := c.deliver(ctx, base, &st)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("notify for %s: %w", ref, err))
+	}
+	if changed {
+		if err := c.save(ctx, key, st); err != nil {
+			errs = append(errs, fmt.Errorf("save state for %s: %w", ref, err))
+		}
+	}
+
+	return outcome, errors.Join(errs...)
+}
@@ -0,0 +1,148 @@
+package checker
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wutscho/registry-ping/internal/config"
+	"github.com/wutscho/registry-ping/internal/helm"
+	"github.com/wutscho/registry-ping/internal/metrics"
+	"github.com/wutscho/registry-ping/internal/notify"
+	"github.com/wutscho/registry-ping/internal/registry"
+	"github.com/wutscho/registry-ping/internal/state"
+)
+
+type mockCharts struct {
+	rel helm.Release
+	err error
+}
+
+func (m *mockCharts) Latest(context.Context, helm.ChartRef) (helm.Release, error) {
+	return m.rel, m.err
+}
+
+const appChart = "oci://ghcr.io/org/charts/app"
+
+func charts(refs ...string) []config.ChartEntry {
+	entries := make([]config.ChartEntry, len(refs))
+	for i, r := range refs {
+		entries[i] = config.ChartEntry{Ref: r}
+	}
+	return entries
+}
+
+func TestChecker_ChartFirstSeen(t *testing.T) {
+	store := newMockStore(nil)
+	notifier := &mockNotifier{}
+	client := &mockCharts{rel: helm.Release{Version: "1.2.0", AppVersion: "4.1", Digest: "sha256:a", Created: ts1}}
+
+	c := NewChecker(&mockScraperRegistry{}, store, notifier, WithCharts(client))
+	require.NoError(t, c.RunCharts(context.Background(), charts(appChart)))
+
+	require.Len(t, notifier.events, 1)
+	assert.Equal(t, notify.ChangeEvent{
+		Chart:         appChart,
+		NewPushed:     ts1,
+		IsFirstSeen:   true,
+		NewVersion:    "1.2.0",
+		NewAppVersion: "4.1",
+	}, notifier.events[0])
+	st := store.saved[appChart]
+	assert.Equal(t, "1.2.0", st.Version)
+	assert.Equal(t, "4.1", st.AppVersion)
+	assert.Equal(t, "sha256:a", st.Digest)
+	assert.Empty(t, st.Outbox)
+}
+
+func TestChecker_ChartNewVersion(t *testing.T) {
+	store := newMockStore(map[string]state.ImageState{
+		appChart: {LastPushed: ts1, Version: "1.2.0", AppVersion: "4.1", Digest: "sha256:a"},
+	})
+	notifier := &mockNotifier{}
+	client := &mockCharts{rel: helm.Release{Version: "1.3.0", AppVersion: "4.2", Digest: "sha256:b"}}
+
+	c := NewChecker(&mockScraperRegistry{}, store, notifier, WithCharts(client))
+	c.now = func() time.Time { return ts2 }
+	require.NoError(t, c.RunCharts(context.Background(), charts(appChart)))
+
+	require.Len(t, notifier.events, 1)
+	ev := notifier.events[0]
+	assert.Equal(t, appChart, ev.Subject())
+	assert.Equal(t, ts1, ev.OldPushed)
+	assert.Equal(t, ts2, ev.NewPushed, "detection time without a creation time")
+	assert.Equal(t, "1.2.0", ev.OldVersion)
+	assert.Equal(t, "1.3.0", ev.NewVersion)
+	assert.Equal(t, "4.1", ev.OldAppVersion)
+	assert.Equal(t, "4.2", ev.NewAppVersion)
+	require.Len(t, store.saved[appChart].History, 1)
+	assert.Equal(t, "1.3.0", store.saved[appChart].History[0].Version)
+}
+
+func TestChecker_ChartUnchangedOrRepublished(t *testing.T) {
+	store := newMockStore(map[string]state.ImageState{
+		appChart: {LastPushed: ts1, Version: "1.2.0", AppVersion: "4.1", Digest: "sha256:a"},
+	})
+	notifier := &mockNotifier{}
+	client := &mockCharts{rel: helm.Release{Version: "1.2.0", AppVersion: "4.1", Digest: "sha256:a", Created: ts1}}
+
+	c := NewChecker(&mockScraperRegistry{}, store, notifier, WithCharts(client))
+	require.NoError(t, c.RunCharts(context.Background(), charts(appChart)))
+	assert.Empty(t, notifier.events)
+	assert.Empty(t, store.saved)
+
+	client.rel.Digest = "sha256:b"
+	client.rel.Created = ts2
+	require.NoError(t, c.RunCharts(context.Background(), charts(appChart)))
+	require.Len(t, notifier.events, 1)
+	assert.Equal(t, "1.2.0", notifier.events[0].NewVersion)
+	assert.Equal(t, "sha256:b", store.saved[appChart].Digest)
+}
+
+func TestChecker_ChartYankedVersion(t *testing.T) {
+	recorded := state.ImageState{LastPushed: ts2, Version: "1.3.0", AppVersion: "4.2", Digest: "sha256:b"}
+	store := newMockStore(map[string]state.ImageState{appChart: recorded})
+	notifier := &mockNotifier{}
+	client := &mockCharts{rel: helm.Release{Version: "1.2.0", AppVersion: "4.1", Digest: "sha256:a", Created: ts1}}
+
+	c := NewChecker(&mockScraperRegistry{}, store, notifier, WithCharts(client))
+	require.NoError(t, c.RunCharts(context.Background(), charts(appChart)))
+	assert.Empty(t, notifier.events, "a yanked release is not a change")
+	assert.Empty(t, store.saved)
+
+	client.rel = helm.Release{Version: "1.3.1", Digest: "sha256:c"}
+	require.NoError(t, c.RunCharts(context.Background(), charts(appChart)))
+	require.Len(t, notifier.events, 1)
+	assert.Equal(t, "1.3.0", notifier.events[0].OldVersion)
+	assert.Equal(t, "1.3.1", notifier.events[0].NewVersion)
+}
+
+func TestChecker_ChartMetrics(t *testing.T) {
+	m := metrics.New()
+	client := &mockCharts{rel: helm.Release{Version: "1.2.0", Created: ts1}}
+	c := NewChecker(&mockScraperRegistry{}, newMockStore(nil), &mockNotifier{}, WithCharts(client), WithMetrics(m))
+	require.NoError(t, c.RunCharts(context.Background(), charts(appChart)))
+
+	var buf bytes.Buffer
+	require.NoError(t, m.Registry().WriteText(&buf))
+	out := buf.String()
+	assert.Contains(t, out, `registry_ping_chart_last_released_timestamp_seconds{ref="`+appChart+`",registry="ghcr.io"}`)
+	assert.Contains(t, out, `registry_ping_chart_last_success_timestamp_seconds{ref="`+appChart+`",registry="ghcr.io"}`)
+	assert.NotContains(t, out, `registry_ping_image_last_pushed_timestamp_seconds{ref="`+appChart, "charts are not images")
+}
+
+func TestChecker_ChartFetchError(t *testing.T) {
+	var results []Result
+	client := &mockCharts{err: registry.ErrNotFound}
+	c := NewChecker(&mockScraperRegistry{}, newMockStore(nil), &mockNotifier{},
+		WithCharts(client), WithResultHook(func(r Result) { results = append(results, r) }))
+
+	err := c.RunCharts(context.Background(), charts("https://charts.example.com/stable/app"))
+	assert.ErrorIs(t, err, registry.ErrNotFound)
+	require.Len(t, results, 1)
+	assert.Equal(t, "https://charts.example.com/stable/app", results[0].Ref)
+	assert.Error(t, results[0].Err)
+}
@@ -4,11 +4,16 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"time"
 
 	"github.com/wutscho/registry-ping/internal/config"
+	"github.com/wutscho/registry-ping/internal/helm"
+	"github.com/wutscho/registry-ping/internal/metrics"
 	"github.com/wutscho/registry-ping/internal/notify"
 	"github.com/wutscho/registry-ping/internal/registry"
 	"github.com/wutscho/registry-ping/internal/state"
+	"github.com/wutscho/registry-ping/internal/tracing"
 )
 
 // scraperFor is a function type to allow testing without a real ScraperRegistry.
@@ -17,84 +22,311 @@ type scraperFor interface {
 }
 
 // Checker orchestrates fetching, comparing, and notifying for a list of images.
+//
+// Detected changes are written to the image's outbox in the same Save as the
+// new state and then delivered to each sink. Failed deliveries are retried
+// with backoff on later runs, giving at-least-once delivery per sink.
 type Checker struct {
 	scrapers scraperFor
+	charts   chartClient
 	store    state.StateStore
-	notifier notify.Notifier
+	sinks    []notify.Sink
+	metrics  *metrics.Metrics
+	tracer   *tracing.Tracer
+	onResult func(Result)
+	logger   *slog.Logger
+	now      func() time.Time
 }
 
-// NewChecker creates a Checker.
-func NewChecker(scrapers scraperFor, store state.StateStore, notifier notify.Notifier) *Checker {
-	return &Checker{
+// chartClient finds the latest release of a Helm chart; *helm.Client
+// implements it.
+type chartClient interface {
+	Latest(ctx context.Context, ref helm.ChartRef) (helm.Release, error)
+}
+
+// Result is the outcome of checking a single image or chart.
+type Result struct {
+	// Ref is the normalized image or chart ref, as used for the state key.
+	Ref       string
+	CheckedAt time.Time
+	Err       error
+}
+
+// Option is a functional option for Checker.
+type Option func(*Checker)
+
+// WithMetrics records check, fetch and notification metrics in m.
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(c *Checker) {
+		c.metrics = m
+	}
+}
+
+// WithTracer records a span for every run, image check, state load and save
+// and notifier call. Scraper HTTP requests become child spans if the
+// scrapers' client uses the tracer's Transport.
+func WithTracer(t *tracing.Tracer) Option {
+	return func(c *Checker) {
+		c.tracer = t
+	}
+}
+
+// WithResultHook calls fn with the outcome of every image check.
+func WithResultHook(fn func(Result)) Option {
+	return func(c *Checker) {
+		c.onResult = fn
+	}
+}
+
+// WithCharts sets the client RunCharts looks up chart releases with.
+func WithCharts(client chartClient) Option {
+	return func(c *Checker) {
+		c.charts = client
+	}
+}
+
+// WithLogger sets the logger for per-image diagnostics (default slog.Default()).
+func WithLogger(l *slog.Logger) Option {
+	return func(c *Checker) {
+		c.logger = l
+	}
+}
+
+// NewChecker creates a Checker. If notifier is a *notify.Multi, delivery is
+// tracked separately for each of its sinks.
+func NewChecker(scrapers scraperFor, store state.StateStore, notifier notify.Notifier, opts ...Option) *Checker {
+	c := &Checker{
 		scrapers: scrapers,
 		store:    store,
-		notifier: notifier,
+		sinks:    notify.SinksOf(notifier),
+		logger:   slog.Default(),
+		now:      time.Now,
 	}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
 }
 
 // Run checks all images in the config for updates.
 // It collects all errors and returns them as a combined error; partial success is allowed.
 func (c *Checker) Run(ctx context.Context, images []config.ImageEntry) error {
+	ctx, span := c.tracer.Start(ctx, "run", tracing.Int("images", len(images)))
+	defer span.Finish()
+
 	var errs []error
 
 	for _, entry := range images {
-		if err := c.check(ctx, entry.Ref); err != nil {
-			errs = append(errs, err)
+		err := c.check(ctx, "image.ref", entry.Ref, func(ctx context.Context, span *tracing.Span) (string, error) {
+			return c.checkImage(ctx, span, entry)
+		})
+		if err != nil {
+			errs = append(errs, inSource(entry.Source, err))
+		}
+		if c.onResult != nil {
+			key := entry.Ref
+			if ref, perr := registry.ParseImageRef(entry.Ref); perr == nil {
+				key = ref.String()
+			}
+			c.onResult(Result{Ref: key, CheckedAt: c.now().UTC(), Err: err})
 		}
 	}
 
-	return errors.Join(errs...)
+	err := errors.Join(errs...)
+	c.metrics.RunFinished(c.now(), err)
+	span.SetAttributes(tracing.Int("errors", len(errs)))
+	span.SetError(err)
+	return err
 }
 
-func (c *Checker) check(ctx context.Context, refStr string) error {
-	ref, err := registry.ParseImageRef(refStr)
-	if err != nil {
-		return fmt.Errorf("parse ref %q: %w", refStr, err)
+// Check outcomes, recorded as the "outcome" span attribute.
+const (
+	outcomeUnchanged = "unchanged"
+	outcomeChanged   = "changed"
+	outcomeFirstSeen = "first_seen"
+	outcomeError     = "error"
+)
+
+// check runs fn, the check of one image or chart, in a span recording its
+// ref as refAttr and its outcome.
+func (c *Checker) check(ctx context.Context, refAttr, ref string, fn func(context.Context, *tracing.Span) (string, error)) error {
+	ctx, span := c.tracer.Start(ctx, "check", tracing.String(refAttr, ref))
+	defer span.Finish()
+
+	outcome, err := fn(ctx, span)
+	if outcome == "" {
+		outcome = outcomeError
 	}
+	span.SetAttributes(tracing.String("outcome", outcome))
+	span.SetError(err)
+	return err
+}
 
-	scraper, err := c.scrapers.For(ref)
+// checkImage does the work of check and reports the outcome, or "" if the
+// check failed. Notification and save errors after a successful fetch are
+// returned alongside the outcome.
+func (c *Checker) checkImage(ctx context.Context, span *tracing.Span, entry config.ImageEntry) (string, error) {
+	ref, err := registry.ParseImageRef(entry.Ref)
 	if err != nil {
-		return fmt.Errorf("no scraper for %s: %w", ref, err)
+		return "", fmt.Errorf("parse ref %q: %w", entry.Ref, err)
 	}
+	span.SetAttributes(tracing.String("registry.host", metrics.RegistryLabel(ref.Host)))
 
-	info, err := scraper.Fetch(ctx, ref)
+	scraper, err := c.scrapers.For(ref)
 	if err != nil {
-		return fmt.Errorf("fetch %s: %w", ref, err)
+		return "", fmt.Errorf("no scraper for %s: %w", ref, err)
 	}
 
 	key := ref.String()
-	prev, found, err := c.store.Load(key)
+	base := notify.ChangeEvent{Ref: ref}
+	log := c.logger.With("ref", key)
+	if entry.Source != "" {
+		log = log.With("config", entry.Source)
+	}
+	st, found, err := c.load(ctx, key)
+	if err == nil && !found && ref.Namespace == "library" && registry.CanonicalHost(ref.Host) != "docker.io" {
+		// Earlier versions dropped "library/" on every registry; pick up
+		// state saved under that key. Changes are saved under the new one.
+		legacy := ref
+		legacy.Namespace = ""
+		st, found, err = c.load(ctx, legacy.String())
+	}
 	if err != nil {
-		return fmt.Errorf("load state for %s: %w", ref, err)
+		return "", fmt.Errorf("load state for %s: %w", ref, err)
+	}
+	if found {
+		c.metrics.ImagePushed(key, ref.Host, st.LastPushed)
 	}
 
-	if !found {
-		if err := c.notifier.Notify(notify.ChangeEvent{
-			Ref:         ref,
-			NewPushed:   info.LastPushed,
-			IsFirstSeen: true,
-		}); err != nil {
-			return fmt.Errorf("notify for %s: %w", ref, err)
+	// Retry deliveries left over from earlier runs before looking for new changes.
+	var errs []error
+	if changed, err := c.deliver(ctx, base, &st); changed {
+		if saveErr := c.save(ctx, key, st); saveErr != nil {
+			return "", fmt.Errorf("save state for %s: %w", ref, saveErr)
 		}
-		if err := c.store.Save(key, state.ImageState{LastPushed: info.LastPushed}); err != nil {
-			return fmt.Errorf("save state for %s: %w", ref, err)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("notify for %s: %w", ref, err))
+		}
+	}
+
+	start := c.now()
+	info, err := scraper.Fetch(ctx, ref)
+	elapsed := c.now().Sub(start)
+	c.metrics.CheckDuration(ref.Host, elapsed)
+	if err != nil {
+		class := registry.ErrorClass(err)
+		c.metrics.FetchError(ref.Host, class)
+		log.Debug("fetch failed", "class", class, "duration", elapsed, "err", err)
+		span.SetAttributes(tracing.String("error.class", class))
+		return "", errors.Join(append(errs, fmt.Errorf("fetch %s: %w", ref, err))...)
+	}
+	c.metrics.ImagePushed(key, ref.Host, info.LastPushed)
+	c.metrics.CheckSucceeded(key, ref.Host, c.now())
+
+	if info.Source != "" {
+		log = log.With("source", info.Source)
+		span.SetAttributes(tracing.String("source", info.Source))
+	}
+
+	// Digests are compared whenever both sides have one, so that every
+	// source of a mirror chain is judged alike; push times only decide
+	// without them. Sources without push times, such as distribution API
+	// mirrors, have the detection time stand in for the push time.
+	pushed := info.LastPushed
+	if pushed.IsZero() {
+		pushed = c.now().UTC()
+	}
+
+	outcome := outcomeChanged
+	switch {
+	case !found:
+		outcome = outcomeFirstSeen
+		st.Outbox = append(st.Outbox, c.newPendingEvent(log, entry.Notifiers, time.Time{}, pushed, true))
+	case info.Digest != "" && st.Digest != "" && info.Digest == st.Digest:
+		log.Debug("no change", "pushed", info.LastPushed, "digest", info.Digest, "duration", elapsed)
+		return outcomeUnchanged, errors.Join(errs...)
+	case info.Digest != "" && st.Digest != "" && staleMirror(ref, info, st):
+		log.Info("mirror answered with an earlier digest, ignoring it", "digest", info.Digest, "current_digest", st.Digest)
+		return outcomeUnchanged, errors.Join(errs...)
+	case info.Digest != "" && st.Digest != "",
+		info.LastPushed.After(st.LastPushed):
+		st.Outbox = append(st.Outbox, c.newPendingEvent(log, entry.Notifiers, st.LastPushed, pushed, false))
+	case info.Digest != "" && st.Digest == "":
+		// Nothing to compare against yet: adopt the digest silently.
+		st.Digest = info.Digest
+		if err := c.save(ctx, key, st); err != nil {
+			return "", errors.Join(append(errs, fmt.Errorf("save state for %s: %w", ref, err))...)
 		}
-		return nil
+		return outcomeUnchanged, errors.Join(errs...)
+	default:
+		log.Debug("no change", "pushed", info.LastPushed, "digest", info.Digest, "duration", elapsed)
+		return outcomeUnchanged, errors.Join(errs...)
 	}
+	args := []any{"old_pushed", st.LastPushed, "new_pushed", pushed, "digest", info.Digest, "first_seen", !found}
+	if info.Scan != nil {
+		args = append(args, "scan_severity", info.Scan.Severity, "vulnerabilities", info.Scan.Total)
+	}
+	log.Info("change detected", args...)
+	st.LastPushed = pushed
+	st.Digest = info.Digest
+	st.AddHistory(state.HistoryEntry{Pushed: pushed, Digest: info.Digest, DetectedAt: c.now().UTC()})
 
-	if info.LastPushed.After(prev.LastPushed) {
-		if err := c.notifier.Notify(notify.ChangeEvent{
-			Ref:       ref,
-			OldPushed: prev.LastPushed,
-			NewPushed: info.LastPushed,
-		}); err != nil {
-			return fmt.Errorf("notify for %s: %w", ref, err)
+	// Persist the change and its pending notification together before delivering.
+	if err := c.save(ctx, key, st); err != nil {
+		return "", errors.Join(append(errs, fmt.Errorf("save state for %s: %w", ref, err))...)
+	}
+	changed, err := c.deliver(ctx, base, &st)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("notify for %s: %w", ref, err))
+	}
+	if changed {
+		if err := c.save(ctx, key, st); err != nil {
+			errs = append(errs, fmt.Errorf("save state for %s: %w", ref, err))
 		}
-		if err := c.store.Save(key, state.ImageState{LastPushed: info.LastPushed}); err != nil {
-			return fmt.Errorf("save state for %s: %w", ref, err)
+	}
+
+	return outcome, errors.Join(errs...)
+}
+
+// inSource attributes err to source, the config file the failed image or
+// chart entry was loaded from.
+func inSource(source string, err error) error {
+	if source == "" {
+		return err
+	}
+	return fmt.Errorf("%w (configured in %s)", err, source)
+}
+
+// staleMirror reports whether info, answered by a mirror rather than the
+// registry itself, has a digest the tag pointed to before: a pull-through
+// cache that has not caught up yet, not a change.
+func staleMirror(ref registry.ImageRef, info registry.ImageInfo, st state.ImageState) bool {
+	if info.Source == "" || info.Source == registry.CanonicalHost(ref.Host) {
+		return false
+	}
+	for _, h := range st.History {
+		if h.Digest == info.Digest {
+			return true
 		}
 	}
-	// else: no change, silent
+	return false
+}
+
+// load reads the state for key within a span.
+func (c *Checker) load(ctx context.Context, key string) (state.ImageState, bool, error) {
+	_, span := c.tracer.Start(ctx, "state.load", tracing.String("image.ref", key))
+	defer span.Finish()
+	st, found, err := c.store.Load(key)
+	span.SetAttributes(tracing.Bool("found", found))
+	span.SetError(err)
+	return st, found, err
+}
 
-	return nil
+// save writes the state for key within a span.
+func (c *Checker) save(ctx context.Context, key string, st state.ImageState) error {
+	_, span := c.tracer.Start(ctx, "state.save", tracing.String("image.ref", key))
+	defer span.Finish()
+	err := c.store.Save(key, st)
+	span.SetError(err)
+	return err
 }
@@ -1,17 +1,22 @@
 package checker
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"log/slog"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/wutscho/registry-ping/internal/config"
+	"github.com/wutscho/registry-ping/internal/metrics"
 	"github.com/wutscho/registry-ping/internal/notify"
 	"github.com/wutscho/registry-ping/internal/registry"
 	"github.com/wutscho/registry-ping/internal/state"
+	"github.com/wutscho/registry-ping/internal/tracing"
 )
 
 // --- mock scraper registry ---
@@ -67,22 +72,32 @@ func (m *mockStateStore) Load(key string) (state.ImageState, bool, error) {
 	return st, ok, nil
 }
 
+func (m *mockStateStore) LoadAll() (map[string]state.ImageState, error) {
+	if m.loadErr != nil {
+		return nil, m.loadErr
+	}
+	return m.data, nil
+}
+
 func (m *mockStateStore) Save(key string, s state.ImageState) error {
 	if m.saveErr != nil {
 		return m.saveErr
 	}
 	m.saved[key] = s
+	m.data[key] = s
 	return nil
 }
 
 // --- mock notifier ---
 
 type mockNotifier struct {
-	events []notify.ChangeEvent
-	err    error
+	events   []notify.ChangeEvent
+	err      error
+	attempts int
 }
 
 func (m *mockNotifier) Notify(event notify.ChangeEvent) error {
+	m.attempts++
 	if m.err != nil {
 		return m.err
 	}
@@ -156,6 +171,113 @@ func TestChecker_Updated(t *testing.T) {
 	assert.Equal(t, ts2, store.saved["php:8.2.30-fpm"].LastPushed)
 }
 
+func TestChecker_LegacyStateKeys(t *testing.T) {
+	scraper := &mockScraper{info: registry.ImageInfo{LastPushed: ts2}}
+	reg := &mockScraperRegistry{scraper: scraper}
+	// Keys as written before "library/" was kept outside Docker Hub.
+	store := newMockStore(map[string]state.ImageState{
+		"docker.io/nginx:1":           {LastPushed: ts2},
+		"harbor.example.com/nginx:v1": {LastPushed: ts2},
+	})
+	notifier := &mockNotifier{}
+
+	c := NewChecker(reg, store, notifier)
+	err := c.Run(context.Background(), images("docker.io/library/nginx:1", "harbor.example.com/library/nginx:v1"))
+
+	require.NoError(t, err)
+	assert.Empty(t, notifier.events, "no notification expected for state under the old keys")
+	assert.Empty(t, store.saved)
+}
+
+func TestChecker_DigestOnlySource(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	scraper := &mockScraper{info: registry.ImageInfo{Digest: "sha256:bbb", Source: "mirror.example.com"}}
+	reg := &mockScraperRegistry{scraper: scraper}
+	store := newMockStore(map[string]state.ImageState{
+		"php:8.2.30-fpm": {LastPushed: ts1, Digest: "sha256:aaa"},
+	})
+	notifier := &mockNotifier{}
+
+	c := NewChecker(reg, store, notifier)
+	c.now = func() time.Time { return now }
+	require.NoError(t, c.Run(context.Background(), images("php:8.2.30-fpm")))
+
+	require.Len(t, notifier.events, 1)
+	assert.Equal(t, ts1, notifier.events[0].OldPushed)
+	assert.Equal(t, now, notifier.events[0].NewPushed, "detection time stands in for the push time")
+	assert.Equal(t, "sha256:bbb", store.saved["php:8.2.30-fpm"].Digest)
+
+	// The same digest again is no change.
+	notifier.events = nil
+	require.NoError(t, c.Run(context.Background(), images("php:8.2.30-fpm")))
+	assert.Empty(t, notifier.events)
+}
+
+func TestChecker_DigestOnlyAdoptsMissingDigest(t *testing.T) {
+	scraper := &mockScraper{info: registry.ImageInfo{Digest: "sha256:bbb"}}
+	reg := &mockScraperRegistry{scraper: scraper}
+	store := newMockStore(map[string]state.ImageState{
+		"php:8.2.30-fpm": {LastPushed: ts1},
+	})
+	notifier := &mockNotifier{}
+
+	c := NewChecker(reg, store, notifier)
+	require.NoError(t, c.Run(context.Background(), images("php:8.2.30-fpm")))
+
+	assert.Empty(t, notifier.events)
+	assert.Equal(t, "sha256:bbb", store.saved["php:8.2.30-fpm"].Digest)
+	assert.Equal(t, ts1, store.saved["php:8.2.30-fpm"].LastPushed)
+}
+
+func TestChecker_StaleMirrorDigest(t *testing.T) {
+	// The registry itself answered last; a pull-through cache still serving
+	// the previous image answers this run.
+	scraper := &mockScraper{info: registry.ImageInfo{Digest: "sha256:aaa", Source: "mirror.example.com"}}
+	reg := &mockScraperRegistry{scraper: scraper}
+	store := newMockStore(map[string]state.ImageState{
+		"php:8.2.30-fpm": {LastPushed: ts2, Digest: "sha256:bbb", History: []state.HistoryEntry{
+			{Pushed: ts1, Digest: "sha256:aaa", DetectedAt: ts1},
+			{Pushed: ts2, Digest: "sha256:bbb", DetectedAt: ts2},
+		}},
+	})
+	notifier := &mockNotifier{}
+
+	c := NewChecker(reg, store, notifier)
+	require.NoError(t, c.Run(context.Background(), images("php:8.2.30-fpm")))
+	assert.Empty(t, notifier.events, "a stale mirror is no change")
+	assert.Empty(t, store.saved)
+
+	// Once the mirror catches up, its digest matches and nothing fires either.
+	scraper.info.Digest = "sha256:bbb"
+	require.NoError(t, c.Run(context.Background(), images("php:8.2.30-fpm")))
+	assert.Empty(t, notifier.events)
+	assert.Empty(t, store.saved)
+}
+
+func TestChecker_DigestDecidesOverPushTime(t *testing.T) {
+	scraper := &mockScraper{info: registry.ImageInfo{LastPushed: ts2, Digest: "sha256:aaa"}}
+	reg := &mockScraperRegistry{scraper: scraper}
+	store := newMockStore(map[string]state.ImageState{
+		"php:8.2.30-fpm": {LastPushed: ts1, Digest: "sha256:aaa"},
+	})
+	notifier := &mockNotifier{}
+
+	c := NewChecker(reg, store, notifier)
+	require.NoError(t, c.Run(context.Background(), images("php:8.2.30-fpm")))
+	assert.Empty(t, notifier.events, "same digest with a later push time is no change")
+
+	// A push time source records the digest it reports.
+	store.data["php:8.2.30-fpm"] = state.ImageState{LastPushed: ts2}
+	require.NoError(t, c.Run(context.Background(), images("php:8.2.30-fpm")))
+	assert.Empty(t, notifier.events)
+	assert.Equal(t, "sha256:aaa", store.saved["php:8.2.30-fpm"].Digest)
+
+	scraper.info.Digest = "sha256:bbb"
+	require.NoError(t, c.Run(context.Background(), images("php:8.2.30-fpm")))
+	require.Len(t, notifier.events, 1)
+	assert.Equal(t, "sha256:bbb", store.saved["php:8.2.30-fpm"].Digest)
+}
+
 func TestChecker_FetchErrorCollected(t *testing.T) {
 	fetchErr := errors.New("connection refused")
 	scraper := &mockScraper{err: fetchErr}
@@ -169,6 +291,10 @@ func TestChecker_FetchErrorCollected(t *testing.T) {
 	require.Error(t, err)
 	assert.Empty(t, notifier.events)
 	assert.Empty(t, store.saved)
+
+	err = c.Run(context.Background(), []config.ImageEntry{{Ref: "php:8.2.30-fpm", Source: "conf.d/web.yaml"}})
+	assert.ErrorIs(t, err, fetchErr)
+	assert.Contains(t, err.Error(), "(configured in conf.d/web.yaml)")
 }
 
 func TestChecker_UnknownScraper(t *testing.T) {
@@ -182,3 +308,225 @@ func TestChecker_UnknownScraper(t *testing.T) {
 	require.Error(t, err)
 	assert.Empty(t, notifier.events)
 }
+
+func TestChecker_NotifyFailureKeepsOutbox(t *testing.T) {
+	scraper := &mockScraper{info: registry.ImageInfo{LastPushed: ts2}}
+	reg := &mockScraperRegistry{scraper: scraper}
+	store := newMockStore(map[string]state.ImageState{
+		"php:8.2.30-fpm": {LastPushed: ts1},
+	})
+	notifier := &mockNotifier{err: errors.New("webhook down")}
+
+	c := NewChecker(reg, store, notifier)
+	c.now = func() time.Time { return ts2 }
+	err := c.Run(context.Background(), images("php:8.2.30-fpm"))
+
+	require.Error(t, err)
+	saved := store.saved["php:8.2.30-fpm"]
+	assert.Equal(t, ts2, saved.LastPushed, "state must advance together with the outbox")
+	require.Len(t, saved.Outbox, 1)
+	ev := saved.Outbox[0]
+	assert.Equal(t, ts1, ev.OldPushed)
+	assert.Equal(t, ts2, ev.NewPushed)
+	d := ev.Sinks[notify.DefaultSinkName]
+	require.NotNil(t, d)
+	assert.False(t, d.Delivered)
+	assert.Equal(t, 1, d.Attempts)
+	assert.Equal(t, ts2.Add(time.Minute), d.NextAttempt)
+	assert.Equal(t, "webhook down", d.LastError)
+}
+
+func TestChecker_OutboxRetriedWithBackoff(t *testing.T) {
+	scraper := &mockScraper{info: registry.ImageInfo{LastPushed: ts2}}
+	reg := &mockScraperRegistry{scraper: scraper}
+	store := newMockStore(nil)
+	notifier := &mockNotifier{err: errors.New("webhook down")}
+
+	c := NewChecker(reg, store, notifier)
+	now := ts2
+	c.now = func() time.Time { return now }
+
+	require.Error(t, c.Run(context.Background(), images("php:8.2.30-fpm")))
+	assert.Equal(t, 1, notifier.attempts)
+
+	// Not yet due: no attempt, no error.
+	now = ts2.Add(30 * time.Second)
+	require.NoError(t, c.Run(context.Background(), images("php:8.2.30-fpm")))
+	assert.Equal(t, 1, notifier.attempts)
+
+	// Due and the sink recovered: delivered exactly once and removed.
+	notifier.err = nil
+	now = ts2.Add(2 * time.Minute)
+	require.NoError(t, c.Run(context.Background(), images("php:8.2.30-fpm")))
+	require.Len(t, notifier.events, 1)
+	assert.True(t, notifier.events[0].IsFirstSeen)
+	assert.Equal(t, ts2, notifier.events[0].NewPushed)
+	assert.Empty(t, store.data["php:8.2.30-fpm"].Outbox)
+
+	// Nothing left to deliver.
+	require.NoError(t, c.Run(context.Background(), images("php:8.2.30-fpm")))
+	assert.Len(t, notifier.events, 1)
+}
+
+func TestChecker_OutboxPerSink(t *testing.T) {
+	scraper := &mockScraper{info: registry.ImageInfo{LastPushed: ts2}}
+	reg := &mockScraperRegistry{scraper: scraper}
+	store := newMockStore(map[string]state.ImageState{
+		"php:8.2.30-fpm": {LastPushed: ts1},
+	})
+	good := &mockNotifier{}
+	flaky := &mockNotifier{err: errors.New("timeout")}
+
+	c := NewChecker(reg, store, notify.NewMulti(
+		notify.Sink{Name: "stdout", Notifier: good},
+		notify.Sink{Name: "webhook", Notifier: flaky},
+	))
+	now := ts2
+	c.now = func() time.Time { return now }
+
+	require.Error(t, c.Run(context.Background(), images("php:8.2.30-fpm")))
+	require.Len(t, good.events, 1)
+	outbox := store.data["php:8.2.30-fpm"].Outbox
+	require.Len(t, outbox, 1)
+	assert.True(t, outbox[0].Sinks["stdout"].Delivered)
+	assert.False(t, outbox[0].Sinks["webhook"].Delivered)
+
+	flaky.err = nil
+	now = ts2.Add(time.Hour)
+	require.NoError(t, c.Run(context.Background(), images("php:8.2.30-fpm")))
+	assert.Len(t, good.events, 1, "delivered sink must not be notified again")
+	require.Len(t, flaky.events, 1)
+	assert.Equal(t, ts1, flaky.events[0].OldPushed)
+	assert.Empty(t, store.data["php:8.2.30-fpm"].Outbox)
+}
+
+func TestChecker_NoSinksWarns(t *testing.T) {
+	reg := &mockScraperRegistry{scraper: &mockScraper{info: registry.ImageInfo{LastPushed: ts2}}}
+	store := newMockStore(nil)
+	var buf bytes.Buffer
+
+	c := NewChecker(reg, store, notify.NewMulti(), WithLogger(slog.New(slog.NewTextHandler(&buf, nil))))
+	require.NoError(t, c.Run(context.Background(), images("php:8.2.30-fpm")))
+
+	assert.Contains(t, buf.String(), "level=WARN msg=\"change recorded without notifiers to deliver it\" ref=php:8.2.30-fpm")
+	assert.Empty(t, store.saved["php:8.2.30-fpm"].Outbox)
+}
+
+func TestRetryDelay(t *testing.T) {
+	assert.Equal(t, time.Minute, retryDelay(1))
+	assert.Equal(t, 2*time.Minute, retryDelay(2))
+	assert.Equal(t, 8*time.Minute, retryDelay(4))
+	assert.Equal(t, 6*time.Hour, retryDelay(20))
+}
+
+func TestChecker_ImageNotifierRouting(t *testing.T) {
+	scraper := &mockScraper{info: registry.ImageInfo{LastPushed: ts2}}
+	reg := &mockScraperRegistry{scraper: scraper}
+	store := newMockStore(nil)
+	desktop := &mockNotifier{}
+	ops := &mockNotifier{}
+
+	c := NewChecker(reg, store, notify.NewMulti(
+		notify.Sink{Name: "desktop", Notifier: desktop},
+		notify.Sink{Name: "ops", Notifier: ops},
+	))
+	err := c.Run(context.Background(), []config.ImageEntry{
+		{Ref: "php:8.2.30-fpm", Notifiers: []string{"ops"}},
+		{Ref: "nginx:1.25-alpine"},
+	})
+
+	require.NoError(t, err)
+	require.Len(t, desktop.events, 1)
+	assert.Equal(t, "nginx:1.25-alpine", desktop.events[0].Ref.String())
+	require.Len(t, ops.events, 2)
+}
+
+func TestChecker_Metrics(t *testing.T) {
+	reg := &mockScraperRegistry{scraper: &mockScraper{info: registry.ImageInfo{LastPushed: ts2}}}
+	store := newMockStore(nil)
+	m := metrics.New()
+
+	c := NewChecker(reg, store, &mockNotifier{}, WithMetrics(m))
+	require.NoError(t, c.Run(context.Background(), images("php:8.2.30-fpm")))
+
+	reg.scraper = &mockScraper{err: fmt.Errorf("dockerhub: %w", registry.ErrNotFound)}
+	require.Error(t, c.Run(context.Background(), images("php:99")))
+
+	var buf bytes.Buffer
+	require.NoError(t, m.Registry().WriteText(&buf))
+	out := buf.String()
+	assert.Contains(t, out, `registry_ping_image_last_pushed_timestamp_seconds{ref="php:8.2.30-fpm",registry="docker.io"} 1.770227788e+09`)
+	assert.Contains(t, out, `registry_ping_image_last_success_timestamp_seconds{ref="php:8.2.30-fpm",registry="docker.io"}`)
+	assert.Contains(t, out, `registry_ping_check_duration_seconds_count{registry="docker.io"} 2`)
+	assert.Contains(t, out, `registry_ping_fetch_errors_total{registry="docker.io",class="not_found"} 1`)
+	assert.Contains(t, out, `registry_ping_notifications_sent_total{notifier="default"} 1`)
+	assert.Contains(t, out, "registry_ping_last_run_success 0")
+}
+
+func TestChecker_ResultHookAndHistory(t *testing.T) {
+	reg := &mockScraperRegistry{scraper: &mockScraper{info: registry.ImageInfo{LastPushed: ts2, Digest: "sha256:beef"}}}
+	store := newMockStore(map[string]state.ImageState{
+		"php:8.2.30-fpm": {LastPushed: ts1},
+	})
+	var results []Result
+
+	c := NewChecker(reg, store, &mockNotifier{}, WithResultHook(func(r Result) {
+		results = append(results, r)
+	}))
+	c.now = func() time.Time { return ts2 }
+	require.NoError(t, c.Run(context.Background(), images("library/php:8.2.30-fpm")))
+
+	require.Len(t, results, 1)
+	assert.Equal(t, Result{Ref: "php:8.2.30-fpm", CheckedAt: ts2}, results[0])
+	saved := store.saved["php:8.2.30-fpm"]
+	assert.Equal(t, "sha256:beef", saved.Digest)
+	assert.Equal(t, []state.HistoryEntry{{Pushed: ts2, Digest: "sha256:beef", DetectedAt: ts2}}, saved.History)
+}
+
+type spanRecorder struct {
+	spans []*tracing.Span
+}
+
+func (r *spanRecorder) Export(_ context.Context, _ string, spans []*tracing.Span) error {
+	r.spans = append(r.spans, spans...)
+	return nil
+}
+
+func TestChecker_Tracing(t *testing.T) {
+	reg := &mockScraperRegistry{scraper: &mockScraper{info: registry.ImageInfo{LastPushed: ts2}}}
+	store := newMockStore(map[string]state.ImageState{
+		"php:8.2.30-fpm": {LastPushed: ts1},
+		"nginx:1":        {LastPushed: ts2},
+	})
+	rec := &spanRecorder{}
+
+	tracer := tracing.NewTracer(rec, "test")
+	c := NewChecker(reg, store, &mockNotifier{}, WithTracer(tracer))
+	require.NoError(t, c.Run(context.Background(), images("php:8.2.30-fpm", "nginx:1")))
+	require.NoError(t, tracer.Shutdown(context.Background()))
+
+	var names []string
+	outcomes := map[string]tracing.Attr{}
+	var root *tracing.Span
+	for _, s := range rec.spans {
+		names = append(names, s.Name)
+		switch s.Name {
+		case "run":
+			root = s
+		case "check":
+			outcomes[s.Attrs[0].Value.(string)] = s.Attrs[len(s.Attrs)-1]
+			assert.Contains(t, s.Attrs, tracing.String("registry.host", "docker.io"))
+		}
+	}
+	assert.ElementsMatch(t, []string{
+		"state.load", "state.save", "notify", "state.save", "check",
+		"state.load", "check",
+		"run",
+	}, names)
+	require.NotNil(t, root)
+	for _, s := range rec.spans {
+		assert.Equal(t, root.TraceID, s.TraceID)
+	}
+	assert.Equal(t, tracing.String("outcome", "changed"), outcomes["php:8.2.30-fpm"])
+	assert.Equal(t, tracing.String("outcome", "unchanged"), outcomes["nginx:1"])
+}
@@ -0,0 +1,141 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/wutscho/registry-ping/internal/notify"
+	"github.com/wutscho/registry-ping/internal/state"
+	"github.com/wutscho/registry-ping/internal/tracing"
+)
+
+const (
+	retryBaseDelay = time.Minute
+	retryMaxDelay  = 6 * time.Hour
+)
+
+// retryDelay returns the backoff before the next delivery attempt after the
+// given number of failed attempts: 1m, 2m, 4m, ... capped at 6h.
+func retryDelay(attempts int) time.Duration {
+	d := retryBaseDelay
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= retryMaxDelay {
+			return retryMaxDelay
+		}
+	}
+	return d
+}
+
+// newPendingEvent records a change for delivery to every current sink, or
+// only to the sinks named in notifiers if set. Without sinks nobody will
+// learn of the change, which is logged to log.
+func (c *Checker) newPendingEvent(log *slog.Logger, notifiers []string, old, pushed time.Time, firstSeen bool) state.PendingEvent {
+	ev := state.PendingEvent{
+		OldPushed:   old,
+		NewPushed:   pushed,
+		IsFirstSeen: firstSeen,
+		CreatedAt:   c.now().UTC(),
+		Sinks:       make(map[string]*state.Delivery, len(c.sinks)),
+	}
+	for _, s := range c.sinks {
+		if len(notifiers) > 0 && !slices.Contains(notifiers, s.Name) {
+			continue
+		}
+		ev.Sinks[s.Name] = &state.Delivery{}
+	}
+	if len(ev.Sinks) == 0 {
+		log.Warn("change recorded without notifiers to deliver it", "new_pushed", pushed, "first_seen", firstSeen)
+	}
+	return ev
+}
+
+// deliver attempts every due, undelivered (event, sink) pair in st.Outbox
+// and removes fully delivered events. Notifications are base, the image or
+// chart, completed from each event. It reports whether st was modified and
+// returns the combined delivery errors. Deliveries to sinks that no longer
+// exist are dropped.
+func (c *Checker) deliver(ctx context.Context, base notify.ChangeEvent, st *state.ImageState) (bool, error) {
+	if len(st.Outbox) == 0 {
+		return false, nil
+	}
+
+	sinks := make(map[string]notify.Notifier, len(c.sinks))
+	for _, s := range c.sinks {
+		sinks[s.Name] = s.Notifier
+	}
+
+	subject := base.Subject()
+	refAttr := "image.ref"
+	if base.Chart != "" {
+		refAttr = "chart.ref"
+	}
+	now := c.now()
+	changed := false
+	var errs []error
+	remaining := st.Outbox[:0]
+
+	for _, ev := range st.Outbox {
+		for name, d := range ev.Sinks {
+			if d.Delivered {
+				continue
+			}
+			n, ok := sinks[name]
+			if !ok {
+				c.logger.Info("dropping delivery to removed notifier", "ref", subject, "sink", name)
+				delete(ev.Sinks, name)
+				changed = true
+				continue
+			}
+			if now.Before(d.NextAttempt) {
+				continue
+			}
+
+			changed = true
+			d.Attempts++
+			_, span := c.tracer.Start(ctx, "notify",
+				tracing.String(refAttr, subject),
+				tracing.String("notifier", name),
+				tracing.Int("attempt", d.Attempts))
+			event := base
+			event.OldPushed = ev.OldPushed
+			event.NewPushed = ev.NewPushed
+			event.IsFirstSeen = ev.IsFirstSeen
+			event.OldVersion = ev.OldVersion
+			event.NewVersion = ev.NewVersion
+			event.OldAppVersion = ev.OldAppVersion
+			event.NewAppVersion = ev.NewAppVersion
+			err := n.Notify(event)
+			span.SetError(err)
+			span.Finish()
+			c.metrics.Notification(name, err)
+			if err != nil {
+				d.NextAttempt = now.Add(retryDelay(d.Attempts)).UTC()
+				d.LastError = err.Error()
+				c.logger.Warn("notification failed", "ref", subject, "sink", name,
+					"attempt", d.Attempts, "next_attempt", d.NextAttempt, "err", err)
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				continue
+			}
+			c.logger.Debug("notification delivered", "ref", subject, "sink", name, "attempt", d.Attempts)
+			d.Delivered = true
+			d.NextAttempt = time.Time{}
+			d.LastError = ""
+		}
+		if ev.Done() {
+			changed = true
+			continue
+		}
+		remaining = append(remaining, ev)
+	}
+
+	if len(remaining) == 0 {
+		remaining = nil
+	}
+	st.Outbox = remaining
+	return changed, errors.Join(errs...)
+}
@@ -1,39 +1,328 @@
 package config
 
 import (
-	"fmt"
-	"os"
+	"path/filepath"
+	"time"
+)
 
-	"gopkg.in/yaml.v3"
+const (
+	defaultTimeout     = 60 * time.Second
+	defaultHTTPTimeout = 10 * time.Second
 )
 
 // Config is the top-level application configuration.
 type Config struct {
+	// Timeout bounds a whole check run (default 60s).
+	Timeout Duration `yaml:"timeout"`
+	// HTTPTimeout bounds each registry request (default 10s).
+	HTTPTimeout Duration `yaml:"http_timeout"`
+
+	// Include lists further config files, relative to this one. Entries may
+	// be globs such as "conf.d/*.yaml". Included files may only contain
+	// images, charts, notifiers and further includes.
+	Include []string `yaml:"include"`
+
+	// Registries configures the connection to individual registries, keyed
+	// by host as written in image refs ("docker.io" for Docker Hub).
+	Registries map[string]RegistryConfig `yaml:"registries"`
+
+	// Mirrors lists mirrors and pull-through caches per upstream host as
+	// written in image refs. Connection settings for a mirror are taken
+	// from Registries under the mirror's own host.
+	Mirrors map[string]MirrorConfig `yaml:"mirrors"`
+
+	// Plugins are external scraper executables, asked in order for images
+	// on the hosts they match, before the built-in scrapers.
+	Plugins []PluginConfig `yaml:"plugins"`
+
+	// HTTPCacheDir holds cached registry responses used for conditional
+	// requests. It defaults to "http-cache" next to StateFile; with StateS3
+	// caching is off unless set.
+	HTTPCacheDir string `yaml:"http_cache_dir"`
+
 	StateFile string       `yaml:"state_file"`
+	StateS3   *S3State     `yaml:"state_s3"`
 	Images    []ImageEntry `yaml:"images"`
+	// Charts are the Helm charts to watch for new releases.
+	Charts []ChartEntry `yaml:"charts"`
+	// Notifiers maps a sink name to its definition. The name is recorded in
+	// the state outbox, so renaming a notifier drops its pending deliveries.
+	// Without any notifiers, changes are printed to stdout.
+	Notifiers map[string]NotifierConfig `yaml:"notifiers"`
+
+	// Webhooks enables the inbound registry webhook endpoints of the daemon's
+	// HTTP server.
+	Webhooks *WebhooksConfig `yaml:"webhooks"`
+
+	// Log configures diagnostic logging to stderr.
+	Log LogConfig `yaml:"log"`
+
+	// Tracing exports OpenTelemetry spans of every check run.
+	Tracing *TracingConfig `yaml:"tracing"`
+
+	// Files lists every file the config was loaded from, main file first.
+	Files []string `yaml:"-"`
+}
+
+// WebhooksConfig configures the inbound registry webhooks.
+type WebhooksConfig struct {
+	// Secret must be presented by every webhook request, either as
+	// "Authorization: Bearer <secret>", as the raw Authorization header
+	// value, or as "?token=<secret>" for senders that cannot set headers.
+	Secret string `yaml:"secret"`
+}
+
+// RegistryConfig configures the HTTP connection to one registry, and the
+// API and credentials used to read its tags.
+type RegistryConfig struct {
+	// Type selects the registry API for hosts that are not recognized by
+	// name: "quay" for a self-hosted Red Hat Quay, "gitlab" for the
+	// registry of a self-hosted GitLab, "harbor" for Harbor, "ecr" or
+	// "google" for an ECR or Artifact Registry host needing its own
+	// credentials, "acr" for an Azure Container Registry. Hosts under
+	// azurecr.io, gcr.io and *-docker.pkg.dev are of type "acr" or
+	// "google" without it.
+	Type string `yaml:"type"`
+	// URL is the base URL of the registry API (default "https://<host>").
+	// For GitLab it is the GitLab instance, which often differs from the
+	// registry host; for ECR it overrides the API endpoint.
+	URL string `yaml:"url"`
+	// Token, or Username and Password, authenticate API requests. Which of
+	// them a registry accepts depends on its type: Quay takes an OAuth
+	// token or a robot account name and token, ghcr.io a GitHub token with
+	// read:packages, GitLab an access token or, as user "gitlab-ci-token",
+	// a CI job token, Harbor a robot account name and secret, ACR the admin
+	// user or a service principal's ID and secret, or an Azure AD refresh
+	// token (with Tenant).
+	Token    string `yaml:"token"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Tenant   string `yaml:"tenant"`
+	// AWSProfile selects the profile of the shared AWS credentials and
+	// config files for ECR. Without it, credentials come from the AWS_*
+	// environment variables or AWS_PROFILE.
+	AWSProfile string `yaml:"aws_profile"`
+	// CredentialsFile is a Google service account JSON key for this
+	// Artifact Registry or gcr.io host. Without it,
+	// GOOGLE_APPLICATION_CREDENTIALS is used if set.
+	CredentialsFile string `yaml:"credentials_file"`
+	// ScanOverview fetches Harbor's vulnerability scan summary along with
+	// each artifact.
+	ScanOverview bool `yaml:"scan_overview"`
+
+	// Proxy is the proxy URL for this registry. Empty uses HTTPS_PROXY and
+	// friends from the environment; "direct" bypasses any proxy.
+	Proxy string `yaml:"proxy"`
+	// CAFile is a PEM bundle trusted in addition to the system roots.
+	CAFile string `yaml:"ca_file"`
+	// CertFile and KeyFile are a PEM client certificate and key for mTLS.
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// InsecureSkipVerify disables certificate verification, for lab
+	// registries only.
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify"`
+	// Timeout bounds each request to this registry (default HTTPTimeout).
+	Timeout Duration `yaml:"timeout"`
+}
+
+// MirrorConfig lists the mirrors of one upstream registry.
+type MirrorConfig struct {
+	// Mode is "fallback" (default) to ask the mirrors only when the
+	// upstream fails, or "first" to ask them before the upstream.
+	Mode      string           `yaml:"mode"`
+	Endpoints []MirrorEndpoint `yaml:"endpoints"`
+}
+
+// MirrorEndpoint is a registry serving the OCI distribution API for the
+// upstream's repositories. Mirrors report digests but no push times, so
+// changes found through them are detected by digest.
+type MirrorEndpoint struct {
+	// URL is the mirror's base URL, e.g. "https://mirror.gcr.io".
+	URL      string `yaml:"url"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// Prefix is prepended to repository paths, for caches that serve an
+	// upstream under a project such as Harbor's "dockerhub-proxy".
+	Prefix string `yaml:"prefix"`
+}
+
+// PluginConfig declares an external scraper executable. See package
+// registry/plugin for the protocol it speaks.
+type PluginConfig struct {
+	// Name identifies the plugin in errors and logs.
+	Name string `yaml:"name"`
+	// Command is the executable, absolute or looked up in PATH, and its
+	// leading arguments; the method is appended on each call.
+	Command []string `yaml:"command"`
+	// Hosts are patterns of the image hosts the plugin handles, in the
+	// syntax of path.Match, e.g. "*.artifacts.corp.example".
+	Hosts []string `yaml:"hosts"`
+	// Env is added to the environment the plugin inherits.
+	Env map[string]string `yaml:"env"`
+	// Timeout bounds each call of the plugin (default HTTPTimeout).
+	Timeout Duration `yaml:"timeout"`
+}
+
+// LogConfig configures diagnostic logging.
+type LogConfig struct {
+	// Level is "debug", "info", "warn" or "error". Empty means "info" in
+	// daemon mode and "warn" for a single run, so cron mails only carry
+	// notifications and problems.
+	Level string `yaml:"level"`
+	// Format is "text" (default) or "json".
+	Format string `yaml:"format"`
+}
+
+// TracingConfig configures span export. Exactly one of Endpoint and File
+// must be set.
+type TracingConfig struct {
+	// Endpoint is the base URL of an OTLP/HTTP collector,
+	// e.g. "http://localhost:4318"; spans are posted to /v1/traces.
+	Endpoint string            `yaml:"endpoint"`
+	Headers  map[string]string `yaml:"headers"`
+	// File appends spans as OTLP/JSON lines to a local file.
+	File string `yaml:"file"`
+	// ServiceName is reported as service.name (default "registry-ping").
+	ServiceName string `yaml:"service_name"`
+	// Propagate sends the W3C traceparent header on registry, notifier and
+	// state requests.
+	Propagate bool `yaml:"propagate"`
+}
+
+// NotifierConfig defines a single notification sink.
+type NotifierConfig struct {
+	// Type is "stdout" or "webhook".
+	Type    string            `yaml:"type"`
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+}
+
+// S3State configures an S3-compatible bucket as state backend. When set, it
+// takes precedence over StateFile.
+type S3State struct {
+	Endpoint        string `yaml:"endpoint"`
+	Region          string `yaml:"region"`
+	Bucket          string `yaml:"bucket"`
+	Key             string `yaml:"key"`
+	PathStyle       bool   `yaml:"path_style"`
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+	SessionToken    string `yaml:"session_token"`
 }
 
 // ImageEntry is a single image to monitor.
+//
+// Ref may be a template: "php:{8.2,8.3}-{fpm,cli}" expands to one entry per
+// combination, and "{name}" placeholders take their values from Matrix. Load
+// returns the expanded entries, each inheriting the template's options.
 type ImageEntry struct {
 	Ref string `yaml:"ref"`
+	// Matrix binds the {name} placeholders of a template Ref to their values.
+	Matrix map[string][]string `yaml:"matrix"`
+	// Labels are free-form metadata. Values may use the {name} placeholders
+	// of Matrix.
+	Labels map[string]string `yaml:"labels"`
+	// Platforms lists the platforms of interest, e.g. "linux/amd64".
+	Platforms []string `yaml:"platforms"`
+	// Notifiers restricts change notifications for this image to the named
+	// notifiers. Empty means all notifiers.
+	Notifiers []string `yaml:"notifiers"`
+
+	// Source is the config file the entry was loaded from.
+	Source string `yaml:"-"`
+}
+
+// ChartEntry is a single Helm chart to monitor for new versions.
+type ChartEntry struct {
+	// Ref is "oci://<host>/<path>/<name>" for a chart in an OCI registry,
+	// or the repository URL followed by the chart name for a classic
+	// repository, e.g. "https://charts.bitnami.com/bitnami/nginx".
+	Ref string `yaml:"ref"`
+	// Labels are free-form metadata.
+	Labels map[string]string `yaml:"labels"`
+	// Notifiers restricts change notifications for this chart to the named
+	// notifiers. Empty means all notifiers.
+	Notifiers []string `yaml:"notifiers"`
+
+	// Source is the config file the entry was loaded from.
+	Source string `yaml:"-"`
 }
 
-// Load reads and parses a YAML config file from the given path.
-// StateFile defaults to "state.json" if not set.
+// Load reads and parses a YAML config file from the given path, together
+// with all files it includes (see Config.Include and loader.merge).
+// Environment variables and secret references in values are resolved first
+// (see interpolator). Unknown fields, malformed values, invalid or
+// duplicate image and chart refs and references to undefined notifiers are
+// then reported all at once as an *Error with the position of each problem.
+//
+// Timeout and HTTPTimeout default to 60s and 10s. The Timeout of each
+// registry and plugin defaults to HTTPTimeout, each mirror Mode to
+// "fallback" and Tracing.ServiceName to "registry-ping". StateFile defaults
+// to "state.json" if not set, and HTTPCacheDir to "http-cache" next to it.
+// For StateS3, Region defaults to "us-east-1", Endpoint to the AWS endpoint
+// of that region and Key to "state.json".
 func Load(path string) (*Config, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("config: read %s: %w", path, err)
+	l := newLoader()
+	if err := l.load(path, true); err != nil {
+		return nil, err
 	}
+	m := l.merge()
 
-	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("config: parse %s: %w", path, err)
+	var v validator
+	v.validate(m, l.files[0])
+	problems := append(l.problems, l.followUps(v.problems)...)
+	if len(problems) > 0 {
+		sortProblems(problems)
+		return nil, &Error{Problems: problems}
 	}
 
+	cfg := m.cfg
+	for _, f := range l.files {
+		cfg.Files = append(cfg.Files, f.path)
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = Duration(defaultTimeout)
+	}
+	if cfg.HTTPTimeout == 0 {
+		cfg.HTTPTimeout = Duration(defaultHTTPTimeout)
+	}
 	if cfg.StateFile == "" {
 		cfg.StateFile = "state.json"
 	}
+	for host, r := range cfg.Registries {
+		if r.Timeout == 0 {
+			r.Timeout = cfg.HTTPTimeout
+			cfg.Registries[host] = r
+		}
+	}
+	for i := range cfg.Plugins {
+		if cfg.Plugins[i].Timeout == 0 {
+			cfg.Plugins[i].Timeout = cfg.HTTPTimeout
+		}
+	}
+	for host, mc := range cfg.Mirrors {
+		if mc.Mode == "" {
+			mc.Mode = "fallback"
+			cfg.Mirrors[host] = mc
+		}
+	}
+	if cfg.HTTPCacheDir == "" && cfg.StateS3 == nil {
+		cfg.HTTPCacheDir = filepath.Join(filepath.Dir(cfg.StateFile), "http-cache")
+	}
+	if cfg.Tracing != nil && cfg.Tracing.ServiceName == "" {
+		cfg.Tracing.ServiceName = "registry-ping"
+	}
+	if s3 := cfg.StateS3; s3 != nil {
+		if s3.Region == "" {
+			s3.Region = "us-east-1"
+		}
+		if s3.Endpoint == "" {
+			s3.Endpoint = "https://s3." + s3.Region + ".amazonaws.com"
+		}
+		if s3.Key == "" {
+			s3.Key = "state.json"
+		}
+	}
 
 	return &cfg, nil
 }
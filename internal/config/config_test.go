@@ -1,9 +1,11 @@
 package config
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -42,6 +44,17 @@ images:
 	cfg, err := Load(path)
 	require.NoError(t, err)
 	assert.Equal(t, "state.json", cfg.StateFile)
+	assert.Equal(t, "http-cache", cfg.HTTPCacheDir)
+}
+
+func TestLoad_HTTPCacheDir(t *testing.T) {
+	cfg, err := Load(writeConfig(t, "state_file: /var/lib/registry-ping/state.json\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "/var/lib/registry-ping/http-cache", cfg.HTTPCacheDir)
+
+	cfg, err = Load(writeConfig(t, "state_s3:\n  bucket: b\n"))
+	require.NoError(t, err)
+	assert.Empty(t, cfg.HTTPCacheDir)
 }
 
 func TestLoad_MissingFile(t *testing.T) {
@@ -55,3 +68,655 @@ func TestLoad_InvalidYAML(t *testing.T) {
 	_, err := Load(path)
 	require.Error(t, err)
 }
+
+func TestLoad_StateS3(t *testing.T) {
+	path := writeConfig(t, `
+state_s3:
+  bucket: ci-state
+  region: eu-central-1
+images:
+  - ref: php:8.2.30-fpm
+`)
+
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	require.NotNil(t, cfg.StateS3)
+	assert.Equal(t, "ci-state", cfg.StateS3.Bucket)
+	assert.Equal(t, "https://s3.eu-central-1.amazonaws.com", cfg.StateS3.Endpoint)
+	assert.Equal(t, "state.json", cfg.StateS3.Key)
+}
+
+func TestLoad_StateS3MissingBucket(t *testing.T) {
+	path := writeConfig(t, `
+state_s3:
+  endpoint: http://localhost:9000
+`)
+
+	_, err := Load(path)
+	require.Error(t, err)
+}
+
+func TestLoad_Notifiers(t *testing.T) {
+	path := writeConfig(t, `
+images:
+  - ref: php:8.2.30-fpm
+notifiers:
+  desktop:
+    type: stdout
+  ops:
+    type: webhook
+    url: https://hooks.example.com/registry-ping
+    headers:
+      Authorization: Bearer token
+`)
+
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	require.Len(t, cfg.Notifiers, 2)
+	assert.Equal(t, "stdout", cfg.Notifiers["desktop"].Type)
+	assert.Equal(t, "https://hooks.example.com/registry-ping", cfg.Notifiers["ops"].URL)
+	assert.Equal(t, "Bearer token", cfg.Notifiers["ops"].Headers["Authorization"])
+}
+
+func TestLoad_InvalidNotifier(t *testing.T) {
+	tests := map[string]string{
+		"unknown type": "notifiers:\n  x:\n    type: carrier-pigeon\n",
+		"webhook url":  "notifiers:\n  x:\n    type: webhook\n",
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Load(writeConfig(t, content))
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestLoad_Interpolation(t *testing.T) {
+	t.Setenv("PHP_VERSION", "8.3")
+	t.Setenv("HOOK_TOKEN", "s3cr3t")
+	t.Setenv("EMPTY", "")
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "hook-url"), []byte("https://hooks.example.com/x\n"), 0o600))
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+state_file: ${STATE_DIR:-/var/lib/registry-ping}/state.json
+state_s3:
+  bucket: ${EMPTY:-fallback}
+  path_style: ${PATH_STYLE:-true}
+  secret_access_key: env:HOOK_TOKEN
+images:
+  - ref: php:${PHP_VERSION}-fpm
+  - ref: env:1.0
+notifiers:
+  ops:
+    type: webhook
+    url: file:hook-url
+    headers:
+      Authorization: Bearer ${HOOK_TOKEN}
+      X-Literal: $${NOT_EXPANDED}
+`), 0o644))
+
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, "/var/lib/registry-ping/state.json", cfg.StateFile)
+	assert.Equal(t, "fallback", cfg.StateS3.Bucket)
+	assert.True(t, cfg.StateS3.PathStyle)
+	assert.Equal(t, "s3cr3t", cfg.StateS3.SecretAccessKey)
+	assert.Equal(t, "php:8.3-fpm", cfg.Images[0].Ref)
+	assert.Equal(t, "env:1.0", cfg.Images[1].Ref, "image refs are not secret references")
+	assert.Equal(t, "https://hooks.example.com/x", cfg.Notifiers["ops"].URL)
+	assert.Equal(t, "Bearer s3cr3t", cfg.Notifiers["ops"].Headers["Authorization"])
+	assert.Equal(t, "${NOT_EXPANDED}", cfg.Notifiers["ops"].Headers["X-Literal"])
+}
+
+func TestLoad_UnresolvedReferences(t *testing.T) {
+	path := writeConfig(t, `
+images:
+  - ref: php:${MISSING_ONE}
+notifiers:
+  ops:
+    type: webhook
+    url: file:/nonexistent/secret
+    headers:
+      Authorization: env:MISSING_TWO
+`)
+
+	_, err := Load(path)
+	require.Error(t, err)
+	var cfgErr *Error
+	require.True(t, errors.As(err, &cfgErr))
+	require.Len(t, cfgErr.Problems, 3)
+	assert.Equal(t, 3, cfgErr.Problems[0].Line)
+	assert.Contains(t, cfgErr.Problems[0].Msg, "${MISSING_ONE}")
+	assert.Equal(t, 7, cfgErr.Problems[1].Line)
+	assert.Contains(t, cfgErr.Problems[1].Msg, "/nonexistent/secret")
+	assert.Equal(t, 9, cfgErr.Problems[2].Line)
+	assert.Contains(t, cfgErr.Problems[2].Msg, "MISSING_TWO")
+	assert.Contains(t, err.Error(), path+":3:")
+}
+
+func TestLoad_UnresolvedReferencesWithOtherProblems(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"config.yaml": `
+include: [conf.d/*.yaml]
+timeout: ${MISSING_TIMEOUT}
+colour: blue
+images:
+  - ref: php:8.2.30-fpm
+`,
+		"conf.d/web.yaml": `
+images:
+  - ref: nginx:1.25-alpine
+    notifiers: [pager]
+`,
+	})
+	main := filepath.Join(dir, "config.yaml")
+
+	problems := problemsOf(t, loadErr(main))
+	require.Len(t, problems, 3, "all problems are reported at once")
+	assert.Equal(t, filepath.Join(dir, "conf.d", "web.yaml"), problems[0].File)
+	assert.Contains(t, problems[0].Msg, `unknown notifier "pager"`)
+	assert.Equal(t, main, problems[1].File)
+	assert.Equal(t, 3, problems[1].Line)
+	assert.Contains(t, problems[1].Msg, "${MISSING_TIMEOUT}: environment variable not set")
+	assert.Equal(t, 4, problems[2].Line)
+	assert.Contains(t, problems[2].Msg, `unknown field "colour"`)
+}
+
+func problemsOf(t *testing.T, err error) []Problem {
+	t.Helper()
+	require.Error(t, err)
+	var cfgErr *Error
+	require.True(t, errors.As(err, &cfgErr), "expected *Error, got: %v", err)
+	return cfgErr.Problems
+}
+
+func TestLoad_UnknownFields(t *testing.T) {
+	path := writeConfig(t, `
+image:
+  - ref: php:8.2.30-fpm
+state_s3:
+  bucket: b
+  regoin: eu-central-1
+notifiers:
+  ops:
+    type: stdout
+    colour: blue
+`)
+
+	problems := problemsOf(t, loadErr(path))
+	require.Len(t, problems, 3)
+	assert.Equal(t, Problem{File: path, Line: 2, Column: 1, Msg: `unknown field "image" (did you mean "images"?)`}, problems[0])
+	assert.Equal(t, 6, problems[1].Line)
+	assert.Equal(t, 3, problems[1].Column)
+	assert.Contains(t, problems[1].Msg, `"regoin"`)
+	assert.Equal(t, 10, problems[2].Line)
+	assert.Contains(t, problems[2].Msg, `"colour"`)
+}
+
+func TestLoad_TypeErrors(t *testing.T) {
+	path := writeConfig(t, `
+timeout: soon
+state_s3:
+  bucket: b
+  path_style: maybe
+images: php:8.2.30-fpm
+`)
+
+	problems := problemsOf(t, loadErr(path))
+	require.Len(t, problems, 3)
+	assert.Equal(t, 2, problems[0].Line)
+	assert.Contains(t, problems[0].Msg, `invalid duration "soon"`)
+	assert.Equal(t, 5, problems[1].Line)
+	assert.Equal(t, 15, problems[1].Column)
+	assert.Equal(t, 6, problems[2].Line)
+	assert.Contains(t, problems[2].Msg, "expected a list")
+}
+
+func TestLoad_SemanticErrors(t *testing.T) {
+	path := writeConfig(t, `
+timeout: -5s
+images:
+  - ref: php:8.2.30-fpm
+  - ref: php
+  - ref: library/php:8.2.30-fpm
+  - ref: nginx:1.25-alpine
+    notifiers: [ops, pager]
+  - notifiers: [ops]
+notifiers:
+  ops:
+    type: stdout
+`)
+
+	problems := problemsOf(t, loadErr(path))
+	require.Len(t, problems, 5)
+	assert.Equal(t, 2, problems[0].Line)
+	assert.Contains(t, problems[0].Msg, "timeout")
+	assert.Equal(t, 5, problems[1].Line)
+	assert.Contains(t, problems[1].Msg, "tag required")
+	assert.Equal(t, 6, problems[2].Line)
+	assert.Contains(t, problems[2].Msg, "first defined at line 4")
+	assert.Equal(t, 8, problems[3].Line)
+	assert.Equal(t, 22, problems[3].Column)
+	assert.Contains(t, problems[3].Msg, `unknown notifier "pager"`)
+	assert.Equal(t, 9, problems[4].Line)
+	assert.Contains(t, problems[4].Msg, "ref is required")
+}
+
+func TestLoad_DefaultTimeouts(t *testing.T) {
+	cfg, err := Load(writeConfig(t, "http_timeout: 30s\n"))
+	require.NoError(t, err)
+	assert.Equal(t, 60*time.Second, cfg.Timeout.Std())
+	assert.Equal(t, 30*time.Second, cfg.HTTPTimeout.Std())
+}
+
+func loadErr(path string) error {
+	_, err := Load(path)
+	return err
+}
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	return dir
+}
+
+func TestLoad_Includes(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"config.yaml": `
+include:
+  - conf.d/*.yaml
+  - shared.yaml
+images:
+  - ref: php:8.2.30-fpm
+notifiers:
+  desktop:
+    type: stdout
+`,
+		"conf.d/20-team-b.yaml": `
+images:
+  - ref: redis:7
+`,
+		"conf.d/10-team-a.yaml": `
+images:
+  - ref: nginx:1.25-alpine
+    notifiers: [team-a, desktop]
+notifiers:
+  team-a:
+    type: webhook
+    url: https://hooks.example.com/a
+`,
+		"conf.d/README.md": "not yaml",
+		"shared.yaml":      "images:\n  - ref: postgres:16\n",
+	})
+
+	cfg, err := Load(filepath.Join(dir, "config.yaml"))
+	require.NoError(t, err)
+
+	var refs, sources []string
+	for _, img := range cfg.Images {
+		refs = append(refs, img.Ref)
+		sources = append(sources, filepath.ToSlash(img.Source[len(dir)+1:]))
+	}
+	assert.Equal(t, []string{"php:8.2.30-fpm", "nginx:1.25-alpine", "redis:7", "postgres:16"}, refs)
+	assert.Equal(t, []string{"config.yaml", "conf.d/10-team-a.yaml", "conf.d/20-team-b.yaml", "shared.yaml"}, sources)
+	assert.Len(t, cfg.Notifiers, 2)
+	assert.Equal(t, "webhook", cfg.Notifiers["team-a"].Type)
+	assert.Nil(t, cfg.Include)
+	assert.Len(t, cfg.Files, 4)
+}
+
+func TestLoad_EmptyIncludeGlob(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"config.yaml": "include: [conf.d/*.yaml]\nimages:\n  - ref: php:8.2.30-fpm\n",
+	})
+
+	cfg, err := Load(filepath.Join(dir, "config.yaml"))
+	require.NoError(t, err)
+	assert.Len(t, cfg.Images, 1)
+}
+
+func TestLoad_IncludeProblems(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"config.yaml": `
+include:
+  - a.yaml
+  - missing.yaml
+  - config.yaml
+images:
+  - ref: php:8.2.30-fpm
+notifiers:
+  ops:
+    type: stdout
+`,
+		"a.yaml": `
+state_file: /tmp/other.json
+images:
+  - ref: library/php:8.2.30-fpm
+notifiers:
+  ops:
+    type: stdout
+`,
+	})
+	main := filepath.Join(dir, "config.yaml")
+	included := filepath.Join(dir, "a.yaml")
+
+	problems := problemsOf(t, loadErr(main))
+	require.Len(t, problems, 5)
+
+	assert.Equal(t, included, problems[0].File)
+	assert.Equal(t, 2, problems[0].Line)
+	assert.Contains(t, problems[0].Msg, `"state_file" is only allowed in the main config file`)
+	assert.Equal(t, 4, problems[1].Line)
+	assert.Contains(t, problems[1].Msg, "duplicate image \"php:8.2.30-fpm\" (first defined at "+main+":7)")
+	assert.Equal(t, 7, problems[2].Line)
+	assert.Contains(t, problems[2].Msg, "notifier \"ops\" is already defined in "+main+":10")
+
+	assert.Equal(t, main, problems[3].File)
+	assert.Contains(t, problems[3].Msg, `include "missing.yaml": no such file`)
+	assert.Contains(t, problems[4].Msg, "is already loaded")
+}
+
+func TestLoad_ImageMatrixProblems(t *testing.T) {
+	path := writeConfig(t, `
+images:
+  - ref: php:{version}-{variant}-alpine
+    matrix:
+      version: [8.2, 8.3]
+      variant: [fpm, cli]
+    labels:
+      php: "{version}"
+    notifiers: [ops]
+  - ref: nginx:{1.25,1.26}-alpine
+  - ref: php:{8.3,8.4}-fpm-alpine
+notifiers:
+  ops:
+    type: stdout
+`)
+
+	_, err := Load(path)
+	problems := problemsOf(t, err)
+	require.Len(t, problems, 1)
+	assert.Equal(t, 11, problems[0].Line)
+	assert.Contains(t, problems[0].Msg, `duplicate image "php:8.3-fpm-alpine" (first defined at line 3)`)
+
+	path = writeConfig(t, `
+images:
+  - ref: php:{version}-{variant}-alpine
+    matrix:
+      version: [8.2, 8.3]
+      variant: [fpm, cli]
+    labels:
+      php: "{version}"
+    notifiers: [ops]
+  - ref: nginx:{1.25,1.26}-alpine
+  - ref: redis:{version}
+notifiers:
+  ops:
+    type: stdout
+`)
+	_, err = Load(path)
+	problems = problemsOf(t, err)
+	require.Len(t, problems, 1)
+	assert.Equal(t, 11, problems[0].Line)
+	assert.Contains(t, problems[0].Msg, `matrix variable "version" is not defined`)
+}
+
+func TestLoad_ImageMatrixExpanded(t *testing.T) {
+	path := writeConfig(t, `
+images:
+  - ref: php:{version}-{variant}-alpine
+    matrix:
+      version: [8.2, 8.3]
+      variant: [fpm, cli]
+    labels:
+      php: "{version}"
+    notifiers: [ops]
+  - ref: nginx:{1.25,1.26}-alpine
+notifiers:
+  ops:
+    type: stdout
+`)
+
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	require.Len(t, cfg.Images, 6)
+	assert.Equal(t, "php:8.2-fpm-alpine", cfg.Images[0].Ref)
+	assert.Equal(t, "8.2", cfg.Images[0].Labels["php"])
+	assert.Equal(t, []string{"ops"}, cfg.Images[3].Notifiers)
+	assert.Equal(t, "8.3", cfg.Images[3].Labels["php"])
+	assert.Equal(t, "nginx:1.26-alpine", cfg.Images[5].Ref)
+	assert.Empty(t, cfg.Images[5].Notifiers)
+}
+
+func TestLoad_WebhooksSecretRequired(t *testing.T) {
+	problems := problemsOf(t, loadErr(writeConfig(t, "webhooks:\n  secret: \"\"\n")))
+	require.Len(t, problems, 1)
+	assert.Contains(t, problems[0].Msg, "webhooks.secret is required")
+
+	cfg, err := Load(writeConfig(t, "webhooks:\n  secret: s3cr3t\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "s3cr3t", cfg.Webhooks.Secret)
+}
+
+func TestLoad_Log(t *testing.T) {
+	cfg, err := Load(writeConfig(t, "log:\n  level: debug\n  format: json\n"))
+	require.NoError(t, err)
+	assert.Equal(t, LogConfig{Level: "debug", Format: "json"}, cfg.Log)
+
+	problems := problemsOf(t, loadErr(writeConfig(t, "log:\n  level: loud\n  format: xml\n")))
+	require.Len(t, problems, 2)
+	assert.Equal(t, 2, problems[0].Line)
+	assert.Contains(t, problems[0].Msg, "log.level")
+	assert.Equal(t, 3, problems[1].Line)
+	assert.Contains(t, problems[1].Msg, "log.format")
+}
+
+func TestLoad_Tracing(t *testing.T) {
+	cfg, err := Load(writeConfig(t, "tracing:\n  endpoint: http://localhost:4318\n"))
+	require.NoError(t, err)
+	assert.Equal(t, &TracingConfig{Endpoint: "http://localhost:4318", ServiceName: "registry-ping"}, cfg.Tracing)
+
+	cfg, err = Load(writeConfig(t, "tracing:\n  file: t.jsonl\n  propagate: true\n"))
+	require.NoError(t, err)
+	assert.True(t, cfg.Tracing.Propagate)
+
+	for _, body := range []string{"tracing: {}\n", "tracing:\n  endpoint: http://x\n  file: t.jsonl\n"} {
+		problems := problemsOf(t, loadErr(writeConfig(t, body)))
+		require.Len(t, problems, 1, body)
+		assert.Contains(t, problems[0].Msg, "exactly one of endpoint and file")
+	}
+}
+
+func TestLoad_Registries(t *testing.T) {
+	cfg, err := Load(writeConfig(t, `
+http_timeout: 5s
+registries:
+  docker.io:
+    proxy: http://proxy.corp:3128
+  registry.internal:5000:
+    ca_file: /etc/ssl/internal-ca.pem
+    cert_file: /etc/ssl/client.pem
+    key_file: /etc/ssl/client-key.pem
+    timeout: 30s
+  lab.local:
+    insecure_skip_verify: true
+    proxy: direct
+  quay.corp.example:
+    type: quay
+    url: https://quay-api.corp.example
+    username: org+ping
+    password: robot-token
+  harbor.corp.example:
+    type: harbor
+    scan_overview: true
+`))
+	require.NoError(t, err)
+	assert.Equal(t, RegistryConfig{Proxy: "http://proxy.corp:3128", Timeout: Duration(5 * time.Second)}, cfg.Registries["docker.io"])
+	assert.Equal(t, RegistryConfig{
+		CAFile:   "/etc/ssl/internal-ca.pem",
+		CertFile: "/etc/ssl/client.pem",
+		KeyFile:  "/etc/ssl/client-key.pem",
+		Timeout:  Duration(30 * time.Second),
+	}, cfg.Registries["registry.internal:5000"])
+	assert.True(t, cfg.Registries["lab.local"].InsecureSkipVerify)
+	assert.Equal(t, RegistryConfig{
+		Type:     "quay",
+		URL:      "https://quay-api.corp.example",
+		Username: "org+ping",
+		Password: "robot-token",
+		Timeout:  Duration(5 * time.Second),
+	}, cfg.Registries["quay.corp.example"])
+	assert.True(t, cfg.Registries["harbor.corp.example"].ScanOverview)
+}
+
+func TestLoad_RegistriesProblems(t *testing.T) {
+	problems := problemsOf(t, loadErr(writeConfig(t, `registries:
+  docker.io:
+    proxy: proxy.corp
+  registry.internal:
+    cert_file: /etc/ssl/client.pem
+    timeout: -1s
+  quay.corp.example:
+    type: quay-enterprise
+    url: quay.corp.example
+`)))
+	require.Len(t, problems, 5)
+	assert.Contains(t, problems[0].Msg, `proxy must be a URL or "direct"`)
+	assert.Equal(t, 3, problems[0].Line)
+	assert.Contains(t, problems[1].Msg, "cert_file and key_file must be set together")
+	assert.Contains(t, problems[2].Msg, "timeout must not be negative")
+	assert.Equal(t, 6, problems[2].Line)
+	assert.Contains(t, problems[3].Msg, `unknown type "quay-enterprise"`)
+	assert.Contains(t, problems[4].Msg, "url must be an http(s) URL")
+}
+
+func TestLoad_Mirrors(t *testing.T) {
+	cfg, err := Load(writeConfig(t, `
+mirrors:
+  docker.io:
+    endpoints:
+      - url: https://mirror.gcr.io
+      - url: https://harbor.internal
+        prefix: dockerhub-proxy
+        username: robot$ping
+        password: secret
+  ghcr.io:
+    mode: first
+    endpoints:
+      - url: http://cache.internal:5000
+`))
+	require.NoError(t, err)
+	assert.Equal(t, MirrorConfig{
+		Mode: "fallback",
+		Endpoints: []MirrorEndpoint{
+			{URL: "https://mirror.gcr.io"},
+			{URL: "https://harbor.internal", Prefix: "dockerhub-proxy", Username: "robot$ping", Password: "secret"},
+		},
+	}, cfg.Mirrors["docker.io"])
+	assert.Equal(t, "first", cfg.Mirrors["ghcr.io"].Mode)
+}
+
+func TestLoad_MirrorsProblems(t *testing.T) {
+	problems := problemsOf(t, loadErr(writeConfig(t, `mirrors:
+  docker.io:
+    mode: always
+    endpoints:
+      - url: mirror.gcr.io
+  ghcr.io: {}
+`)))
+	require.Len(t, problems, 3)
+	assert.Contains(t, problems[0].Msg, "mode must be fallback or first")
+	assert.Equal(t, 3, problems[0].Line)
+	assert.Contains(t, problems[1].Msg, "endpoints[0]: url must be an http(s) URL")
+	assert.Equal(t, 5, problems[1].Line)
+	assert.Contains(t, problems[2].Msg, `mirrors for "ghcr.io": endpoints are required`)
+}
+
+func TestLoad_Plugins(t *testing.T) {
+	cfg, err := Load(writeConfig(t, `
+http_timeout: 5s
+plugins:
+  - name: artifactory
+    command: [/usr/local/bin/rp-artifactory, --insecure]
+    hosts: ["*.artifacts.corp.example"]
+    env:
+      ARTIFACTORY_TOKEN: secret
+  - name: blobs
+    command: [rp-blobs]
+    hosts: [blobs.corp.example]
+    timeout: 1m
+`))
+	require.NoError(t, err)
+	require.Len(t, cfg.Plugins, 2)
+	assert.Equal(t, PluginConfig{
+		Name:    "artifactory",
+		Command: []string{"/usr/local/bin/rp-artifactory", "--insecure"},
+		Hosts:   []string{"*.artifacts.corp.example"},
+		Env:     map[string]string{"ARTIFACTORY_TOKEN": "secret"},
+		Timeout: Duration(5 * time.Second),
+	}, cfg.Plugins[0])
+	assert.Equal(t, Duration(time.Minute), cfg.Plugins[1].Timeout)
+}
+
+func TestLoad_PluginsProblems(t *testing.T) {
+	problems := problemsOf(t, loadErr(writeConfig(t, `plugins:
+  - name: a
+    command: [rp-a]
+    hosts: ["[corp"]
+  - name: a
+  - command: [rp-c]
+    hosts: [c.example]
+`)))
+	require.Len(t, problems, 5)
+	assert.Contains(t, problems[0].Msg, `plugins[0]: invalid host pattern "[corp"`)
+	assert.Equal(t, 4, problems[0].Line)
+	assert.Contains(t, problems[1].Msg, "plugins[1]: command is required")
+	assert.Contains(t, problems[2].Msg, "plugins[1]: hosts are required")
+	assert.Contains(t, problems[3].Msg, `plugin "a" is already defined`)
+	assert.Contains(t, problems[4].Msg, "plugins[2]: name is required")
+}
+
+func TestLoad_Charts(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"config.yaml": `
+include: [charts.yaml]
+charts:
+  - ref: oci://ghcr.io/org/charts/app
+    notifiers: [ops]
+notifiers:
+  ops:
+    type: stdout
+`,
+		"charts.yaml": "charts:\n  - ref: https://charts.bitnami.com/bitnami/nginx\n",
+	})
+
+	cfg, err := Load(filepath.Join(dir, "config.yaml"))
+	require.NoError(t, err)
+	require.Len(t, cfg.Charts, 2)
+	assert.Equal(t, "oci://ghcr.io/org/charts/app", cfg.Charts[0].Ref)
+	assert.Equal(t, []string{"ops"}, cfg.Charts[0].Notifiers)
+	assert.Equal(t, "https://charts.bitnami.com/bitnami/nginx", cfg.Charts[1].Ref)
+	assert.Equal(t, filepath.Join(dir, "charts.yaml"), cfg.Charts[1].Source)
+}
+
+func TestLoad_ChartsProblems(t *testing.T) {
+	problems := problemsOf(t, loadErr(writeConfig(t, `charts:
+  - ref: ghcr.io/org/charts/app
+  - ref: oci://ghcr.io/org/charts/app
+    notifiers: [missing]
+  - ref: oci://ghcr.io/org/charts/app/
+  - labels: {team: a}
+`)))
+	require.Len(t, problems, 4)
+	assert.Contains(t, problems[0].Msg, "scheme must be oci, http or https")
+	assert.Equal(t, 2, problems[0].Line)
+	assert.Contains(t, problems[1].Msg, `chart "oci://ghcr.io/org/charts/app": unknown notifier "missing"`)
+	assert.Contains(t, problems[2].Msg, `duplicate chart "oci://ghcr.io/org/charts/app" (first defined at line 3)`)
+	assert.Contains(t, problems[3].Msg, "charts[3]: ref is required")
+}
@@ -0,0 +1,132 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// varPattern matches $$ (an escaped dollar) and ${NAME} / ${NAME:-default}.
+var varPattern = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// interpolator resolves environment variables and secret references in the
+// scalar values of a parsed config document:
+//
+//   - ${NAME} is replaced by the environment variable NAME, which must be set.
+//   - ${NAME:-default} uses default if NAME is unset or empty.
+//   - $$ is a literal $.
+//   - A value of the form "env:NAME" is replaced by the variable NAME, and
+//     "file:PATH" by the contents of PATH (relative to the config file, with
+//     one trailing newline removed). Image refs are exempt, since "env:1.0"
+//     is a valid image.
+//
+// Every unresolved reference is collected as a Problem, and the value is
+// left as written so that the rest of the document can still be checked.
+type interpolator struct {
+	file     string
+	baseDir  string
+	lookup   func(string) (string, bool)
+	problems []Problem
+}
+
+func newInterpolator(file string) *interpolator {
+	return &interpolator{
+		file:    file,
+		baseDir: filepath.Dir(file),
+		lookup:  os.LookupEnv,
+	}
+}
+
+func (in *interpolator) walk(node *yaml.Node, key string) {
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, child := range node.Content {
+			in.walk(child, key)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			in.walk(node.Content[i+1], node.Content[i].Value)
+		}
+	case yaml.ScalarNode:
+		in.scalar(node, key)
+	}
+}
+
+func (in *interpolator) scalar(node *yaml.Node, key string) {
+	value, ok := in.resolveSecret(node, key)
+	if !ok {
+		value = in.expand(node)
+	}
+	if value == node.Value {
+		return
+	}
+	node.Value = value
+	if node.Style == 0 {
+		// Let plain scalars be re-resolved, so "${PORT}" can decode into an int.
+		node.Tag = ""
+	}
+}
+
+func (in *interpolator) resolveSecret(node *yaml.Node, key string) (string, bool) {
+	if key == "ref" || node.Tag != "!!str" {
+		return "", false
+	}
+	switch {
+	case strings.HasPrefix(node.Value, "env:"):
+		name := strings.TrimPrefix(node.Value, "env:")
+		v, ok := in.lookup(name)
+		if !ok {
+			in.problem(node, fmt.Sprintf("env:%s: environment variable not set", name))
+			return node.Value, true
+		}
+		return v, true
+	case strings.HasPrefix(node.Value, "file:"):
+		path := strings.TrimPrefix(node.Value, "file:")
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(in.baseDir, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			in.problem(node, fmt.Sprintf("file:%s: %v", strings.TrimPrefix(node.Value, "file:"), err))
+			return node.Value, true
+		}
+		s := strings.TrimSuffix(string(data), "\n")
+		return strings.TrimSuffix(s, "\r"), true
+	}
+	return "", false
+}
+
+func (in *interpolator) expand(node *yaml.Node) string {
+	if !strings.Contains(node.Value, "$") {
+		return node.Value
+	}
+	return varPattern.ReplaceAllStringFunc(node.Value, func(match string) string {
+		if match == "$$" {
+			return "$"
+		}
+		m := varPattern.FindStringSubmatch(match)
+		name, hasDefault, def := m[1], m[2] != "", m[3]
+		v, ok := in.lookup(name)
+		switch {
+		case ok && (v != "" || !hasDefault):
+			return v
+		case hasDefault:
+			return def
+		}
+		in.problem(node, fmt.Sprintf("${%s}: environment variable not set", name))
+		return match
+	})
+}
+
+func (in *interpolator) problem(node *yaml.Node, msg string) {
+	in.problems = append(in.problems, Problem{
+		File:   in.file,
+		Line:   node.Line,
+		Column: node.Column,
+		Msg:    msg,
+	})
+}
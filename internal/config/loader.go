@@ -0,0 +1,257 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// includeKeys are the only top-level keys allowed in included files; all
+// other settings belong to the main config file.
+var includeKeys = map[string]bool{"include": true, "images": true, "charts": true, "notifiers": true}
+
+// sourceFile is a single parsed config file.
+type sourceFile struct {
+	path string
+	root *yaml.Node // top-level mapping; an empty node for an empty file
+	cfg  Config
+}
+
+// find returns the node at path, where each element is a mapping key
+// (string) or sequence index (int). If the path does not exist, the deepest
+// existing node is returned so problems still point near their cause.
+func (f *sourceFile) find(path ...any) *yaml.Node {
+	node := f.root
+	for _, p := range path {
+		var next *yaml.Node
+		switch p := p.(type) {
+		case string:
+			if node.Kind == yaml.MappingNode {
+				for i := 0; i+1 < len(node.Content); i += 2 {
+					if node.Content[i].Value == p {
+						next = node.Content[i+1]
+						break
+					}
+				}
+			}
+		case int:
+			if node.Kind == yaml.SequenceNode && p < len(node.Content) {
+				next = node.Content[p]
+			}
+		}
+		if next == nil {
+			return node
+		}
+		node = next
+	}
+	return node
+}
+
+// loader reads a config file and, depth-first, every file it includes.
+// Files are kept in load order, which defines the order of merged images.
+type loader struct {
+	files    []*sourceFile
+	seen     map[string]bool // absolute paths of loaded files
+	problems []Problem
+	// unresolved holds the positions of values with unresolved references.
+	// Further problems there follow from the reference and are dropped.
+	unresolved map[Problem]bool
+}
+
+func newLoader() *loader {
+	return &loader{seen: make(map[string]bool), unresolved: make(map[Problem]bool)}
+}
+
+// followUps removes the problems of values with an unresolved reference
+// from problems.
+func (l *loader) followUps(problems []Problem) []Problem {
+	return slices.DeleteFunc(problems, func(p Problem) bool {
+		return l.unresolved[Problem{File: p.File, Line: p.Line, Column: p.Column}]
+	})
+}
+
+func (l *loader) errorf(f *sourceFile, node *yaml.Node, format string, args ...any) {
+	l.problems = append(l.problems, l.followUps([]Problem{{
+		File:   f.path,
+		Line:   node.Line,
+		Column: node.Column,
+		Msg:    fmt.Sprintf(format, args...),
+	}})...)
+}
+
+// load reads path and its includes. Problems are collected in l; the
+// returned error is reserved for unreadable or syntactically invalid files.
+func (l *loader) load(path string, main bool) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("config: resolve %s: %w", path, err)
+	}
+	l.seen[abs] = true
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: read %s: %w", path, err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("config: parse %s: %w", path, err)
+	}
+
+	f := &sourceFile{path: path, root: &doc}
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 {
+		f.root = doc.Content[0]
+	}
+	l.files = append(l.files, f)
+
+	// Unresolved references are reported along with every other problem of
+	// the document and its includes.
+	in := newInterpolator(path)
+	in.walk(&doc, "")
+	l.problems = append(l.problems, in.problems...)
+	for _, p := range in.problems {
+		l.unresolved[Problem{File: p.File, Line: p.Line, Column: p.Column}] = true
+	}
+
+	if doc.Kind == 0 {
+		return nil
+	}
+	problems := checkSchema(path, &doc, reflect.TypeFor[Config]())
+	if err := doc.Decode(&f.cfg); err != nil {
+		// Only values the schema check already reported can fail to
+		// decode; the decoder still fills in all other fields.
+		var typeErr *yaml.TypeError
+		if len(problems) == 0 || !errors.As(err, &typeErr) {
+			return fmt.Errorf("config: parse %s: %w", path, err)
+		}
+	}
+	l.problems = append(l.problems, l.followUps(problems)...)
+
+	if !main && f.root.Kind == yaml.MappingNode {
+		for i := 0; i < len(f.root.Content); i += 2 {
+			if key := f.root.Content[i]; !includeKeys[key.Value] {
+				l.errorf(f, key, "%q is only allowed in the main config file", key.Value)
+			}
+		}
+	}
+
+	return l.includes(f)
+}
+
+// includes loads the files matched by f's include patterns. Patterns are
+// relative to f's directory and may be globs; the matches of a glob are
+// loaded in lexical order. A glob matching nothing is not an error, so an
+// empty conf.d directory is fine.
+func (l *loader) includes(f *sourceFile) error {
+	dir := filepath.Dir(f.path)
+	for i, pattern := range f.cfg.Include {
+		node := f.find("include", i)
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			l.errorf(f, node, "include %q: %v", f.cfg.Include[i], err)
+			continue
+		}
+		if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			l.errorf(f, node, "include %q: no such file", f.cfg.Include[i])
+			continue
+		}
+		sort.Strings(matches)
+
+		for _, match := range matches {
+			abs, err := filepath.Abs(match)
+			if err != nil {
+				return fmt.Errorf("config: resolve %s: %w", match, err)
+			}
+			if l.seen[abs] {
+				l.errorf(f, node, "include %q: %s is already loaded", f.cfg.Include[i], match)
+				continue
+			}
+			if err := l.load(match, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// imageOrigin locates a merged image or chart entry in its source file.
+type imageOrigin struct {
+	file  *sourceFile
+	index int
+}
+
+// merged is the combination of all loaded files with the origin of every
+// image and notifier, used to position validation problems.
+type merged struct {
+	cfg       Config
+	images    []imageOrigin // parallel to cfg.Images
+	charts    []imageOrigin // parallel to cfg.Charts
+	notifiers map[string]*sourceFile
+}
+
+// merge combines the loaded files. Settings come from the main file; image
+// templates are expanded and concatenated in load order, as are charts, and
+// notifiers are united by name, with a name defined in more than one file
+// reported as a problem.
+func (l *loader) merge() *merged {
+	main := l.files[0]
+	m := &merged{
+		cfg:       main.cfg,
+		notifiers: make(map[string]*sourceFile),
+	}
+	m.cfg.Include = nil
+	m.cfg.Images = nil
+	m.cfg.Charts = nil
+	m.cfg.Notifiers = nil
+
+	for _, f := range l.files {
+		for i, tmpl := range f.cfg.Images {
+			entries, err := expandEntry(tmpl)
+			if err != nil {
+				l.errorf(f, f.find("images", i, "ref"), "%v", err)
+				continue
+			}
+			for _, entry := range entries {
+				entry.Source = f.path
+				m.cfg.Images = append(m.cfg.Images, entry)
+				m.images = append(m.images, imageOrigin{file: f, index: i})
+			}
+		}
+
+		for i, entry := range f.cfg.Charts {
+			entry.Source = f.path
+			m.cfg.Charts = append(m.cfg.Charts, entry)
+			m.charts = append(m.charts, imageOrigin{file: f, index: i})
+		}
+
+		names := make([]string, 0, len(f.cfg.Notifiers))
+		for name := range f.cfg.Notifiers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if first, ok := m.notifiers[name]; ok {
+				l.errorf(f, f.find("notifiers", name), "notifier %q is already defined in %s:%d",
+					name, first.path, first.find("notifiers", name).Line)
+				continue
+			}
+			if m.cfg.Notifiers == nil {
+				m.cfg.Notifiers = make(map[string]NotifierConfig)
+			}
+			m.cfg.Notifiers[name] = f.cfg.Notifiers[name]
+			m.notifiers[name] = f
+		}
+	}
+	return m
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// placeholderPattern matches {a,b,c} alternatives and {name} matrix variables.
+var placeholderPattern = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// dimension is one axis of an image template: either the alternatives of a
+// {a,b} group or the values of a named matrix variable.
+type dimension struct {
+	name   string // matrix variable; "" for an inline {a,b} group
+	values []string
+}
+
+// expandEntry expands an image template into concrete entries. The ref may
+// contain inline alternatives ("php:{8.2,8.3}-fpm") and {name} variables
+// bound by entry.Matrix ("php:{version}-{variant}"). Every combination yields
+// one entry that inherits the template's options; {name} variables are also
+// substituted in label values. An entry without placeholders is returned
+// unchanged.
+func expandEntry(entry ImageEntry) ([]ImageEntry, error) {
+	matches := placeholderPattern.FindAllStringSubmatchIndex(entry.Ref, -1)
+	if len(matches) == 0 {
+		if len(entry.Matrix) > 0 {
+			return nil, fmt.Errorf("matrix is set but ref %q has no {variables}", entry.Ref)
+		}
+		return []ImageEntry{entry}, nil
+	}
+
+	// Build one dimension per inline group and per distinct variable, in
+	// order of first appearance; slots maps each match to its dimension.
+	var dims []dimension
+	slots := make([]int, len(matches))
+	byName := make(map[string]int)
+	for i, m := range matches {
+		body := entry.Ref[m[2]:m[3]]
+		if strings.Contains(body, ",") {
+			values := strings.Split(body, ",")
+			if slices.Contains(values, "") {
+				return nil, fmt.Errorf("ref %q: empty alternative in {%s}", entry.Ref, body)
+			}
+			slots[i] = len(dims)
+			dims = append(dims, dimension{values: values})
+			continue
+		}
+		if d, ok := byName[body]; ok {
+			slots[i] = d
+			continue
+		}
+		values, ok := entry.Matrix[body]
+		if !ok {
+			return nil, fmt.Errorf("ref %q: matrix variable %q is not defined", entry.Ref, body)
+		}
+		if len(values) == 0 {
+			return nil, fmt.Errorf("matrix variable %q has no values", body)
+		}
+		byName[body] = len(dims)
+		slots[i] = len(dims)
+		dims = append(dims, dimension{name: body, values: values})
+	}
+	for _, name := range slices.Sorted(maps.Keys(entry.Matrix)) {
+		if _, ok := byName[name]; !ok {
+			return nil, fmt.Errorf("matrix variable %q is not used in ref %q", name, entry.Ref)
+		}
+	}
+
+	var out []ImageEntry
+	choice := make([]int, len(dims))
+	for {
+		out = append(out, instantiate(entry, matches, slots, dims, choice))
+
+		// Advance the rightmost dimension first, like nested loops.
+		i := len(dims) - 1
+		for ; i >= 0; i-- {
+			choice[i]++
+			if choice[i] < len(dims[i].values) {
+				break
+			}
+			choice[i] = 0
+		}
+		if i < 0 {
+			return out, nil
+		}
+	}
+}
+
+func instantiate(tmpl ImageEntry, matches [][]int, slots []int, dims []dimension, choice []int) ImageEntry {
+	var b strings.Builder
+	last := 0
+	for i, m := range matches {
+		d := slots[i]
+		b.WriteString(tmpl.Ref[last:m[0]])
+		b.WriteString(dims[d].values[choice[d]])
+		last = m[1]
+	}
+	b.WriteString(tmpl.Ref[last:])
+
+	e := tmpl
+	e.Ref = b.String()
+	e.Matrix = nil
+	e.Notifiers = slices.Clone(tmpl.Notifiers)
+	e.Platforms = slices.Clone(tmpl.Platforms)
+	if tmpl.Labels != nil {
+		e.Labels = make(map[string]string, len(tmpl.Labels))
+		for k, v := range tmpl.Labels {
+			for d, dim := range dims {
+				if dim.name != "" {
+					v = strings.ReplaceAll(v, "{"+dim.name+"}", dim.values[choice[d]])
+				}
+			}
+			e.Labels[k] = v
+		}
+	}
+	return e
+}
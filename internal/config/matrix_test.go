@@ -0,0 +1,83 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func refsOf(entries []ImageEntry) []string {
+	refs := make([]string, len(entries))
+	for i, e := range entries {
+		refs[i] = e.Ref
+	}
+	return refs
+}
+
+func TestExpandEntry_Plain(t *testing.T) {
+	entry := ImageEntry{Ref: "php:8.2.30-fpm", Notifiers: []string{"ops"}}
+
+	got, err := expandEntry(entry)
+	require.NoError(t, err)
+	assert.Equal(t, []ImageEntry{entry}, got)
+}
+
+func TestExpandEntry_InlineAlternatives(t *testing.T) {
+	got, err := expandEntry(ImageEntry{
+		Ref:       "php:{8.1,8.2,8.3}-{fpm,cli}-alpine",
+		Platforms: []string{"linux/amd64"},
+		Notifiers: []string{"ops"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"php:8.1-fpm-alpine", "php:8.1-cli-alpine",
+		"php:8.2-fpm-alpine", "php:8.2-cli-alpine",
+		"php:8.3-fpm-alpine", "php:8.3-cli-alpine",
+	}, refsOf(got))
+	for _, e := range got {
+		assert.Equal(t, []string{"linux/amd64"}, e.Platforms)
+		assert.Equal(t, []string{"ops"}, e.Notifiers)
+	}
+
+	got[0].Platforms[0] = "linux/arm64"
+	got[0].Notifiers[0] = "dev"
+	assert.Equal(t, []string{"linux/amd64"}, got[1].Platforms, "each entry has its own copy")
+	assert.Equal(t, []string{"ops"}, got[1].Notifiers, "each entry has its own copy")
+}
+
+func TestExpandEntry_NamedMatrix(t *testing.T) {
+	got, err := expandEntry(ImageEntry{
+		Ref: "ghcr.io/org/{variant}:{version}-{variant}",
+		Matrix: map[string][]string{
+			"version": {"1.0", "2.0"},
+			"variant": {"slim", "full"},
+		},
+		Labels: map[string]string{"team": "web", "track": "v{version}"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"ghcr.io/org/slim:1.0-slim", "ghcr.io/org/slim:2.0-slim",
+		"ghcr.io/org/full:1.0-full", "ghcr.io/org/full:2.0-full",
+	}, refsOf(got))
+	assert.Equal(t, map[string]string{"team": "web", "track": "v2.0"}, got[1].Labels)
+	assert.Nil(t, got[0].Matrix)
+}
+
+func TestExpandEntry_Errors(t *testing.T) {
+	tests := map[string]ImageEntry{
+		"undefined variable": {Ref: "php:{version}"},
+		"unused variable":    {Ref: "php:{version}", Matrix: map[string][]string{"version": {"8"}, "os": {"alpine"}}},
+		"matrix without ref": {Ref: "php:8", Matrix: map[string][]string{"version": {"8"}}},
+		"empty alternative":  {Ref: "php:{8.2,}-fpm"},
+		"no values":          {Ref: "php:{version}", Matrix: map[string][]string{"version": {}}},
+	}
+	for name, entry := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := expandEntry(entry)
+			require.Error(t, err)
+		})
+	}
+}
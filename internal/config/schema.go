@@ -0,0 +1,154 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var unmarshalerType = reflect.TypeFor[yaml.Unmarshaler]()
+
+// yamlErrPrefix matches the position prefix yaml.v3 puts on decode errors;
+// the position is reported by the Problem itself.
+var yamlErrPrefix = regexp.MustCompile(`^(yaml: unmarshal errors:\s*)?(line \d+: )?`)
+
+// checkSchema reports every key that does not correspond to a field of t and
+// every value that cannot be decoded into its field's type. Decoding the
+// whole document afterwards is then guaranteed to succeed.
+//
+// yaml.Decoder.KnownFields cannot do this: the document is decoded from its
+// node tree after interpolation, and Node.Decode has no such option.
+// Decoding re-encoded text instead would report lines of that text rather
+// than of the file, and its errors carry neither a column nor the YAML key
+// path, only Go type names.
+func checkSchema(file string, node *yaml.Node, t reflect.Type) []Problem {
+	var problems []Problem
+	var walk func(node *yaml.Node, t reflect.Type)
+	report := func(node *yaml.Node, format string, args ...any) {
+		problems = append(problems, Problem{
+			File:   file,
+			Line:   node.Line,
+			Column: node.Column,
+			Msg:    fmt.Sprintf(format, args...),
+		})
+	}
+
+	walk = func(node *yaml.Node, t reflect.Type) {
+		if node.Kind == yaml.DocumentNode {
+			for _, child := range node.Content {
+				walk(child, t)
+			}
+			return
+		}
+		if node.Kind == yaml.AliasNode {
+			node = node.Alias
+		}
+		if node.Kind == yaml.ScalarNode && node.ShortTag() == "!!null" {
+			return
+		}
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+
+		if reflect.PointerTo(t).Implements(unmarshalerType) {
+			decodeLeaf(node, t, report)
+			return
+		}
+
+		switch t.Kind() {
+		case reflect.Struct:
+			if node.Kind != yaml.MappingNode {
+				report(node, "expected a mapping, got %s", kindName(node))
+				return
+			}
+			fields := yamlFields(t)
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				key, value := node.Content[i], node.Content[i+1]
+				field, ok := fields[key.Value]
+				if !ok {
+					report(key, "unknown field %q%s", key.Value, suggest(key.Value, fields))
+					continue
+				}
+				walk(value, field.Type)
+			}
+		case reflect.Map:
+			if node.Kind != yaml.MappingNode {
+				report(node, "expected a mapping, got %s", kindName(node))
+				return
+			}
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				walk(node.Content[i+1], t.Elem())
+			}
+		case reflect.Slice:
+			if node.Kind != yaml.SequenceNode {
+				report(node, "expected a list, got %s", kindName(node))
+				return
+			}
+			for _, item := range node.Content {
+				walk(item, t.Elem())
+			}
+		default:
+			decodeLeaf(node, t, report)
+		}
+	}
+
+	walk(node, t)
+	return problems
+}
+
+func decodeLeaf(node *yaml.Node, t reflect.Type, report func(*yaml.Node, string, ...any)) {
+	if err := node.Decode(reflect.New(t).Interface()); err != nil {
+		report(node, "%s", yamlErrPrefix.ReplaceAllString(err.Error(), ""))
+	}
+}
+
+// yamlFields maps the yaml key of every field of struct type t to the field.
+func yamlFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField, t.NumField())
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f
+	}
+	return fields
+}
+
+// suggest returns a "did you mean" hint for a key that is a prefix or
+// extension of a known field, such as "image" for "images".
+func suggest(key string, fields map[string]reflect.StructField) string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if strings.HasPrefix(name, key) || strings.HasPrefix(key, name) {
+			return fmt.Sprintf(" (did you mean %q?)", name)
+		}
+	}
+	return ""
+}
+
+func kindName(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "a mapping"
+	case yaml.SequenceNode:
+		return "a list"
+	default:
+		return fmt.Sprintf("%q", node.Value)
+	}
+}
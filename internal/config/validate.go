@@ -0,0 +1,233 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/wutscho/registry-ping/internal/helm"
+	"github.com/wutscho/registry-ping/internal/registry"
+)
+
+// validator checks a merged Config for semantic problems, locating each one
+// in the YAML node tree of the file it came from.
+type validator struct {
+	problems []Problem
+}
+
+func (v *validator) errorf(f *sourceFile, node *yaml.Node, format string, args ...any) {
+	v.problems = append(v.problems, Problem{
+		File:   f.path,
+		Line:   node.Line,
+		Column: node.Column,
+		Msg:    fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *validator) validate(m *merged, main *sourceFile) {
+	cfg := &m.cfg
+	if cfg.Timeout < 0 {
+		v.errorf(main, main.find("timeout"), "timeout must not be negative")
+	}
+	if cfg.HTTPTimeout < 0 {
+		v.errorf(main, main.find("http_timeout"), "http_timeout must not be negative")
+	}
+
+	switch strings.ToLower(cfg.Log.Level) {
+	case "", "debug", "info", "warn", "error":
+	default:
+		v.errorf(main, main.find("log", "level"), "log.level must be debug, info, warn or error, got %q", cfg.Log.Level)
+	}
+	switch cfg.Log.Format {
+	case "", "text", "json":
+	default:
+		v.errorf(main, main.find("log", "format"), "log.format must be text or json, got %q", cfg.Log.Format)
+	}
+
+	hosts := make([]string, 0, len(cfg.Registries))
+	for host := range cfg.Registries {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		r := cfg.Registries[host]
+		if host == "" || strings.ContainsAny(host, "/ ") {
+			v.errorf(main, main.find("registries", host), "registries: invalid host %q", host)
+		}
+		switch r.Type {
+		case "", "quay", "gitlab", "harbor", "ecr", "google", "acr":
+		default:
+			v.errorf(main, main.find("registries", host, "type"), "registry %q: unknown type %q", host, r.Type)
+		}
+		if r.URL != "" {
+			if u, err := url.Parse(r.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				v.errorf(main, main.find("registries", host, "url"), "registry %q: url must be an http(s) URL, got %q", host, r.URL)
+			}
+		}
+		if r.Timeout < 0 {
+			v.errorf(main, main.find("registries", host, "timeout"), "registry %q: timeout must not be negative", host)
+		}
+		if r.Proxy != "" && r.Proxy != "direct" {
+			if u, err := url.Parse(r.Proxy); err != nil || u.Scheme == "" || u.Host == "" {
+				v.errorf(main, main.find("registries", host, "proxy"), "registry %q: proxy must be a URL or \"direct\", got %q", host, r.Proxy)
+			}
+		}
+		if (r.CertFile == "") != (r.KeyFile == "") {
+			v.errorf(main, main.find("registries", host), "registry %q: cert_file and key_file must be set together", host)
+		}
+	}
+
+	upstreams := make([]string, 0, len(cfg.Mirrors))
+	for host := range cfg.Mirrors {
+		upstreams = append(upstreams, host)
+	}
+	sort.Strings(upstreams)
+	for _, host := range upstreams {
+		mc := cfg.Mirrors[host]
+		if host == "" || strings.ContainsAny(host, "/ ") {
+			v.errorf(main, main.find("mirrors", host), "mirrors: invalid host %q", host)
+		}
+		switch mc.Mode {
+		case "", "fallback", "first":
+		default:
+			v.errorf(main, main.find("mirrors", host, "mode"), "mirrors for %q: mode must be fallback or first, got %q", host, mc.Mode)
+		}
+		if len(mc.Endpoints) == 0 {
+			v.errorf(main, main.find("mirrors", host), "mirrors for %q: endpoints are required", host)
+		}
+		for i, e := range mc.Endpoints {
+			if u, err := url.Parse(e.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				v.errorf(main, main.find("mirrors", host, "endpoints", i), "mirrors for %q: endpoints[%d]: url must be an http(s) URL, got %q", host, i, e.URL)
+			}
+		}
+	}
+
+	pluginNames := make(map[string]bool, len(cfg.Plugins))
+	for i, p := range cfg.Plugins {
+		switch {
+		case p.Name == "":
+			v.errorf(main, main.find("plugins", i), "plugins[%d]: name is required", i)
+		case pluginNames[p.Name]:
+			v.errorf(main, main.find("plugins", i, "name"), "plugin %q is already defined", p.Name)
+		}
+		pluginNames[p.Name] = true
+		if len(p.Command) == 0 || p.Command[0] == "" {
+			v.errorf(main, main.find("plugins", i), "plugins[%d]: command is required", i)
+		}
+		if len(p.Hosts) == 0 {
+			v.errorf(main, main.find("plugins", i), "plugins[%d]: hosts are required", i)
+		}
+		for j, pattern := range p.Hosts {
+			if _, err := path.Match(pattern, ""); err != nil {
+				v.errorf(main, main.find("plugins", i, "hosts", j), "plugins[%d]: invalid host pattern %q", i, pattern)
+			}
+		}
+		if p.Timeout < 0 {
+			v.errorf(main, main.find("plugins", i, "timeout"), "plugins[%d]: timeout must not be negative", i)
+		}
+	}
+
+	if tr := cfg.Tracing; tr != nil && (tr.Endpoint == "") == (tr.File == "") {
+		v.errorf(main, main.find("tracing"), "tracing: exactly one of endpoint and file is required")
+	}
+
+	if cfg.Webhooks != nil && cfg.Webhooks.Secret == "" {
+		v.errorf(main, main.find("webhooks"), "webhooks.secret is required")
+	}
+
+	if cfg.StateS3 != nil && cfg.StateS3.Bucket == "" {
+		v.errorf(main, main.find("state_s3"), "state_s3.bucket is required")
+	}
+
+	names := make([]string, 0, len(cfg.Notifiers))
+	for name := range cfg.Notifiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		n := cfg.Notifiers[name]
+		f := m.notifiers[name]
+		switch n.Type {
+		case "stdout":
+		case "webhook":
+			if n.URL == "" {
+				v.errorf(f, f.find("notifiers", name), "notifier %q: url is required", name)
+			}
+		case "":
+			v.errorf(f, f.find("notifiers", name), "notifier %q: type is required", name)
+		default:
+			v.errorf(f, f.find("notifiers", name, "type"), "notifier %q: unknown type %q", name, n.Type)
+		}
+	}
+
+	type firstDef struct {
+		file string
+		line int
+	}
+	seen := make(map[string]firstDef, len(cfg.Images))
+	for i, entry := range cfg.Images {
+		o := m.images[i]
+		if entry.Ref == "" {
+			v.errorf(o.file, o.file.find("images", o.index), "images[%d]: ref is required", o.index)
+			continue
+		}
+		refNode := o.file.find("images", o.index, "ref")
+		ref, err := registry.ParseImageRef(entry.Ref)
+		if err != nil {
+			v.errorf(o.file, refNode, "%v", err)
+			continue
+		}
+		key := ref.String()
+		if first, ok := seen[key]; ok {
+			if first.file == o.file.path {
+				v.errorf(o.file, refNode, "duplicate image %q (first defined at line %d)", key, first.line)
+			} else {
+				v.errorf(o.file, refNode, "duplicate image %q (first defined at %s:%d)", key, first.file, first.line)
+			}
+		} else {
+			seen[key] = firstDef{file: o.file.path, line: refNode.Line}
+		}
+
+		for j, name := range entry.Notifiers {
+			if _, ok := cfg.Notifiers[name]; !ok {
+				v.errorf(o.file, o.file.find("images", o.index, "notifiers", j),
+					"image %q: unknown notifier %q", entry.Ref, name)
+			}
+		}
+	}
+
+	for i, entry := range cfg.Charts {
+		o := m.charts[i]
+		if entry.Ref == "" {
+			v.errorf(o.file, o.file.find("charts", o.index), "charts[%d]: ref is required", o.index)
+			continue
+		}
+		refNode := o.file.find("charts", o.index, "ref")
+		ref, err := helm.ParseChartRef(entry.Ref)
+		if err != nil {
+			v.errorf(o.file, refNode, "%v", err)
+			continue
+		}
+		key := ref.String()
+		if first, ok := seen[key]; ok {
+			if first.file == o.file.path {
+				v.errorf(o.file, refNode, "duplicate chart %q (first defined at line %d)", key, first.line)
+			} else {
+				v.errorf(o.file, refNode, "duplicate chart %q (first defined at %s:%d)", key, first.file, first.line)
+			}
+		} else {
+			seen[key] = firstDef{file: o.file.path, line: refNode.Line}
+		}
+
+		for j, name := range entry.Notifiers {
+			if _, ok := cfg.Notifiers[name]; !ok {
+				v.errorf(o.file, o.file.find("charts", o.index, "notifiers", j),
+					"chart %q: unknown notifier %q", entry.Ref, name)
+			}
+		}
+	}
+}
@@ -0,0 +1,285 @@
+// Package daemon runs the checker periodically and hot-reloads its
+// configuration.
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wutscho/registry-ping/internal/config"
+	"github.com/wutscho/registry-ping/internal/helm"
+	"github.com/wutscho/registry-ping/internal/registry"
+)
+
+// ErrUnknownImage is returned by Check for an image or chart ref that is not
+// configured.
+var ErrUnknownImage = errors.New("image not configured")
+
+const defaultPollInterval = 5 * time.Second
+
+// Runner checks lists of images and charts; *checker.Checker implements it.
+type Runner interface {
+	Run(ctx context.Context, images []config.ImageEntry) error
+	RunCharts(ctx context.Context, charts []config.ChartEntry) error
+}
+
+// BuildFunc creates the Runner for a config, wiring up its notifiers.
+type BuildFunc func(cfg *config.Config) Runner
+
+// snapshot is an immutable pairing of a config and the Runner built for it.
+type snapshot struct {
+	cfg         *config.Config
+	runner      Runner
+	fingerprint string
+}
+
+// Daemon runs a check every interval. The config is reloaded when Reload is
+// called (e.g. on SIGHUP) or when one of its files changes on disk. A new
+// config that fails to load is logged and the previous one kept. Reloading
+// swaps the image and chart lists and notifiers; state of images and charts
+// that were removed is left untouched.
+type Daemon struct {
+	path         string
+	interval     time.Duration
+	pollInterval time.Duration
+	build        BuildFunc
+	logger       *slog.Logger
+	current      atomic.Pointer[snapshot]
+	reload       chan struct{}
+	// runMu serializes runs, since state stores do not support concurrent
+	// writers within one process.
+	runMu sync.Mutex
+}
+
+// Option is a functional option for Daemon.
+type Option func(*Daemon)
+
+// WithPollInterval sets how often the config files are checked for changes.
+// Zero disables polling, leaving Reload as the only trigger.
+func WithPollInterval(d time.Duration) Option {
+	return func(dm *Daemon) {
+		dm.pollInterval = d
+	}
+}
+
+// WithLogger sets the logger for run and reload messages
+// (default slog.Default()).
+func WithLogger(l *slog.Logger) Option {
+	return func(dm *Daemon) {
+		dm.logger = l
+	}
+}
+
+// New creates a Daemon for the config loaded from path.
+func New(path string, cfg *config.Config, interval time.Duration, build BuildFunc, opts ...Option) *Daemon {
+	d := &Daemon{
+		path:         path,
+		interval:     interval,
+		pollInterval: defaultPollInterval,
+		build:        build,
+		logger:       slog.Default(),
+		reload:       make(chan struct{}, 1),
+	}
+	for _, o := range opts {
+		o(d)
+	}
+	d.current.Store(&snapshot{cfg: cfg, runner: build(cfg), fingerprint: fingerprint(cfg.Files)})
+	return d
+}
+
+// Config returns the config currently in effect.
+func (d *Daemon) Config() *config.Config {
+	return d.current.Load().cfg
+}
+
+// Reload requests a config reload. It never blocks.
+func (d *Daemon) Reload() {
+	select {
+	case d.reload <- struct{}{}:
+	default:
+	}
+}
+
+// Run checks immediately and then every interval until ctx is cancelled.
+func (d *Daemon) Run(ctx context.Context) error {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	var poll <-chan time.Time
+	if d.pollInterval > 0 {
+		t := time.NewTicker(d.pollInterval)
+		defer t.Stop()
+		poll = t.C
+	}
+
+	d.check(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-d.reload:
+			d.reloadConfig()
+		case <-poll:
+			if fingerprint(d.Config().Files) != d.current.Load().fingerprint {
+				d.reloadConfig()
+			}
+		case <-ticker.C:
+			d.check(ctx)
+		}
+	}
+}
+
+func (d *Daemon) check(ctx context.Context) {
+	if err := d.Check(ctx, nil); err != nil {
+		d.logger.Error("check run failed", "err", err)
+	}
+}
+
+// Check immediately checks the configured images and charts matching refs,
+// or all of them if refs is empty. It waits for a scheduled run in progress
+// to finish first. Refs are compared in normalized form, so "library/php:8"
+// matches "php:8".
+func (d *Daemon) Check(ctx context.Context, refs []string) error {
+	snap := d.current.Load()
+	images, charts := snap.cfg.Images, snap.cfg.Charts
+	if len(refs) > 0 {
+		var err error
+		if images, charts, err = selectEntries(images, charts, refs); err != nil {
+			return err
+		}
+	}
+
+	d.runMu.Lock()
+	defer d.runMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, snap.cfg.Timeout.Std())
+	defer cancel()
+	var errs []error
+	if len(images) > 0 || len(refs) == 0 {
+		errs = append(errs, snap.runner.Run(ctx, images))
+	}
+	if len(charts) > 0 {
+		errs = append(errs, snap.runner.RunCharts(ctx, charts))
+	}
+	return errors.Join(errs...)
+}
+
+func selectEntries(images []config.ImageEntry, charts []config.ChartEntry, refs []string) ([]config.ImageEntry, []config.ChartEntry, error) {
+	imagesByKey := make(map[string]config.ImageEntry, len(images))
+	for _, img := range images {
+		imagesByKey[normalize(img.Ref)] = img
+	}
+	chartsByKey := make(map[string]config.ChartEntry, len(charts))
+	for _, chart := range charts {
+		chartsByKey[normalizeChart(chart.Ref)] = chart
+	}
+	var selectedImages []config.ImageEntry
+	var selectedCharts []config.ChartEntry
+	for _, r := range refs {
+		if img, ok := imagesByKey[normalize(r)]; ok {
+			selectedImages = append(selectedImages, img)
+		} else if chart, ok := chartsByKey[normalizeChart(r)]; ok {
+			selectedCharts = append(selectedCharts, chart)
+		} else {
+			return nil, nil, fmt.Errorf("%q: %w", r, ErrUnknownImage)
+		}
+	}
+	return selectedImages, selectedCharts, nil
+}
+
+func normalize(ref string) string {
+	if r, err := registry.ParseImageRef(ref); err == nil {
+		return r.String()
+	}
+	return ref
+}
+
+func normalizeChart(ref string) string {
+	if r, err := helm.ParseChartRef(ref); err == nil {
+		return r.String()
+	}
+	return ref
+}
+
+// reloadConfig loads the config and swaps it in if valid.
+func (d *Daemon) reloadConfig() {
+	old := d.current.Load()
+	cfg, err := config.Load(d.path)
+	if err != nil {
+		// Remember the broken files' fingerprint so polling does not
+		// report the same error every few seconds.
+		d.current.Store(&snapshot{cfg: old.cfg, runner: old.runner, fingerprint: fingerprint(old.cfg.Files)})
+		d.logger.Error("reload config: keeping previous config", "err", err)
+		return
+	}
+
+	for _, name := range restartOnly(old.cfg, cfg) {
+		d.logger.Warn("reload config: setting changed; takes effect after restart", "setting", name)
+	}
+	d.current.Store(&snapshot{cfg: cfg, runner: d.build(cfg), fingerprint: fingerprint(cfg.Files)})
+	d.logger.Info("reload config", "images", len(cfg.Images), "charts", len(cfg.Charts), "notifiers", len(cfg.Notifiers))
+}
+
+// restartOnly returns the settings that differ between old and cfg but are
+// only applied at startup.
+func restartOnly(old, cfg *config.Config) []string {
+	var changed []string
+	if old.StateFile != cfg.StateFile || !reflect.DeepEqual(old.StateS3, cfg.StateS3) {
+		changed = append(changed, "state backend")
+	}
+	if old.HTTPTimeout != cfg.HTTPTimeout {
+		changed = append(changed, "http_timeout")
+	}
+	if old.HTTPCacheDir != cfg.HTTPCacheDir {
+		changed = append(changed, "http_cache_dir")
+	}
+	if !reflect.DeepEqual(old.Registries, cfg.Registries) {
+		changed = append(changed, "registries")
+	}
+	if !reflect.DeepEqual(old.Mirrors, cfg.Mirrors) {
+		changed = append(changed, "mirrors")
+	}
+	if !reflect.DeepEqual(old.Plugins, cfg.Plugins) {
+		changed = append(changed, "plugins")
+	}
+	if old.Log != cfg.Log {
+		changed = append(changed, "log")
+	}
+	if !reflect.DeepEqual(old.Tracing, cfg.Tracing) {
+		changed = append(changed, "tracing")
+	}
+	return changed
+}
+
+// fingerprint summarizes the modification times and sizes of files and of
+// their directories, so adding a file to an included glob directory is
+// noticed as well.
+func fingerprint(files []string) string {
+	seen := make(map[string]bool)
+	var fp string
+	add := func(path string) {
+		if seen[path] {
+			return
+		}
+		seen[path] = true
+		fi, err := os.Stat(path)
+		if err != nil {
+			fp += path + ":missing;"
+			return
+		}
+		fp += fmt.Sprintf("%s:%d:%d;", path, fi.ModTime().UnixNano(), fi.Size())
+	}
+	for _, f := range files {
+		add(f)
+		add(filepath.Dir(f))
+	}
+	return fp
+}
@@ -0,0 +1,185 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wutscho/registry-ping/internal/config"
+)
+
+type fakeRunner struct {
+	mu   sync.Mutex
+	runs [][]string
+}
+
+func (f *fakeRunner) Run(_ context.Context, images []config.ImageEntry) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var refs []string
+	for _, img := range images {
+		refs = append(refs, img.Ref)
+	}
+	f.runs = append(f.runs, refs)
+	return nil
+}
+
+func (f *fakeRunner) RunCharts(_ context.Context, charts []config.ChartEntry) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var refs []string
+	for _, chart := range charts {
+		refs = append(refs, chart.Ref)
+	}
+	f.runs = append(f.runs, refs)
+	return nil
+}
+
+func (f *fakeRunner) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.runs)
+}
+
+func writeConfig(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	// Make sure the modification time differs from the previous write.
+	future := time.Now().Add(time.Duration(len(content)) * time.Second)
+	require.NoError(t, os.Chtimes(path, future, future))
+}
+
+func newTestDaemon(t *testing.T, content string) (*Daemon, string, *[]*config.Config) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, content)
+	cfg, err := config.Load(path)
+	require.NoError(t, err)
+
+	var built []*config.Config
+	d := New(path, cfg, time.Hour, func(cfg *config.Config) Runner {
+		built = append(built, cfg)
+		return &fakeRunner{}
+	}, WithPollInterval(0))
+	return d, path, &built
+}
+
+func TestDaemon_ReloadSwapsConfig(t *testing.T) {
+	d, path, built := newTestDaemon(t, "images:\n  - ref: php:8.2.30-fpm\n")
+
+	writeConfig(t, path, "images:\n  - ref: nginx:1.25-alpine\n  - ref: redis:7\nnotifiers:\n  ops:\n    type: stdout\n")
+	d.reloadConfig()
+
+	require.Len(t, *built, 2)
+	assert.Len(t, d.Config().Images, 2)
+	assert.Contains(t, d.Config().Notifiers, "ops")
+}
+
+func TestDaemon_InvalidReloadKeepsPrevious(t *testing.T) {
+	d, path, built := newTestDaemon(t, "images:\n  - ref: php:8.2.30-fpm\n")
+	before := d.current.Load()
+
+	writeConfig(t, path, "image:\n  - ref: nginx\n")
+	d.reloadConfig()
+
+	assert.Len(t, *built, 1, "no runner must be built for an invalid config")
+	assert.Same(t, before.cfg, d.Config())
+	assert.Same(t, before.runner, d.current.Load().runner)
+	assert.NotEqual(t, before.fingerprint, d.current.Load().fingerprint,
+		"the broken file must not trigger another reload until it changes again")
+}
+
+func TestDaemon_PollDetectsChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, "images:\n  - ref: php:8.2.30-fpm\n")
+	cfg, err := config.Load(path)
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var runners []*fakeRunner
+	d := New(path, cfg, 10*time.Millisecond, func(cfg *config.Config) Runner {
+		mu.Lock()
+		defer mu.Unlock()
+		r := &fakeRunner{}
+		runners = append(runners, r)
+		return r
+	}, WithPollInterval(5*time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- d.Run(ctx) }()
+
+	writeConfig(t, path, "images:\n  - ref: nginx:1.25-alpine\n  - ref: redis:7\n")
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(runners) == 2 && runners[1].count() > 0
+	}, 2*time.Second, 5*time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-done)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Positive(t, runners[0].count(), "initial config must be checked once at start")
+	runners[1].mu.Lock()
+	defer runners[1].mu.Unlock()
+	assert.Equal(t, []string{"nginx:1.25-alpine", "redis:7"}, runners[1].runs[0])
+}
+
+func TestDaemon_ReloadNeverBlocks(t *testing.T) {
+	d, _, _ := newTestDaemon(t, "images: []\n")
+	d.Reload()
+	d.Reload()
+	assert.Len(t, d.reload, 1)
+}
+
+func TestRestartOnly(t *testing.T) {
+	old := &config.Config{StateFile: "a.json", HTTPTimeout: config.Duration(time.Second)}
+	cfg := &config.Config{StateFile: "b.json", HTTPTimeout: config.Duration(time.Second)}
+	assert.Equal(t, []string{"state backend"}, restartOnly(old, cfg))
+	assert.Empty(t, restartOnly(old, old))
+}
+
+func TestDaemon_CheckSelectedImages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, "images:\n  - ref: php:8.2.30-fpm\n  - ref: nginx:1.25-alpine\n")
+	cfg, err := config.Load(path)
+	require.NoError(t, err)
+	runner := &fakeRunner{}
+	d := New(path, cfg, time.Hour, func(*config.Config) Runner { return runner }, WithPollInterval(0))
+
+	require.NoError(t, d.Check(context.Background(), []string{"library/nginx:1.25-alpine"}))
+	require.NoError(t, d.Check(context.Background(), nil))
+	err = d.Check(context.Background(), []string{"redis:7"})
+	assert.True(t, errors.Is(err, ErrUnknownImage), "expected ErrUnknownImage, got: %v", err)
+
+	assert.Equal(t, [][]string{
+		{"nginx:1.25-alpine"},
+		{"php:8.2.30-fpm", "nginx:1.25-alpine"},
+	}, runner.runs)
+}
+
+func TestDaemon_CheckSelectedCharts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, "images:\n  - ref: php:8.2.30-fpm\ncharts:\n  - ref: oci://ghcr.io/org/charts/app\n")
+	cfg, err := config.Load(path)
+	require.NoError(t, err)
+	runner := &fakeRunner{}
+	d := New(path, cfg, time.Hour, func(*config.Config) Runner { return runner }, WithPollInterval(0))
+
+	require.NoError(t, d.Check(context.Background(), []string{"oci://ghcr.io/org/charts/app/"}))
+	require.NoError(t, d.Check(context.Background(), nil))
+
+	assert.Equal(t, [][]string{
+		{"oci://ghcr.io/org/charts/app"},
+		{"php:8.2.30-fpm"},
+		{"oci://ghcr.io/org/charts/app"},
+	}, runner.runs)
+}
@@ -0,0 +1,453 @@
+package helm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/wutscho/registry-ping/internal/registry"
+	"github.com/wutscho/registry-ping/internal/registry/oci"
+)
+
+const (
+	// helmConfigMediaType marks the config blob of a Helm chart artifact,
+	// which holds the chart's Chart.yaml metadata as JSON.
+	helmConfigMediaType = "application/vnd.cncf.helm.config.v1+json"
+	ociManifestType     = "application/vnd.oci.image.manifest.v1+json"
+	// maxTagPages bounds the paginated tag listing of an OCI repository.
+	maxTagPages = 50
+)
+
+// Release is a published chart version.
+type Release struct {
+	Version    string
+	AppVersion string
+	// Digest is the manifest digest of an OCI chart, or the package digest
+	// listed in a repository index.
+	Digest string
+	// Created is when the version was published, or zero if unknown.
+	Created time.Time
+}
+
+// ClientFunc returns the HTTP client for a registry or repository host.
+type ClientFunc func(host string) (*http.Client, error)
+
+// Client finds the latest release of charts. OCI registries are read
+// through the distribution API (/v2/), classic repositories through their
+// index.yaml.
+type Client struct {
+	clientFor   ClientFunc
+	credentials func(host string) (username, password string)
+	urls        map[string]string
+	mirrors     map[string]mirrorSet
+	logger      *slog.Logger
+
+	mu    sync.Mutex
+	hosts map[hostKey]*hostClient
+}
+
+// Mirror is a registry serving the distribution API for the charts of
+// another, such as a pull-through cache.
+type Mirror struct {
+	// URL is the mirror's base URL, e.g. "https://mirror.gcr.io".
+	URL      string
+	Username string
+	Password string
+	// Prefix is prepended to repository paths.
+	Prefix string
+}
+
+type mirrorSet struct {
+	mode    registry.MirrorMode
+	mirrors []Mirror
+}
+
+// endpoint is a registry or mirror an OCI chart is read from.
+type endpoint struct {
+	name    string // registry or mirror host, for errors and logs
+	baseURL string
+	prefix  string
+	mirror  bool
+	hostKey
+}
+
+// hostKey selects the HTTP client and credentials of an endpoint.
+type hostKey struct {
+	host     string
+	username string
+	password string
+}
+
+type hostClient struct {
+	client   *http.Client
+	auth     *oci.Authorizer
+	username string
+	password string
+}
+
+// Option is a functional option for Client.
+type Option func(*Client)
+
+// WithCredentials sets the function returning the user name and password
+// for a host, or empty strings for anonymous access. They are used for the
+// token service of OCI registries and as basic auth for repositories.
+func WithCredentials(fn func(host string) (username, password string)) Option {
+	return func(c *Client) {
+		c.credentials = fn
+	}
+}
+
+// WithRegistryURL reads OCI charts of the registry host from the
+// distribution API at url rather than at https://<host> (or
+// https://registry-1.docker.io for Docker Hub).
+func WithRegistryURL(host, url string) Option {
+	return func(c *Client) {
+		c.urls[registry.CanonicalHost(host)] = strings.TrimSuffix(url, "/")
+	}
+}
+
+// WithMirrors declares mirrors of the registry host, asked for OCI charts
+// as registry.ScraperRegistry asks image mirrors: in the given order,
+// before or after the registry depending on mode. A chart the registry
+// itself reports as not found is not looked up on its mirrors.
+func WithMirrors(host string, mode registry.MirrorMode, mirrors ...Mirror) Option {
+	return func(c *Client) {
+		c.mirrors[registry.CanonicalHost(host)] = mirrorSet{mode: mode, mirrors: mirrors}
+	}
+}
+
+// WithLogger sets the logger for fetch diagnostics (default slog.Default()).
+func WithLogger(l *slog.Logger) Option {
+	return func(c *Client) {
+		c.logger = l
+	}
+}
+
+// NewClient creates a Client taking the HTTP client of each host from
+// clientFor.
+func NewClient(clientFor ClientFunc, opts ...Option) *Client {
+	c := &Client{
+		clientFor: clientFor,
+		urls:      make(map[string]string),
+		mirrors:   make(map[string]mirrorSet),
+		logger:    slog.Default(),
+		hosts:     make(map[hostKey]*hostClient),
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+// Latest returns the highest released version of the chart; pre-releases
+// are ignored.
+func (c *Client) Latest(ctx context.Context, ref ChartRef) (Release, error) {
+	if ref.IsOCI() {
+		return c.latestMirrored(ctx, ref)
+	}
+	hc, err := c.forHost(c.upstreamKey(ref.Host()))
+	if err != nil {
+		return Release{}, fmt.Errorf("helm: %s: %w", ref, err)
+	}
+	rel, err := c.latestIndexed(ctx, hc, ref)
+	if err != nil {
+		return Release{}, err
+	}
+	c.logger.Debug("helm: latest release", "chart", ref.String(), "version", rel.Version, "app_version", rel.AppVersion)
+	return rel, nil
+}
+
+// latestMirrored asks the registry of an OCI chart and its mirrors in
+// turn until one answers. If all fail, their errors are joined.
+func (c *Client) latestMirrored(ctx context.Context, ref ChartRef) (Release, error) {
+	endpoints := c.endpoints(ref.Host())
+	var errs []error
+	for _, e := range endpoints {
+		hc, err := c.forHost(e.hostKey)
+		if err == nil {
+			var rel Release
+			if rel, err = c.latestOCI(ctx, hc, e, ref); err == nil {
+				c.logger.Debug("helm: latest release", "chart", ref.String(), "source", e.name, "version", rel.Version, "app_version", rel.AppVersion)
+				return rel, nil
+			}
+		} else {
+			err = fmt.Errorf("helm: %s: %w", ref, err)
+		}
+		if len(endpoints) == 1 {
+			return Release{}, err
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", e.name, err))
+		if (!e.mirror && errors.Is(err, registry.ErrNotFound)) || ctx.Err() != nil {
+			break
+		}
+	}
+	return Release{}, errors.Join(errs...)
+}
+
+// endpoints returns the registry serving OCI charts of host and its
+// mirrors, in the order they are asked.
+func (c *Client) endpoints(host string) []endpoint {
+	canonical := registry.CanonicalHost(host)
+	upstream := endpoint{name: canonical, baseURL: c.urls[canonical], hostKey: c.upstreamKey(host)}
+	if upstream.baseURL == "" {
+		upstream.baseURL = "https://" + host
+		if canonical == "docker.io" {
+			upstream.baseURL = "https://registry-1.docker.io"
+		}
+	}
+	ms := c.mirrors[canonical]
+	endpoints := make([]endpoint, 0, len(ms.mirrors)+1)
+	for _, m := range ms.mirrors {
+		e := endpoint{
+			name:    m.URL,
+			baseURL: strings.TrimSuffix(m.URL, "/"),
+			prefix:  strings.Trim(m.Prefix, "/"),
+			mirror:  true,
+			hostKey: hostKey{username: m.Username, password: m.Password},
+		}
+		if u, err := url.Parse(m.URL); err == nil {
+			e.name, e.host = u.Host, u.Host
+		}
+		endpoints = append(endpoints, e)
+	}
+	if ms.mode == registry.MirrorFirst {
+		return append(endpoints, upstream)
+	}
+	return append([]endpoint{upstream}, endpoints...)
+}
+
+// upstreamKey returns the client and credentials of a registry or
+// repository host.
+func (c *Client) upstreamKey(host string) hostKey {
+	key := hostKey{host: host}
+	if c.credentials != nil {
+		key.username, key.password = c.credentials(host)
+	}
+	return key
+}
+
+func (c *Client) forHost(key hostKey) (*hostClient, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if hc, ok := c.hosts[key]; ok {
+		return hc, nil
+	}
+	client, err := c.clientFor(key.host)
+	if err != nil {
+		return nil, err
+	}
+	hc := &hostClient{client: client, username: key.username, password: key.password}
+	var credentials oci.CredentialsFunc
+	if hc.username != "" {
+		credentials = func(context.Context) (string, string, error) { return hc.username, hc.password, nil }
+	}
+	hc.auth = oci.NewAuthorizer(client, credentials)
+	c.hosts[key] = hc
+	return hc, nil
+}
+
+// latestOCI lists the repository's tags on e, in which Helm stores "+" of
+// versions as "_", and reads the manifest and Chart.yaml metadata of the
+// highest version.
+func (c *Client) latestOCI(ctx context.Context, hc *hostClient, e endpoint, ref ChartRef) (Release, error) {
+	repo := ref.repository()
+	if e.prefix != "" {
+		repo = e.prefix + "/" + repo
+	}
+	base := e.baseURL + "/v2/" + repo
+	scope := "repository:" + repo + ":pull"
+
+	var tags []string
+	next := base + "/tags/list"
+	for page := 0; next != ""; page++ {
+		if page == maxTagPages {
+			return Release{}, fmt.Errorf("helm: %s: more than %d pages of tags", ref, maxTagPages)
+		}
+		var list struct {
+			Tags []string `json:"tags"`
+		}
+		resp, err := hc.getJSON(ctx, scope, next, "application/json", &list)
+		if err != nil {
+			return Release{}, fmt.Errorf("helm: list tags of %s: %w", ref, err)
+		}
+		tags = append(tags, list.Tags...)
+		next = nextLink(resp)
+	}
+	versions := make([]string, len(tags))
+	for i, tag := range tags {
+		versions[i] = strings.ReplaceAll(tag, "_", "+")
+	}
+	i := latest(versions)
+	if i < 0 {
+		return Release{}, fmt.Errorf("helm: %s: no released version: %w", ref, registry.ErrNotFound)
+	}
+
+	resp, err := hc.get(ctx, scope, base+"/manifests/"+url.PathEscape(tags[i]), ociManifestType)
+	if err != nil {
+		return Release{}, fmt.Errorf("helm: fetch %s:%s: %w", ref, tags[i], err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Release{}, fmt.Errorf("helm: read manifest of %s:%s: %w", ref, tags[i], err)
+	}
+	var manifest struct {
+		Config struct {
+			MediaType string `json:"mediaType"`
+			Digest    string `json:"digest"`
+		} `json:"config"`
+		Annotations map[string]string `json:"annotations"`
+	}
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return Release{}, fmt.Errorf("helm: decode manifest of %s:%s: %w", ref, tags[i], &registry.DecodeError{Err: err})
+	}
+	if manifest.Config.MediaType != helmConfigMediaType {
+		return Release{}, fmt.Errorf("helm: %s:%s is not a Helm chart (config media type %q)", ref, tags[i], manifest.Config.MediaType)
+	}
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		sum := sha256.Sum256(body)
+		digest = "sha256:" + hex.EncodeToString(sum[:])
+	}
+
+	var meta struct {
+		Version    string `json:"version"`
+		AppVersion string `json:"appVersion"`
+	}
+	if _, err := hc.getJSON(ctx, scope, base+"/blobs/"+manifest.Config.Digest, helmConfigMediaType, &meta); err != nil {
+		return Release{}, fmt.Errorf("helm: fetch metadata of %s:%s: %w", ref, tags[i], err)
+	}
+	rel := Release{Version: meta.Version, AppVersion: meta.AppVersion, Digest: digest}
+	if rel.Version == "" {
+		rel.Version = versions[i]
+	}
+	if t, err := time.Parse(time.RFC3339, manifest.Annotations["org.opencontainers.image.created"]); err == nil {
+		rel.Created = t
+	}
+	return rel, nil
+}
+
+// latestIndexed reads the repository's index.yaml.
+func (c *Client) latestIndexed(ctx context.Context, hc *hostClient, ref ChartRef) (Release, error) {
+	resp, err := hc.get(ctx, "", ref.Repo+"/index.yaml", "application/x-yaml, */*")
+	if err != nil {
+		return Release{}, fmt.Errorf("helm: fetch index of %s: %w", ref.Repo, err)
+	}
+	defer resp.Body.Close()
+
+	var index struct {
+		Entries map[string][]struct {
+			Version    string `yaml:"version"`
+			AppVersion string `yaml:"appVersion"`
+			Created    string `yaml:"created"`
+			Digest     string `yaml:"digest"`
+		} `yaml:"entries"`
+	}
+	if err := yaml.NewDecoder(resp.Body).Decode(&index); err != nil {
+		return Release{}, fmt.Errorf("helm: decode index of %s: %w", ref.Repo, &registry.DecodeError{Err: err})
+	}
+	entries := index.Entries[ref.Name]
+	versions := make([]string, len(entries))
+	for i, e := range entries {
+		versions[i] = e.Version
+	}
+	i := latest(versions)
+	if i < 0 {
+		return Release{}, fmt.Errorf("helm: %s: no released version: %w", ref, registry.ErrNotFound)
+	}
+
+	e := entries[i]
+	rel := Release{Version: e.Version, AppVersion: e.AppVersion, Digest: e.Digest}
+	if rel.Digest != "" && !strings.Contains(rel.Digest, ":") {
+		rel.Digest = "sha256:" + rel.Digest
+	}
+	if t, err := time.Parse(time.RFC3339Nano, e.Created); err == nil {
+		rel.Created = t
+	}
+	return rel, nil
+}
+
+// get sends a GET request for u. With a scope, a 401 challenge of an OCI
+// registry is answered; without, credentials are sent as basic auth.
+func (hc *hostClient) get(ctx context.Context, scope, u, accept string) (*http.Response, error) {
+	newRequest := func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", accept)
+		return req, nil
+	}
+
+	var resp *http.Response
+	var err error
+	if scope != "" {
+		resp, err = hc.auth.Do(ctx, scope, newRequest)
+	} else {
+		var req *http.Request
+		if req, err = newRequest(); err != nil {
+			return nil, err
+		}
+		if hc.username != "" {
+			req.SetBasicAuth(hc.username, hc.password)
+		}
+		resp, err = hc.client.Do(req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, registry.ErrNotFound
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		resp.Body.Close()
+		return nil, &registry.StatusError{Code: resp.StatusCode}
+	}
+	return resp, nil
+}
+
+// getJSON gets u and decodes the JSON response into v. The returned
+// response's body is closed.
+func (hc *hostClient) getJSON(ctx context.Context, scope, u, accept string, v any) (*http.Response, error) {
+	resp, err := hc.get(ctx, scope, u, accept)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return nil, &registry.DecodeError{Err: err}
+	}
+	return resp, nil
+}
+
+// nextLink returns the URL of the next page named in the response's Link
+// header, e.g. `</v2/org/chart/tags/list?last=1.2.0&n=100>; rel="next"`,
+// or "" on the last page.
+func nextLink(resp *http.Response) string {
+	for _, link := range resp.Header.Values("Link") {
+		target, params, _ := strings.Cut(link, ";")
+		if !strings.Contains(params, `rel="next"`) {
+			continue
+		}
+		target = strings.Trim(strings.TrimSpace(target), "<>")
+		u, err := resp.Request.URL.Parse(target)
+		if err != nil {
+			return ""
+		}
+		return u.String()
+	}
+	return ""
+}
@@ -0,0 +1,210 @@
+package helm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wutscho/registry-ping/internal/registry"
+)
+
+func newTestClient(server *httptest.Server, opts ...Option) *Client {
+	return NewClient(func(string) (*http.Client, error) { return server.Client(), nil }, opts...)
+}
+
+func TestLatest_OCI(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			assert.Equal(t, "repository:org/charts/app:pull", r.URL.Query().Get("scope"))
+			user, pass, _ := r.BasicAuth()
+			assert.Equal(t, "robot", user)
+			assert.Equal(t, "secret", pass)
+			w.Write([]byte(`{"token":"t0k3n"}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer t0k3n" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/org/charts/app/tags/list":
+			if r.URL.Query().Get("last") == "" {
+				w.Header().Set("Link", `</v2/org/charts/app/tags/list?last=1.9.0&n=2>; rel="next"`)
+				w.Write([]byte(`{"name":"org/charts/app","tags":["1.2.0","1.9.0"]}`))
+				return
+			}
+			w.Write([]byte(`{"name":"org/charts/app","tags":["1.10.0_build.1","2.0.0-rc.1"]}`))
+		case "/v2/org/charts/app/manifests/1.10.0_build.1":
+			assert.Equal(t, ociManifestType, r.Header.Get("Accept"))
+			w.Header().Set("Docker-Content-Digest", "sha256:chart")
+			w.Write([]byte(`{"schemaVersion":2,"config":{"mediaType":"application/vnd.cncf.helm.config.v1+json","digest":"sha256:cfg"},` +
+				`"annotations":{"org.opencontainers.image.created":"2026-03-01T10:00:00Z"}}`))
+		case "/v2/org/charts/app/blobs/sha256:cfg":
+			w.Write([]byte(`{"name":"app","version":"1.10.0+build.1","appVersion":"4.2.0"}`))
+		default:
+			t.Errorf("unexpected request %s", r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	ref, err := ParseChartRef("oci://" + strings.TrimPrefix(server.URL, "https://") + "/org/charts/app")
+	require.NoError(t, err)
+	c := newTestClient(server, WithCredentials(func(string) (string, string) { return "robot", "secret" }))
+	rel, err := c.Latest(context.Background(), ref)
+	require.NoError(t, err)
+	assert.Equal(t, Release{
+		Version:    "1.10.0+build.1",
+		AppVersion: "4.2.0",
+		Digest:     "sha256:chart",
+		Created:    time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC),
+	}, rel)
+}
+
+func TestLatest_OCINotAChart(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/org/app/tags/list":
+			w.Write([]byte(`{"tags":["1.0.0"]}`))
+		default:
+			w.Write([]byte(`{"schemaVersion":2,"config":{"mediaType":"application/vnd.oci.image.config.v1+json"}}`))
+		}
+	}))
+	defer server.Close()
+
+	ref, err := ParseChartRef("oci://" + strings.TrimPrefix(server.URL, "https://") + "/org/app")
+	require.NoError(t, err)
+	_, err = newTestClient(server).Latest(context.Background(), ref)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not a Helm chart")
+}
+
+const index = `apiVersion: v1
+entries:
+  nginx:
+    - version: 15.1.0
+      appVersion: 1.25.3
+      created: "2026-02-01T08:00:00.123456789Z"
+      digest: 0f1e2d
+    - version: 15.2.0-beta.1
+      appVersion: 1.25.4
+    - version: 15.0.2
+      appVersion: 1.25.2
+      created: 2026-01-10T08:00:00Z
+  redis:
+    - version: 18.0.0
+`
+
+func TestLatest_Index(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/bitnami/index.yaml", r.URL.Path)
+		user, _, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "reader", user)
+		w.Write([]byte(index))
+	}))
+	defer server.Close()
+
+	c := newTestClient(server, WithCredentials(func(string) (string, string) { return "reader", "pw" }))
+	rel, err := c.Latest(context.Background(), ChartRef{Repo: server.URL + "/bitnami", Name: "nginx"})
+	require.NoError(t, err)
+	assert.Equal(t, Release{
+		Version:    "15.1.0",
+		AppVersion: "1.25.3",
+		Digest:     "sha256:0f1e2d",
+		Created:    time.Date(2026, 2, 1, 8, 0, 0, 123456789, time.UTC),
+	}, rel)
+
+	_, err = c.Latest(context.Background(), ChartRef{Repo: server.URL + "/bitnami", Name: "postgresql"})
+	assert.True(t, errors.Is(err, registry.ErrNotFound), "expected ErrNotFound, got: %v", err)
+}
+
+func TestLatest_IndexStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	_, err := newTestClient(server).Latest(context.Background(), ChartRef{Repo: server.URL, Name: "nginx"})
+	assert.Equal(t, "status", registry.ErrorClass(err))
+}
+
+func TestLatest_OCIRegistryURLAndMirrors(t *testing.T) {
+	chart := func(w http.ResponseWriter, r *http.Request, repo string) {
+		switch r.URL.Path {
+		case "/v2/" + repo + "/tags/list":
+			w.Write([]byte(`{"tags":["1.0.0"]}`))
+		case "/v2/" + repo + "/manifests/1.0.0":
+			w.Header().Set("Docker-Content-Digest", "sha256:chart")
+			w.Write([]byte(`{"schemaVersion":2,"config":{"mediaType":"application/vnd.cncf.helm.config.v1+json","digest":"sha256:cfg"}}`))
+		case "/v2/" + repo + "/blobs/sha256:cfg":
+			w.Write([]byte(`{"version":"1.0.0","appVersion":"2.0.0"}`))
+		default:
+			t.Errorf("unexpected request %s", r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}
+	var upstreamCalls int
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalls++
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer upstream.Close()
+	mirror := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chart(w, r, "proxy/org/charts/app")
+	}))
+	defer mirror.Close()
+
+	ref, err := ParseChartRef("oci://charts.example/org/charts/app")
+	require.NoError(t, err)
+	c := NewClient(func(string) (*http.Client, error) { return upstream.Client(), nil },
+		WithRegistryURL("charts.example", upstream.URL+"/"),
+		WithMirrors("charts.example", registry.MirrorFallback,
+			Mirror{URL: mirror.URL, Prefix: "/proxy/"}))
+	rel, err := c.Latest(context.Background(), ref)
+	require.NoError(t, err)
+	assert.Equal(t, Release{Version: "1.0.0", AppVersion: "2.0.0", Digest: "sha256:chart"}, rel)
+	assert.Positive(t, upstreamCalls, "the registry is asked before its fallback mirror")
+}
+
+func TestLatest_OCIMirrorNotAskedForMissingChart(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer upstream.Close()
+	mirror := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected mirror request %s", r.URL)
+	}))
+	defer mirror.Close()
+
+	ref, err := ParseChartRef("oci://charts.example/org/app")
+	require.NoError(t, err)
+	c := NewClient(func(string) (*http.Client, error) { return upstream.Client(), nil },
+		WithRegistryURL("charts.example", upstream.URL),
+		WithMirrors("charts.example", registry.MirrorFallback, Mirror{URL: mirror.URL}))
+	_, err = c.Latest(context.Background(), ref)
+	assert.True(t, errors.Is(err, registry.ErrNotFound), "expected ErrNotFound, got: %v", err)
+}
+
+func TestEndpoints(t *testing.T) {
+	c := NewClient(nil, WithMirrors("docker.io", registry.MirrorFirst, Mirror{URL: "https://mirror.gcr.io"}))
+
+	endpoints := c.endpoints("docker.io")
+	require.Len(t, endpoints, 2)
+	assert.Equal(t, "https://mirror.gcr.io", endpoints[0].baseURL)
+	assert.Equal(t, "mirror.gcr.io", endpoints[0].host)
+	assert.Equal(t, "https://registry-1.docker.io", endpoints[1].baseURL)
+	assert.Equal(t, "docker.io", endpoints[1].host)
+
+	endpoints = c.endpoints("ghcr.io")
+	require.Len(t, endpoints, 1)
+	assert.Equal(t, "https://ghcr.io", endpoints[0].baseURL)
+}
@@ -0,0 +1,73 @@
+// Package helm finds the latest release of Helm charts, both charts stored
+// as OCI artifacts and charts in classic repositories serving an index.yaml.
+package helm
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// ChartRef identifies a chart: "oci://<host>/<path>/<name>" for a chart in
+// an OCI registry, or "<repository URL>/<name>" for a chart in a classic
+// repository, e.g. "https://charts.bitnami.com/bitnami/nginx".
+type ChartRef struct {
+	// Repo is "oci://<host>/<path>" or the classic repository's URL.
+	Repo string
+	Name string
+}
+
+// ParseChartRef parses a chart ref. The scheme must be oci, http or https.
+func ParseChartRef(s string) (ChartRef, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return ChartRef{}, fmt.Errorf("chart ref %q: %w", s, err)
+	}
+	switch {
+	case u.Scheme != "oci" && u.Scheme != "http" && u.Scheme != "https":
+		return ChartRef{}, fmt.Errorf("chart ref %q: scheme must be oci, http or https", s)
+	case u.Host == "":
+		return ChartRef{}, fmt.Errorf("chart ref %q: host required", s)
+	case u.RawQuery != "" || u.Fragment != "" || u.User != nil:
+		return ChartRef{}, fmt.Errorf("chart ref %q: must not have user info, query or fragment", s)
+	}
+	p := strings.Trim(u.Path, "/")
+	if p == "" {
+		return ChartRef{}, fmt.Errorf("chart ref %q: chart name required", s)
+	}
+	dir, name := path.Split(p)
+	if u.Scheme == "oci" && dir == "" {
+		return ChartRef{}, fmt.Errorf("chart ref %q: repository path required", s)
+	}
+	repo := u.Scheme + "://" + u.Host
+	if dir != "" {
+		repo += "/" + strings.TrimSuffix(dir, "/")
+	}
+	return ChartRef{Repo: repo, Name: name}, nil
+}
+
+// String returns the chart ref as parsed. Used as the state file key.
+func (r ChartRef) String() string {
+	return r.Repo + "/" + r.Name
+}
+
+// IsOCI reports whether the chart is stored in an OCI registry.
+func (r ChartRef) IsOCI() bool {
+	return strings.HasPrefix(r.Repo, "oci://")
+}
+
+// Host returns the registry or repository host, e.g. "ghcr.io".
+func (r ChartRef) Host() string {
+	_, rest, _ := strings.Cut(r.Repo, "://")
+	host, _, _ := strings.Cut(rest, "/")
+	return host
+}
+
+// repository returns the OCI repository path of the chart, e.g.
+// "org/charts/nginx".
+func (r ChartRef) repository() string {
+	_, rest, _ := strings.Cut(r.Repo, "://")
+	_, p, _ := strings.Cut(rest, "/")
+	return p + "/" + r.Name
+}
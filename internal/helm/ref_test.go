@@ -0,0 +1,58 @@
+package helm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseChartRef(t *testing.T) {
+	tests := []struct {
+		in         string
+		repo, name string
+		oci        bool
+		host       string
+	}{
+		{"oci://ghcr.io/org/charts/app", "oci://ghcr.io/org/charts", "app", true, "ghcr.io"},
+		{"oci://registry-1.docker.io/bitnamicharts/nginx/", "oci://registry-1.docker.io/bitnamicharts", "nginx", true, "registry-1.docker.io"},
+		{"https://charts.bitnami.com/bitnami/nginx", "https://charts.bitnami.com/bitnami", "nginx", false, "charts.bitnami.com"},
+		{"http://charts.internal:8080/app", "http://charts.internal:8080", "app", false, "charts.internal:8080"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			ref, err := ParseChartRef(tt.in)
+			require.NoError(t, err)
+			assert.Equal(t, ChartRef{Repo: tt.repo, Name: tt.name}, ref)
+			assert.Equal(t, tt.oci, ref.IsOCI())
+			assert.Equal(t, tt.host, ref.Host())
+		})
+	}
+
+	assert.Equal(t, "org/charts/app", ChartRef{Repo: "oci://ghcr.io/org/charts", Name: "app"}.repository())
+
+	for _, in := range []string{
+		"ghcr.io/org/app", "ftp://example.com/app", "oci:///app", "oci://ghcr.io/app",
+		"https://charts.example.com/", "https://charts.example.com/app?x=1",
+	} {
+		_, err := ParseChartRef(in)
+		assert.Error(t, err, in)
+	}
+}
+
+func TestLatest(t *testing.T) {
+	assert.Equal(t, 2, latest([]string{"1.9.0", "v1.10", "1.10.1", "2.0.0-rc.1", "latest", "01.2.3"}))
+	assert.Equal(t, 0, latest([]string{"0.1.0+build.7", "0.1.0-beta"}))
+	assert.Equal(t, -1, latest([]string{"1.0.0-alpha", "main"}))
+	assert.Equal(t, -1, latest(nil))
+}
+
+func TestNewer(t *testing.T) {
+	assert.True(t, Newer("1.10.0", "1.9.3"))
+	assert.True(t, Newer("v2", "1.99.0"))
+	assert.True(t, Newer("1.0.0", "1.0.0-rc.1"))
+	assert.False(t, Newer("1.2.0", "1.3.0"))
+	assert.False(t, Newer("1.2.0+build.2", "1.2.0+build.1"))
+	assert.True(t, Newer("main", "1.0.0"), "incomparable versions that differ")
+	assert.False(t, Newer("main", "main"))
+}
@@ -0,0 +1,69 @@
+package helm
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// version is a parsed semantic version. As Helm does, a leading "v" and
+// missing minor or patch numbers are accepted ("v1.2" is 1.2.0).
+type version struct {
+	num [3]uint64
+	pre bool // has a pre-release suffix such as "-rc.1"
+}
+
+func parseVersion(s string) (version, bool) {
+	s = strings.TrimPrefix(s, "v")
+	s, _, _ = strings.Cut(s, "+") // build metadata does not affect precedence
+	s, pre, hasPre := strings.Cut(s, "-")
+	if hasPre && pre == "" {
+		return version{}, false
+	}
+
+	v := version{pre: hasPre}
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return version{}, false
+	}
+	for i, p := range parts {
+		n, err := strconv.ParseUint(p, 10, 64)
+		if err != nil || (len(p) > 1 && p[0] == '0') {
+			return version{}, false
+		}
+		v.num[i] = n
+	}
+	return v, true
+}
+
+// latest returns the index of the highest release version in versions, or
+// -1 if there is none. Pre-releases are ignored, as by helm without
+// --devel, as are strings that are not versions.
+func latest(versions []string) int {
+	best := -1
+	var bestV version
+	for i, s := range versions {
+		v, ok := parseVersion(s)
+		if !ok || v.pre {
+			continue
+		}
+		if best < 0 || slices.Compare(v.num[:], bestV.num[:]) > 0 {
+			best, bestV = i, v
+		}
+	}
+	return best
+}
+
+// Newer reports whether version v is higher than old. Versions that cannot
+// be compared are newer if they differ, so that they are not missed.
+func Newer(v, old string) bool {
+	a, okA := parseVersion(v)
+	b, okB := parseVersion(old)
+	if !okA || !okB {
+		return v != old
+	}
+	if c := slices.Compare(a.num[:], b.num[:]); c != 0 {
+		return c > 0
+	}
+	return !a.pre && b.pre
+}
@@ -0,0 +1,304 @@
+// Package httpcache provides an http.RoundTripper that revalidates GET
+// responses against an on-disk cache with conditional requests.
+package httpcache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxBody is the largest response body that is cached.
+const maxBody = 4 << 20
+
+// storedHeaders are the response headers kept with a cached body.
+var storedHeaders = []string{
+	"Content-Type",
+	"ETag",
+	"Last-Modified",
+	"Docker-Content-Digest",
+}
+
+// keyHeaders are the request headers cache entries are kept apart by: the
+// accepted media types and the credentials a response was served for.
+var keyHeaders = []string{"Accept", "Authorization", "Cookie"}
+
+// manifestPath matches OCI distribution manifest URLs, /v2/<name>/manifests/<reference>.
+var manifestPath = regexp.MustCompile(`^/v2/.+/manifests/[^/]+$`)
+
+// Transport serves GET requests from a cache directory when the server
+// confirms the cached response is still current:
+//
+//   - Responses with an ETag or Last-Modified header are stored, and later
+//     requests for the same URL are sent with If-None-Match or
+//     If-Modified-Since. A 304 is answered with the cached response, so
+//     callers always see a complete 200.
+//   - For OCI manifests with a Docker-Content-Digest, a HEAD request is sent
+//     first; if the digest is unchanged the GET is skipped entirely.
+//
+// Entries are kept per credential, as sent in the Authorization and Cookie
+// headers. Requests sending a username and password, such as those for
+// registry tokens, are never cached, nor are responses marked no-store or
+// private or varying on other request headers. Other requests pass through
+// unchanged.
+type Transport struct {
+	next   http.RoundTripper
+	dir    string
+	logger *slog.Logger
+	now    func() time.Time
+}
+
+// Option is a functional option for Transport.
+type Option func(*Transport)
+
+// WithLogger sets the logger for cache diagnostics (default slog.Default()).
+func WithLogger(l *slog.Logger) Option {
+	return func(t *Transport) {
+		t.logger = l
+	}
+}
+
+// NewTransport creates a Transport caching in dir, which is created on
+// first use. Requests are sent through next, or http.DefaultTransport if nil.
+func NewTransport(next http.RoundTripper, dir string, opts ...Option) *Transport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	t := &Transport{next: next, dir: dir, logger: slog.Default(), now: time.Now}
+	for _, o := range opts {
+		o(t)
+	}
+	return t
+}
+
+// entry is a cached response as stored on disk.
+type entry struct {
+	URL      string      `json:"url"`
+	Header   http.Header `json:"header"`
+	Body     []byte      `json:"body"`
+	StoredAt time.Time   `json:"stored_at"`
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || sendsPassword(req) {
+		return t.next.RoundTrip(req)
+	}
+
+	path := t.path(req)
+	cached, err := t.load(path)
+	if err != nil {
+		t.logger.Warn("http cache: ignoring unreadable entry", "path", path, "err", err)
+	}
+
+	if cached != nil && manifestPath.MatchString(req.URL.Path) && cached.Header.Get("Docker-Content-Digest") != "" {
+		if t.manifestUnchanged(req, cached) {
+			t.logger.Debug("http cache: manifest digest unchanged", "url", cached.URL)
+			return cached.response(req), nil
+		}
+	}
+
+	out := req
+	if cached != nil && req.Header.Get("If-None-Match") == "" && req.Header.Get("If-Modified-Since") == "" {
+		out = req.Clone(req.Context())
+		if etag := cached.Header.Get("ETag"); etag != "" {
+			out.Header.Set("If-None-Match", etag)
+		}
+		if lm := cached.Header.Get("Last-Modified"); lm != "" {
+			out.Header.Set("If-Modified-Since", lm)
+		}
+	}
+
+	resp, err := t.next.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil && out != req:
+		drain(resp)
+		t.logger.Debug("http cache: not modified", "url", cached.URL)
+		return cached.response(req), nil
+	case resp.StatusCode == http.StatusOK && cacheable(resp.Header):
+		return t.store(path, req, resp)
+	case (resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusNotFound) && cached != nil:
+		t.remove(path)
+	}
+	return resp, nil
+}
+
+// sendsPassword reports whether req carries a username and password, which
+// only token endpoints and registries without token auth ask for.
+func sendsPassword(req *http.Request) bool {
+	if req.URL.User != nil {
+		return true
+	}
+	scheme, _, _ := strings.Cut(req.Header.Get("Authorization"), " ")
+	return strings.EqualFold(scheme, "Basic")
+}
+
+// manifestUnchanged reports whether a HEAD request for the manifest returns
+// the cached digest.
+func (t *Transport) manifestUnchanged(req *http.Request, cached *entry) bool {
+	head := req.Clone(req.Context())
+	head.Method = http.MethodHead
+	resp, err := t.next.RoundTrip(head)
+	if err != nil {
+		return false
+	}
+	drain(resp)
+	return resp.StatusCode == http.StatusOK &&
+		resp.Header.Get("Docker-Content-Digest") == cached.Header.Get("Docker-Content-Digest")
+}
+
+// cacheable reports whether a response with headers h can be stored and
+// revalidated.
+func cacheable(h http.Header) bool {
+	for _, directive := range headerTokens(h, "Cache-Control") {
+		name, _, _ := strings.Cut(directive, "=")
+		if strings.EqualFold(name, "no-store") || strings.EqualFold(name, "private") {
+			return false
+		}
+	}
+	for _, name := range headerTokens(h, "Vary") {
+		if !slices.Contains(keyHeaders, http.CanonicalHeaderKey(name)) {
+			return false // includes "*"
+		}
+	}
+	return h.Get("ETag") != "" || h.Get("Last-Modified") != "" || h.Get("Docker-Content-Digest") != ""
+}
+
+// headerTokens returns the comma-separated elements of the header name.
+func headerTokens(h http.Header, name string) []string {
+	var tokens []string
+	for _, v := range h.Values(name) {
+		for tok := range strings.SplitSeq(v, ",") {
+			if tok = strings.TrimSpace(tok); tok != "" {
+				tokens = append(tokens, tok)
+			}
+		}
+	}
+	return tokens
+}
+
+// store reads the body of resp, writes it to the cache and returns a
+// response replaying it. Bodies over maxBody are passed through uncached.
+func (t *Transport) store(path string, req *http.Request, resp *http.Response) (*http.Response, error) {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBody+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	rest := resp.Body
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), rest), rest}
+	if len(body) > maxBody {
+		return resp, nil
+	}
+
+	e := entry{
+		URL:      req.URL.String(),
+		Header:   make(http.Header),
+		Body:     body,
+		StoredAt: t.now().UTC(),
+	}
+	for _, name := range storedHeaders {
+		for _, v := range resp.Header.Values(name) {
+			e.Header.Add(name, v)
+		}
+	}
+	if err := t.write(path, &e); err != nil {
+		t.logger.Warn("http cache: store failed", "path", path, "err", err)
+	}
+	return resp, nil
+}
+
+// path returns the cache file for req. Requests for the same URL with
+// different keyHeaders (e.g. manifest media types or tokens) are kept apart;
+// as the file name is a hash, credentials are not written to disk.
+func (t *Transport) path(req *http.Request) string {
+	h := sha256.New()
+	io.WriteString(h, req.URL.String())
+	for _, name := range keyHeaders {
+		fmt.Fprintf(h, "\n%s: %s", name, strings.Join(req.Header.Values(name), ", "))
+	}
+	return filepath.Join(t.dir, hex.EncodeToString(h.Sum(nil))+".json")
+}
+
+func (t *Transport) load(path string) (*entry, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("httpcache: read %s: %w", path, err)
+	}
+	var e entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, fmt.Errorf("httpcache: parse %s: %w", path, err)
+	}
+	return &e, nil
+}
+
+// write stores e atomically. Entries may hold private registry data, so
+// they are only readable by the owner.
+func (t *Transport) write(path string, e *entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("httpcache: marshal: %w", err)
+	}
+	if err := os.MkdirAll(t.dir, 0o700); err != nil {
+		return fmt.Errorf("httpcache: create %s: %w", t.dir, err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("httpcache: write tmp %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("httpcache: rename %s -> %s: %w", tmp, path, err)
+	}
+	return nil
+}
+
+func (t *Transport) remove(path string) {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		t.logger.Warn("http cache: remove failed", "path", path, "err", err)
+	}
+}
+
+// response replays the cached entry as a 200 response to req.
+func (e *entry) response(req *http.Request) *http.Response {
+	header := e.Header.Clone()
+	header.Set("Content-Length", strconv.Itoa(len(e.Body)))
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+func drain(resp *http.Response) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+}
@@ -0,0 +1,293 @@
+package httpcache
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func get(t *testing.T, client *http.Client, url string) (int, string) {
+	t.Helper()
+	resp, err := client.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(body)
+}
+
+func TestTransport_ETagRevalidation(t *testing.T) {
+	var full, notModified atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full.Add(1)
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"digest":"sha256:abc"}`))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	client := &http.Client{Transport: NewTransport(server.Client().Transport, dir)}
+	for range 2 {
+		code, body := get(t, client, server.URL+"/v2/repositories/library/php/tags/8")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, `{"digest":"sha256:abc"}`, body)
+	}
+
+	// A new transport on the same directory, as in the next cron run.
+	client = &http.Client{Transport: NewTransport(server.Client().Transport, dir)}
+	code, body := get(t, client, server.URL+"/v2/repositories/library/php/tags/8")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, `{"digest":"sha256:abc"}`, body)
+
+	assert.Equal(t, int32(1), full.Load())
+	assert.Equal(t, int32(2), notModified.Load())
+}
+
+func TestTransport_LastModifiedRevalidation(t *testing.T) {
+	const lastModified = "Wed, 04 Feb 2026 17:56:28 GMT"
+	var conditional atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-Modified-Since") == lastModified {
+			conditional.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Last-Modified", lastModified)
+		w.Write([]byte("v1"))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewTransport(server.Client().Transport, t.TempDir())}
+	get(t, client, server.URL)
+	_, body := get(t, client, server.URL)
+	assert.Equal(t, "v1", body)
+	assert.Equal(t, int32(1), conditional.Load())
+}
+
+func TestTransport_ChangedResourceReplacesEntry(t *testing.T) {
+	var version atomic.Int32
+	version.Store(1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		etag := `"v` + string(rune('0'+version.Load())) + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(etag))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewTransport(server.Client().Transport, t.TempDir())}
+	_, body := get(t, client, server.URL)
+	assert.Equal(t, `"v1"`, body)
+	version.Store(2)
+	_, body = get(t, client, server.URL)
+	assert.Equal(t, `"v2"`, body)
+	_, body = get(t, client, server.URL)
+	assert.Equal(t, `"v2"`, body)
+}
+
+func TestTransport_ManifestHeadSkipsGet(t *testing.T) {
+	var gets, heads atomic.Int32
+	digest := "sha256:1111"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Docker-Content-Digest", digest)
+		if r.Method == http.MethodHead {
+			heads.Add(1)
+			return
+		}
+		gets.Add(1)
+		w.Write([]byte(`{"schemaVersion":2,"digest":"` + digest + `"}`))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewTransport(server.Client().Transport, t.TempDir())}
+	url := server.URL + "/v2/library/php/manifests/8"
+	get(t, client, url)
+	_, body := get(t, client, url)
+	assert.Contains(t, body, "sha256:1111")
+	assert.Equal(t, int32(1), gets.Load())
+	assert.Equal(t, int32(1), heads.Load())
+
+	digest = "sha256:2222"
+	_, body = get(t, client, url)
+	assert.Contains(t, body, "sha256:2222")
+	assert.Equal(t, int32(2), gets.Load())
+	assert.Equal(t, int32(2), heads.Load())
+}
+
+func TestTransport_NotFoundDropsEntry(t *testing.T) {
+	var gone atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if gone.Load() {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("v1"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	client := &http.Client{Transport: NewTransport(server.Client().Transport, dir)}
+	get(t, client, server.URL)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	info, err := entries[0].Info()
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	gone.Store(true)
+	code, _ := get(t, client, server.URL)
+	assert.Equal(t, http.StatusNotFound, code)
+	entries, err = os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestTransport_UncacheableAndNonGetPassThrough(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		assert.Empty(t, r.Header.Get("If-None-Match"))
+		w.Write([]byte("x"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	client := &http.Client{Transport: NewTransport(server.Client().Transport, dir)}
+	get(t, client, server.URL)
+	get(t, client, server.URL)
+	resp, err := client.Post(server.URL, "text/plain", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, int32(3), calls.Load())
+	entries, err := os.ReadDir(dir)
+	if err == nil {
+		assert.Empty(t, entries)
+	}
+}
+
+func TestTransport_NoStoreAndPrivateNotCached(t *testing.T) {
+	for _, cc := range []string{"no-store", "private, max-age=0", "max-age=60, No-Store"} {
+		t.Run(cc, func(t *testing.T) {
+			var conditional atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("If-None-Match") != "" {
+					conditional.Add(1)
+				}
+				w.Header().Set("ETag", `"v1"`)
+				w.Header().Set("Cache-Control", cc)
+				w.Write([]byte("v1"))
+			}))
+			defer server.Close()
+
+			dir := t.TempDir()
+			client := &http.Client{Transport: NewTransport(server.Client().Transport, dir)}
+			get(t, client, server.URL)
+			get(t, client, server.URL)
+			assert.Zero(t, conditional.Load())
+			entries, err := os.ReadDir(dir)
+			if err == nil {
+				assert.Empty(t, entries)
+			}
+		})
+	}
+}
+
+func TestTransport_PasswordRequestsNotCached(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		assert.Empty(t, r.Header.Get("If-None-Match"))
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(`{"token":"secret"}`))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	client := &http.Client{Transport: NewTransport(server.Client().Transport, dir)}
+	for range 2 {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/token?scope=repository:org/img:pull", nil)
+		require.NoError(t, err)
+		req.SetBasicAuth("user", "pass")
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	assert.Equal(t, int32(2), calls.Load())
+	entries, err := os.ReadDir(dir)
+	if err == nil {
+		assert.Empty(t, entries)
+	}
+}
+
+func TestTransport_KeyedByCredentials(t *testing.T) {
+	var full, notModified atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") != "" {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full.Add(1)
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("for " + r.Header.Get("Authorization")))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewTransport(server.Client().Transport, t.TempDir())}
+	fetch := func(token string) string {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/v2/org/img/tags/list", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	assert.Equal(t, "for Bearer a", fetch("a"))
+	assert.Equal(t, "for Bearer b", fetch("b"), "another token must not revalidate a's entry")
+	assert.Equal(t, "for Bearer a", fetch("a"))
+	assert.Equal(t, int32(2), full.Load())
+	assert.Equal(t, int32(1), notModified.Load())
+}
+
+func TestTransport_VaryOnOtherHeaderNotCached(t *testing.T) {
+	var conditional atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") != "" {
+			conditional.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Vary", "accept, X-Tenant")
+		w.Write([]byte("v1"))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewTransport(server.Client().Transport, t.TempDir())}
+	get(t, client, server.URL)
+	get(t, client, server.URL)
+	assert.Zero(t, conditional.Load())
+}
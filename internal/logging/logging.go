@@ -0,0 +1,157 @@
+// Package logging sets up slog loggers and provides HTTP request logging
+// with secrets redacted from URLs and headers.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Redacted replaces secret values in logged URLs and headers.
+const Redacted = "REDACTED"
+
+// ParseLevel parses "debug", "info", "warn" or "error".
+func ParseLevel(s string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("logging: invalid level %q", s)
+	}
+	return l, nil
+}
+
+// New creates a logger writing to w in the given format ("text" or "json").
+func New(w io.Writer, level slog.Level, format string) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level}
+	switch format {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("logging: invalid format %q", format)
+}
+
+// sensitiveQuery are query parameters whose values are never logged,
+// compared case-insensitively. Parameters containing "token", "secret",
+// "password" or "signature" are redacted as well.
+var sensitiveQuery = map[string]bool{
+	"key":              true,
+	"x-amz-credential": true,
+	"code":             true,
+}
+
+// sensitiveHeaders are headers whose values are never logged, in canonical form.
+var sensitiveHeaders = map[string]bool{
+	"Authorization":        true,
+	"Proxy-Authorization":  true,
+	"Cookie":               true,
+	"Set-Cookie":           true,
+	"X-Registry-Auth":      true,
+	"X-Amz-Security-Token": true,
+	"Private-Token":        true,
+	"Job-Token":            true,
+}
+
+func sensitiveName(name string) bool {
+	lower := strings.ToLower(name)
+	for _, s := range []string{"token", "secret", "password", "signature"} {
+		if strings.Contains(lower, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactURL returns u as a string with the userinfo password and the values
+// of sensitive query parameters replaced by Redacted.
+func RedactURL(u *url.URL) string {
+	r := *u
+	if r.User != nil {
+		if _, ok := r.User.Password(); ok {
+			r.User = url.UserPassword(r.User.Username(), Redacted)
+		}
+	}
+	if r.RawQuery != "" {
+		q := r.Query()
+		for name, values := range q {
+			if sensitiveQuery[strings.ToLower(name)] || sensitiveName(name) {
+				for i := range values {
+					values[i] = Redacted
+				}
+			}
+		}
+		r.RawQuery = q.Encode()
+	}
+	return r.String()
+}
+
+// RedactHeaders returns a copy of h with the values of sensitive headers
+// replaced by Redacted.
+func RedactHeaders(h http.Header) http.Header {
+	out := make(http.Header, len(h))
+	for name, values := range h {
+		if sensitiveHeaders[http.CanonicalHeaderKey(name)] || sensitiveName(name) {
+			out[name] = []string{Redacted}
+			continue
+		}
+		out[name] = values
+	}
+	return out
+}
+
+type hidePathKey struct{}
+
+// WithHiddenPath marks requests made with ctx as carrying secrets in their
+// URL path (e.g. chat webhook URLs), so only scheme and host are logged.
+func WithHiddenPath(ctx context.Context) context.Context {
+	return context.WithValue(ctx, hidePathKey{}, true)
+}
+
+func logURL(req *http.Request) string {
+	if hide, _ := req.Context().Value(hidePathKey{}).(bool); hide {
+		return req.URL.Scheme + "://" + req.URL.Host + "/" + Redacted
+	}
+	return RedactURL(req.URL)
+}
+
+// Transport returns an http.RoundTripper that logs every request made
+// through next at debug level with method, redacted URL and headers,
+// status and latency.
+func Transport(next http.RoundTripper, logger *slog.Logger) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		ctx := req.Context()
+		if !logger.Enabled(ctx, slog.LevelDebug) {
+			return next.RoundTrip(req)
+		}
+
+		start := time.Now()
+		resp, err := next.RoundTrip(req)
+		attrs := []slog.Attr{
+			slog.String("method", req.Method),
+			slog.String("url", logURL(req)),
+			slog.Any("headers", RedactHeaders(req.Header)),
+			slog.Duration("latency", time.Since(start)),
+		}
+		if err != nil {
+			logger.LogAttrs(ctx, slog.LevelDebug, "http request failed", append(attrs, slog.Any("err", err))...)
+			return resp, err
+		}
+		logger.LogAttrs(ctx, slog.LevelDebug, "http request", append(attrs, slog.Int("status", resp.StatusCode))...)
+		return resp, nil
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
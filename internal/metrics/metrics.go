@@ -0,0 +1,178 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// checkBuckets are the upper bounds in seconds of the check duration
+// histogram. A check is at least one registry round trip.
+var checkBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Metrics are the registry-ping metrics. All methods are safe to call on a
+// nil *Metrics, which records nothing.
+type Metrics struct {
+	registry *Registry
+
+	lastPushed          *GaugeVec
+	lastSuccess         *GaugeVec
+	chartReleased       *GaugeVec
+	chartSuccess        *GaugeVec
+	checkDuration       *HistogramVec
+	fetchErrors         *CounterVec
+	notificationsSent   *CounterVec
+	notificationsFailed *CounterVec
+	httpRequests        *CounterVec
+	lastRun             *GaugeVec
+	lastRunSuccess      *GaugeVec
+}
+
+// New creates Metrics backed by a new Registry.
+func New() *Metrics {
+	r := NewRegistry()
+	return &Metrics{
+		registry: r,
+		lastPushed: r.NewGaugeVec("registry_ping_image_last_pushed_timestamp_seconds",
+			"Time the image tag was last pushed, as reported by its registry.", "ref", "registry"),
+		lastSuccess: r.NewGaugeVec("registry_ping_image_last_success_timestamp_seconds",
+			"Time of the last successful check of the image tag.", "ref", "registry"),
+		chartReleased: r.NewGaugeVec("registry_ping_chart_last_released_timestamp_seconds",
+			"Time the latest release of the Helm chart was published.", "ref", "registry"),
+		chartSuccess: r.NewGaugeVec("registry_ping_chart_last_success_timestamp_seconds",
+			"Time of the last successful check of the Helm chart.", "ref", "registry"),
+		checkDuration: r.NewHistogramVec("registry_ping_check_duration_seconds",
+			"Duration of a single image or chart check.", checkBuckets, "registry"),
+		fetchErrors: r.NewCounterVec("registry_ping_fetch_errors_total",
+			"Failed image and chart fetches by error class.", "registry", "class"),
+		notificationsSent: r.NewCounterVec("registry_ping_notifications_sent_total",
+			"Notifications delivered, by notifier.", "notifier"),
+		notificationsFailed: r.NewCounterVec("registry_ping_notifications_failed_total",
+			"Failed notification attempts, by notifier.", "notifier"),
+		httpRequests: r.NewCounterVec("registry_ping_http_requests_total",
+			"HTTP requests made to registries, by host and status code.", "host", "code"),
+		lastRun: r.NewGaugeVec("registry_ping_last_run_timestamp_seconds",
+			"Time the last check run finished."),
+		lastRunSuccess: r.NewGaugeVec("registry_ping_last_run_success",
+			"Whether the last check run completed without errors (1) or not (0)."),
+	}
+}
+
+// Registry returns the underlying Registry, for serving or writing the metrics.
+func (m *Metrics) Registry() *Registry {
+	return m.registry
+}
+
+// RegistryLabel returns the registry label value for an image host;
+// Docker Hub ("") is reported as "docker.io".
+func RegistryLabel(host string) string {
+	if host == "" {
+		return "docker.io"
+	}
+	return host
+}
+
+func unix(t time.Time) float64 {
+	return float64(t.UnixNano()) / 1e9
+}
+
+// ImagePushed records the last pushed time of ref.
+func (m *Metrics) ImagePushed(ref, host string, pushed time.Time) {
+	if m == nil || pushed.IsZero() {
+		return
+	}
+	m.lastPushed.Set(unix(pushed), ref, RegistryLabel(host))
+}
+
+// CheckSucceeded records a successful check of ref at t.
+func (m *Metrics) CheckSucceeded(ref, host string, t time.Time) {
+	if m == nil {
+		return
+	}
+	m.lastSuccess.Set(unix(t), ref, RegistryLabel(host))
+}
+
+// ChartReleased records when the latest release of the chart ref was
+// published.
+func (m *Metrics) ChartReleased(ref, host string, created time.Time) {
+	if m == nil || created.IsZero() {
+		return
+	}
+	m.chartReleased.Set(unix(created), ref, RegistryLabel(host))
+}
+
+// ChartCheckSucceeded records a successful check of the chart ref at t.
+func (m *Metrics) ChartCheckSucceeded(ref, host string, t time.Time) {
+	if m == nil {
+		return
+	}
+	m.chartSuccess.Set(unix(t), ref, RegistryLabel(host))
+}
+
+// CheckDuration records how long a check against host took.
+func (m *Metrics) CheckDuration(host string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.checkDuration.Observe(d.Seconds(), RegistryLabel(host))
+}
+
+// FetchError counts a failed fetch from host with the given error class.
+func (m *Metrics) FetchError(host, class string) {
+	if m == nil {
+		return
+	}
+	m.fetchErrors.Inc(RegistryLabel(host), class)
+}
+
+// Notification counts a delivery attempt to the named notifier.
+func (m *Metrics) Notification(notifier string, err error) {
+	if m == nil {
+		return
+	}
+	if err != nil {
+		m.notificationsFailed.Inc(notifier)
+		return
+	}
+	m.notificationsSent.Inc(notifier)
+}
+
+// RunFinished records the end of a check run.
+func (m *Metrics) RunFinished(t time.Time, err error) {
+	if m == nil {
+		return
+	}
+	m.lastRun.Set(unix(t))
+	if err != nil {
+		m.lastRunSuccess.Set(0)
+		return
+	}
+	m.lastRunSuccess.Set(1)
+}
+
+// Transport returns an http.RoundTripper that counts every request made
+// through next by host and status code ("error" if no response was
+// received). It is used to wrap the scrapers' HTTP client.
+func (m *Metrics) Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if m == nil {
+		return next
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		resp, err := next.RoundTrip(req)
+		code := "error"
+		if err == nil {
+			code = strconv.Itoa(resp.StatusCode)
+		}
+		m.httpRequests.Inc(req.URL.Host, code)
+		return resp, err
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_WriteText(t *testing.T) {
+	r := NewRegistry()
+	g := r.NewGaugeVec("test_gauge", "A gauge.", "ref")
+	c := r.NewCounterVec("test_total", "A counter.", "class")
+	h := r.NewHistogramVec("test_seconds", "A histogram.", []float64{0.5, 1}, "registry")
+
+	g.Set(2, `php:8 "quoted"`)
+	g.Set(1.5, "nginx:1")
+	c.Inc("timeout")
+	c.Inc("timeout")
+	h.Observe(0.2, "docker.io")
+	h.Observe(0.5, "docker.io")
+	h.Observe(3, "docker.io")
+
+	var buf bytes.Buffer
+	require.NoError(t, r.WriteText(&buf))
+	assert.Equal(t, `# HELP test_gauge A gauge.
+# TYPE test_gauge gauge
+test_gauge{ref="nginx:1"} 1.5
+test_gauge{ref="php:8 \"quoted\""} 2
+# HELP test_total A counter.
+# TYPE test_total counter
+test_total{class="timeout"} 2
+# HELP test_seconds A histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{registry="docker.io",le="0.5"} 2
+test_seconds_bucket{registry="docker.io",le="1"} 2
+test_seconds_bucket{registry="docker.io",le="+Inf"} 3
+test_seconds_sum{registry="docker.io"} 3.7
+test_seconds_count{registry="docker.io"} 3
+`, buf.String())
+}
+
+func TestRegistry_UnlabelledGauge(t *testing.T) {
+	r := NewRegistry()
+	r.NewGaugeVec("up", "Up.").Set(1)
+
+	var buf bytes.Buffer
+	require.NoError(t, r.WriteText(&buf))
+	assert.Contains(t, buf.String(), "\nup 1\n")
+}
+
+func TestRegistry_WriteFile(t *testing.T) {
+	r := NewRegistry()
+	r.NewGaugeVec("up", "Up.").Set(1)
+	path := filepath.Join(t.TempDir(), "registry_ping.prom")
+
+	require.NoError(t, r.WriteFile(path))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "up 1")
+	_, err = os.Stat(path + ".tmp")
+	assert.True(t, os.IsNotExist(err), "tmp file should have been renamed away")
+}
+
+func TestMetrics_Transport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	m := New()
+	client := &http.Client{Transport: m.Transport(server.Client().Transport)}
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	rec := httptest.NewRecorder()
+	m.Registry().Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/plain")
+	assert.Contains(t, rec.Body.String(),
+		`registry_ping_http_requests_total{host="`+server.Listener.Addr().String()+`",code="429"} 1`)
+}
+
+func TestMetrics_NilSafe(t *testing.T) {
+	var m *Metrics
+	m.FetchError("", "timeout")
+	m.Notification("ops", nil)
+	assert.Equal(t, http.DefaultTransport, m.Transport(nil))
+}
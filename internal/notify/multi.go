@@ -0,0 +1,51 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+)
+
+// DefaultSinkName is the sink name used for a notifier that was not given one.
+const DefaultSinkName = "default"
+
+// Sink is a Notifier with a stable name. The name identifies the notifier in
+// the persisted outbox, so it must not change between runs.
+type Sink struct {
+	Name     string
+	Notifier Notifier
+}
+
+// Multi fans out every event to a set of named sinks.
+type Multi struct {
+	sinks []Sink
+}
+
+// NewMulti creates a Multi notifying the given sinks in order.
+func NewMulti(sinks ...Sink) *Multi {
+	return &Multi{sinks: sinks}
+}
+
+// Sinks returns the sinks of m.
+func (m *Multi) Sinks() []Sink {
+	return m.sinks
+}
+
+// Notify sends event to every sink and returns the combined errors.
+func (m *Multi) Notify(event ChangeEvent) error {
+	var errs []error
+	for _, s := range m.sinks {
+		if err := s.Notifier.Notify(event); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SinksOf returns the sinks of n if it is a *Multi, or n as the single sink
+// DefaultSinkName otherwise.
+func SinksOf(n Notifier) []Sink {
+	if m, ok := n.(*Multi); ok {
+		return m.Sinks()
+	}
+	return []Sink{{Name: DefaultSinkName, Notifier: n}}
+}
@@ -6,12 +6,30 @@ import (
 	"github.com/wutscho/registry-ping/internal/registry"
 )
 
-// ChangeEvent describes a detected change for a single image tag.
+// ChangeEvent describes a detected change for a single image tag, or a new
+// release of a Helm chart.
 type ChangeEvent struct {
-	Ref         registry.ImageRef
+	Ref registry.ImageRef
+	// Chart is set instead of Ref for a chart release, e.g.
+	// "oci://ghcr.io/org/charts/app".
+	Chart       string
 	OldPushed   time.Time
 	NewPushed   time.Time
 	IsFirstSeen bool
+	// OldVersion and NewVersion are the chart versions, OldAppVersion and
+	// NewAppVersion the app versions they package. Only set for charts.
+	OldVersion    string
+	NewVersion    string
+	OldAppVersion string
+	NewAppVersion string
+}
+
+// Subject returns the chart ref or image ref the event is about.
+func (e ChangeEvent) Subject() string {
+	if e.Chart != "" {
+		return e.Chart
+	}
+	return e.Ref.String()
 }
 
 // Notifier is called for each detected change.
@@ -13,6 +13,16 @@ func NewStdoutNotifier() *StdoutNotifier {
 
 // Notify prints the change event to stdout.
 func (n *StdoutNotifier) Notify(event ChangeEvent) error {
+	if event.Chart != "" {
+		if event.IsFirstSeen {
+			fmt.Printf("[NEW]     %s  version=%s app_version=%s\n",
+				event.Chart, event.NewVersion, event.NewAppVersion)
+		} else {
+			fmt.Printf("[UPDATED] %s  %s -> %s (app %s -> %s)\n",
+				event.Chart, event.OldVersion, event.NewVersion, event.OldAppVersion, event.NewAppVersion)
+		}
+		return nil
+	}
 	if event.IsFirstSeen {
 		fmt.Printf("[NEW]     %s  last_pushed=%s\n",
 			event.Ref.String(),
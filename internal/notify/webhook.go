@@ -0,0 +1,109 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/wutscho/registry-ping/internal/logging"
+)
+
+// WebhookNotifier POSTs each change event as JSON to a URL.
+type WebhookNotifier struct {
+	client  *http.Client
+	url     string
+	headers map[string]string
+	logger  *slog.Logger
+}
+
+// WebhookOption is a functional option for WebhookNotifier.
+type WebhookOption func(*WebhookNotifier)
+
+// WithLogger sets the logger for delivery diagnostics (default slog.Default()).
+func WithLogger(l *slog.Logger) WebhookOption {
+	return func(n *WebhookNotifier) {
+		n.logger = l
+	}
+}
+
+// NewWebhookNotifier creates a WebhookNotifier posting to url. headers are
+// added to every request (e.g. an Authorization header).
+//
+// Webhook URLs often embed a secret in their path, so only the scheme and
+// host of url ever appear in logs and errors.
+func NewWebhookNotifier(client *http.Client, url string, headers map[string]string, opts ...WebhookOption) *WebhookNotifier {
+	n := &WebhookNotifier{client: client, url: url, headers: headers, logger: slog.Default()}
+	for _, o := range opts {
+		o(n)
+	}
+	return n
+}
+
+type webhookPayload struct {
+	Ref           string     `json:"ref"`
+	OldPushed     *time.Time `json:"old_pushed,omitempty"`
+	NewPushed     time.Time  `json:"new_pushed"`
+	IsFirstSeen   bool       `json:"is_first_seen"`
+	Chart         bool       `json:"chart,omitempty"`
+	OldVersion    string     `json:"old_version,omitempty"`
+	NewVersion    string     `json:"new_version,omitempty"`
+	OldAppVersion string     `json:"old_app_version,omitempty"`
+	NewAppVersion string     `json:"new_app_version,omitempty"`
+}
+
+// Notify posts the event. For a chart, ref is the chart ref and the chart
+// and app versions are included. Any non-2xx response is an error.
+func (n *WebhookNotifier) Notify(event ChangeEvent) error {
+	payload := webhookPayload{
+		Ref:           event.Subject(),
+		NewPushed:     event.NewPushed.UTC(),
+		IsFirstSeen:   event.IsFirstSeen,
+		Chart:         event.Chart != "",
+		OldVersion:    event.OldVersion,
+		NewVersion:    event.NewVersion,
+		OldAppVersion: event.OldAppVersion,
+		NewAppVersion: event.NewAppVersion,
+	}
+	if !event.OldPushed.IsZero() {
+		old := event.OldPushed.UTC()
+		payload.OldPushed = &old
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("webhook: marshal: %w", err)
+	}
+
+	ctx := logging.WithHiddenPath(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("webhook: create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range n.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			uerr.URL = req.URL.Scheme + "://" + req.URL.Host + "/" + logging.Redacted
+		}
+		return fmt.Errorf("webhook: post: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	n.logger.Debug("webhook: posted", "ref", payload.Ref, "host", req.URL.Host, "status", resp.StatusCode)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook: unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wutscho/registry-ping/internal/registry"
+)
+
+func TestWebhookNotifier_Notify(t *testing.T) {
+	var got map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	n := NewWebhookNotifier(server.Client(), server.URL, map[string]string{"Authorization": "Bearer secret"})
+	err := n.Notify(ChangeEvent{
+		Ref:       registry.ImageRef{Namespace: "library", Name: "php", Tag: "8.2.30-fpm"},
+		OldPushed: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		NewPushed: time.Date(2026, 2, 4, 17, 56, 28, 0, time.UTC),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "php:8.2.30-fpm", got["ref"])
+	assert.Equal(t, "2026-01-01T00:00:00Z", got["old_pushed"])
+	assert.Equal(t, "2026-02-04T17:56:28Z", got["new_pushed"])
+	assert.Equal(t, false, got["is_first_seen"])
+}
+
+func TestWebhookNotifier_NotifyChart(t *testing.T) {
+	var got map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+	}))
+	defer server.Close()
+
+	n := NewWebhookNotifier(server.Client(), server.URL, nil)
+	err := n.Notify(ChangeEvent{
+		Chart:         "oci://ghcr.io/org/charts/app",
+		NewPushed:     time.Date(2026, 2, 4, 17, 56, 28, 0, time.UTC),
+		OldVersion:    "1.2.0",
+		NewVersion:    "1.3.0",
+		OldAppVersion: "4.1",
+		NewAppVersion: "4.2",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "oci://ghcr.io/org/charts/app", got["ref"])
+	assert.Equal(t, true, got["chart"])
+	assert.Equal(t, "1.2.0", got["old_version"])
+	assert.Equal(t, "1.3.0", got["new_version"])
+	assert.Equal(t, "4.1", got["old_app_version"])
+	assert.Equal(t, "4.2", got["new_app_version"])
+}
+
+func TestWebhookNotifier_ServerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	n := NewWebhookNotifier(server.Client(), server.URL, nil)
+	err := n.Notify(ChangeEvent{Ref: registry.ImageRef{Name: "php", Tag: "8"}, IsFirstSeen: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "502")
+}
+
+func TestWebhookNotifier_ErrorHidesURLPath(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := server.URL + "/services/T000/B000/XXXXSECRET"
+	server.Close()
+
+	n := NewWebhookNotifier(http.DefaultClient, url, nil)
+	err := n.Notify(ChangeEvent{Ref: registry.ImageRef{Name: "php", Tag: "8"}, IsFirstSeen: true})
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "XXXXSECRET")
+}
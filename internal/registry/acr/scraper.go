@@ -0,0 +1,291 @@
+// Package acr reads image metadata from Azure Container Registry through
+// its /acr/v1 metadata API.
+package acr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wutscho/registry-ping/internal/registry"
+)
+
+// ACRScraper fetches tag update times and digests from Azure Container
+// Registry (/acr/v1/<repo>/_tags/<tag>). It authenticates at the registry's
+// own token endpoints: /oauth2/exchange turns an Azure AD refresh token into
+// an ACR refresh token, /oauth2/token issues the access token per
+// repository.
+type ACRScraper struct {
+	client   *http.Client
+	baseURL  string
+	hosts    []string
+	username string
+	password string
+	aadToken string
+	tenant   string
+	logger   *slog.Logger
+
+	mu           sync.Mutex
+	refreshToken map[string]string // ACR refresh token per registry host
+	accessTokens map[string]string // access token per host and scope
+}
+
+// Option is a functional option for ACRScraper.
+type Option func(*ACRScraper)
+
+// WithBaseURL overrides the registry base URL, which defaults to
+// "https://<host>" of each image (useful for testing with httptest).
+func WithBaseURL(url string) Option {
+	return func(s *ACRScraper) {
+		s.baseURL = url
+	}
+}
+
+// WithHosts restricts CanHandle to the given hosts, e.g. to use different
+// credentials per registry.
+func WithHosts(hosts ...string) Option {
+	return func(s *ACRScraper) {
+		s.hosts = hosts
+	}
+}
+
+// WithBasicAuth authenticates as the registry's admin user or as a service
+// principal (application ID and client secret).
+func WithBasicAuth(username, password string) Option {
+	return func(s *ACRScraper) {
+		s.username = username
+		s.password = password
+	}
+}
+
+// WithAADRefreshToken authenticates with an Azure AD refresh token, which is
+// exchanged for an ACR refresh token. tenant may be empty.
+func WithAADRefreshToken(token, tenant string) Option {
+	return func(s *ACRScraper) {
+		s.aadToken = token
+		s.tenant = tenant
+	}
+}
+
+// WithLogger sets the logger for fetch diagnostics (default slog.Default()).
+func WithLogger(l *slog.Logger) Option {
+	return func(s *ACRScraper) {
+		s.logger = l
+	}
+}
+
+// NewACRScraper creates a new ACRScraper using the given HTTP client.
+// Without credentials, only registries with anonymous pull enabled can be
+// read.
+func NewACRScraper(client *http.Client, opts ...Option) *ACRScraper {
+	s := &ACRScraper{
+		client:       client,
+		logger:       slog.Default(),
+		refreshToken: make(map[string]string),
+		accessTokens: make(map[string]string),
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// CanHandle reports whether host is an Azure Container Registry, and one of
+// the configured hosts if any.
+func (s *ACRScraper) CanHandle(host string) bool {
+	if len(s.hosts) > 0 {
+		return slices.Contains(s.hosts, host)
+	}
+	return strings.HasSuffix(host, ".azurecr.io")
+}
+
+type tagResponse struct {
+	Tag struct {
+		Name           string    `json:"name"`
+		Digest         string    `json:"digest"`
+		CreatedTime    time.Time `json:"createdTime"`
+		LastUpdateTime time.Time `json:"lastUpdateTime"`
+	} `json:"tag"`
+}
+
+// Fetch retrieves the tag's last update time and digest.
+func (s *ACRScraper) Fetch(ctx context.Context, ref registry.ImageRef) (registry.ImageInfo, error) {
+	base := s.base(ref.Host)
+	u := fmt.Sprintf("%s/acr/v1/%s/_tags/%s", base, ref.Repository(), url.PathEscape(ref.Tag))
+	scope := "repository:" + ref.Repository() + ":metadata_read"
+
+	resp, err := s.get(ctx, ref.Host, u, scope)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized {
+		// The cached tokens expired; start over once.
+		resp.Body.Close()
+		s.forget(ref.Host, scope)
+		resp, err = s.get(ctx, ref.Host, u, scope)
+	}
+	if err != nil {
+		return registry.ImageInfo{}, fmt.Errorf("acr: fetch %s: %w", ref, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return registry.ImageInfo{}, fmt.Errorf("acr: %s: %w", ref, registry.ErrNotFound)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return registry.ImageInfo{}, fmt.Errorf("acr: %s: %w", ref, &registry.StatusError{Code: resp.StatusCode})
+	}
+
+	var data tagResponse
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return registry.ImageInfo{}, fmt.Errorf("acr: decode response for %s: %w", ref, &registry.DecodeError{Err: err})
+	}
+	pushed := data.Tag.LastUpdateTime
+	if pushed.IsZero() {
+		pushed = data.Tag.CreatedTime
+	}
+
+	s.logger.Debug("acr: fetched tag", "ref", ref.String(), "pushed", pushed, "digest", data.Tag.Digest)
+	return registry.ImageInfo{
+		Ref:        ref,
+		LastPushed: pushed.UTC(),
+		Digest:     data.Tag.Digest,
+	}, nil
+}
+
+func (s *ACRScraper) base(host string) string {
+	if s.baseURL != "" {
+		return strings.TrimSuffix(s.baseURL, "/")
+	}
+	return "https://" + host
+}
+
+// get sends a GET request with an access token for scope.
+func (s *ACRScraper) get(ctx context.Context, host, u, scope string) (*http.Response, error) {
+	token, err := s.accessToken(ctx, host, scope)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return s.client.Do(req)
+}
+
+func (s *ACRScraper) forget(host, scope string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.accessTokens, host+" "+scope)
+	delete(s.refreshToken, host)
+}
+
+// accessToken returns a cached access token for scope or requests one from
+// /oauth2/token: with an ACR refresh token if AAD credentials are set,
+// otherwise with basic credentials or anonymously.
+func (s *ACRScraper) accessToken(ctx context.Context, host, scope string) (string, error) {
+	key := host + " " + scope
+	s.mu.Lock()
+	token, ok := s.accessTokens[key]
+	s.mu.Unlock()
+	if ok {
+		return token, nil
+	}
+
+	var resp struct {
+		AccessToken string `json:"access_token"`
+	}
+	if s.aadToken != "" {
+		refresh, err := s.acrRefreshToken(ctx, host)
+		if err != nil {
+			return "", err
+		}
+		form := url.Values{
+			"grant_type":    {"refresh_token"},
+			"service":       {host},
+			"scope":         {scope},
+			"refresh_token": {refresh},
+		}
+		if err := s.post(ctx, s.base(host)+"/oauth2/token", form, &resp); err != nil {
+			return "", fmt.Errorf("token: %w", err)
+		}
+	} else {
+		q := url.Values{"service": {host}, "scope": {scope}}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.base(host)+"/oauth2/token?"+q.Encode(), nil)
+		if err != nil {
+			return "", err
+		}
+		if s.username != "" {
+			req.SetBasicAuth(s.username, s.password)
+		}
+		if err := s.do(req, &resp); err != nil {
+			return "", fmt.Errorf("token: %w", err)
+		}
+	}
+
+	s.mu.Lock()
+	s.accessTokens[key] = resp.AccessToken
+	s.mu.Unlock()
+	return resp.AccessToken, nil
+}
+
+// acrRefreshToken exchanges the AAD refresh token at /oauth2/exchange.
+func (s *ACRScraper) acrRefreshToken(ctx context.Context, host string) (string, error) {
+	s.mu.Lock()
+	token, ok := s.refreshToken[host]
+	s.mu.Unlock()
+	if ok {
+		return token, nil
+	}
+
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"service":       {host},
+		"refresh_token": {s.aadToken},
+	}
+	if s.tenant != "" {
+		form.Set("tenant", s.tenant)
+	}
+	var resp struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := s.post(ctx, s.base(host)+"/oauth2/exchange", form, &resp); err != nil {
+		return "", fmt.Errorf("exchange: %w", err)
+	}
+
+	s.mu.Lock()
+	s.refreshToken[host] = resp.RefreshToken
+	s.mu.Unlock()
+	return resp.RefreshToken, nil
+}
+
+// post sends a form to an /oauth2 endpoint. Exchanging credentials for a
+// token has no side effects, so failed posts are retried like GETs.
+func (s *ACRScraper) post(ctx context.Context, u string, form url.Values, out any) error {
+	req, err := http.NewRequestWithContext(registry.Idempotent(ctx), http.MethodPost, u, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return s.do(req, out)
+}
+
+func (s *ACRScraper) do(req *http.Request, out any) error {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &registry.StatusError{Code: resp.StatusCode}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return &registry.DecodeError{Err: err}
+	}
+	return nil
+}
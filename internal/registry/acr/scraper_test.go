@@ -0,0 +1,146 @@
+package acr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wutscho/registry-ping/internal/registry"
+)
+
+var app = registry.ImageRef{Host: "contoso.azurecr.io", Namespace: "team", Name: "app", Tag: "2.0"}
+
+const tagBody = `{"registry":"contoso.azurecr.io","imageName":"team/app","tag":{"name":"2.0",
+	"digest":"sha256:a1b2","createdTime":"2026-06-01T10:00:00Z","lastUpdateTime":"2026-06-03T12:30:00.5Z",
+	"signed":false,"changeableAttributes":{"deleteEnabled":true}}}`
+
+// fakeACR serves the token endpoints and the tag API. Access tokens are
+// "access-<n>" and only the latest one issued is accepted.
+type fakeACR struct {
+	check     func(r *http.Request) // validates token requests
+	issued    int
+	exchanges int
+}
+
+func (f *fakeACR) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/oauth2/exchange":
+		f.exchanges++
+		f.check(r)
+		_, _ = w.Write([]byte(`{"refresh_token":"acr-refresh"}`))
+	case "/oauth2/token":
+		f.check(r)
+		f.issued++
+		_, _ = w.Write([]byte(`{"access_token":"access-` + strconv.Itoa(f.issued) + `"}`))
+	case "/acr/v1/team/app/_tags/2.0":
+		if r.Header.Get("Authorization") != "Bearer access-"+strconv.Itoa(f.issued) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(tagBody))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newFake(t *testing.T, check func(r *http.Request)) (*fakeACR, *httptest.Server) {
+	t.Helper()
+	f := &fakeACR{check: check}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	return f, server
+}
+
+func TestFetch_BasicAuth(t *testing.T) {
+	_, server := newFake(t, func(r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, "contoso.azurecr.io", r.URL.Query().Get("service"))
+		assert.Equal(t, "repository:team/app:metadata_read", r.URL.Query().Get("scope"))
+		user, pass, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "contoso", user)
+		assert.Equal(t, "admin-password", pass)
+	})
+	s := NewACRScraper(server.Client(), WithBaseURL(server.URL), WithBasicAuth("contoso", "admin-password"))
+
+	info, err := s.Fetch(context.Background(), app)
+	require.NoError(t, err)
+	assert.Equal(t, app, info.Ref)
+	assert.Equal(t, "sha256:a1b2", info.Digest)
+	assert.Equal(t, time.Date(2026, 6, 3, 12, 30, 0, 500000000, time.UTC), info.LastPushed)
+}
+
+func TestFetch_AADRefreshToken(t *testing.T) {
+	fake, server := newFake(t, func(r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "refresh_token", r.PostForm.Get("grant_type"))
+		assert.Equal(t, "contoso.azurecr.io", r.PostForm.Get("service"))
+		switch r.URL.Path {
+		case "/oauth2/exchange":
+			assert.Equal(t, "aad-refresh", r.PostForm.Get("refresh_token"))
+			assert.Equal(t, "tenant-id", r.PostForm.Get("tenant"))
+		case "/oauth2/token":
+			assert.Equal(t, "acr-refresh", r.PostForm.Get("refresh_token"))
+			assert.Equal(t, "repository:team/app:metadata_read", r.PostForm.Get("scope"))
+		}
+	})
+	s := NewACRScraper(server.Client(), WithBaseURL(server.URL), WithAADRefreshToken("aad-refresh", "tenant-id"))
+
+	for range 2 {
+		_, err := s.Fetch(context.Background(), app)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, fake.exchanges, "ACR refresh token is cached")
+	assert.Equal(t, 1, fake.issued, "access token is cached")
+}
+
+func TestFetch_ExpiredToken(t *testing.T) {
+	fake, server := newFake(t, func(*http.Request) {})
+	s := NewACRScraper(server.Client(), WithBaseURL(server.URL))
+
+	_, err := s.Fetch(context.Background(), app)
+	require.NoError(t, err)
+	fake.issued++ // invalidates the cached access token
+
+	_, err = s.Fetch(context.Background(), app)
+	require.NoError(t, err)
+	assert.Equal(t, 3, fake.issued)
+}
+
+func TestFetch_NotFound(t *testing.T) {
+	_, server := newFake(t, func(*http.Request) {})
+	ref := app
+	ref.Tag = "missing"
+
+	_, err := NewACRScraper(server.Client(), WithBaseURL(server.URL)).Fetch(context.Background(), ref)
+	assert.True(t, errors.Is(err, registry.ErrNotFound))
+}
+
+func TestFetch_TokenDenied(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	_, err := NewACRScraper(server.Client(), WithBaseURL(server.URL)).Fetch(context.Background(), app)
+	var statusErr *registry.StatusError
+	require.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusUnauthorized, statusErr.Code)
+}
+
+func TestCanHandle(t *testing.T) {
+	s := NewACRScraper(nil)
+	assert.True(t, s.CanHandle("contoso.azurecr.io"))
+	assert.False(t, s.CanHandle("azurecr.io.example.com"))
+
+	s = NewACRScraper(nil, WithHosts("contoso.azurecr.io"))
+	assert.True(t, s.CanHandle("contoso.azurecr.io"))
+	assert.False(t, s.CanHandle("fabrikam.azurecr.io"))
+}
@@ -3,8 +3,8 @@ package dockerhub
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"time"
 
@@ -12,7 +12,7 @@ import (
 )
 
 // ErrNotFound is returned when the requested image tag does not exist.
-var ErrNotFound = errors.New("image tag not found")
+var ErrNotFound = registry.ErrNotFound
 
 const defaultBaseURL = "https://hub.docker.com"
 
@@ -20,6 +20,7 @@ const defaultBaseURL = "https://hub.docker.com"
 type DockerHubScraper struct {
 	client  *http.Client
 	baseURL string
+	logger  *slog.Logger
 }
 
 // Option is a functional option for DockerHubScraper.
@@ -32,11 +33,19 @@ func WithBaseURL(url string) Option {
 	}
 }
 
+// WithLogger sets the logger for fetch diagnostics (default slog.Default()).
+func WithLogger(l *slog.Logger) Option {
+	return func(s *DockerHubScraper) {
+		s.logger = l
+	}
+}
+
 // NewDockerHubScraper creates a new DockerHubScraper using the given HTTP client.
 func NewDockerHubScraper(client *http.Client, opts ...Option) *DockerHubScraper {
 	s := &DockerHubScraper{
 		client:  client,
 		baseURL: defaultBaseURL,
+		logger:  slog.Default(),
 	}
 	for _, o := range opts {
 		o(s)
@@ -55,9 +64,10 @@ func (s *DockerHubScraper) CanHandle(host string) bool {
 
 type tagResponse struct {
 	TagLastPushed time.Time `json:"tag_last_pushed"`
+	Digest        string    `json:"digest"`
 }
 
-// Fetch retrieves the tag_last_pushed timestamp for the image from Docker Hub.
+// Fetch retrieves the tag_last_pushed timestamp and digest for the image from Docker Hub.
 func (s *DockerHubScraper) Fetch(ctx context.Context, ref registry.ImageRef) (registry.ImageInfo, error) {
 	url := fmt.Sprintf("%s/v2/repositories/%s/%s/tags/%s",
 		s.baseURL, ref.Namespace, ref.Name, ref.Tag)
@@ -77,16 +87,19 @@ func (s *DockerHubScraper) Fetch(ctx context.Context, ref registry.ImageRef) (re
 		return registry.ImageInfo{}, fmt.Errorf("dockerhub: %s: %w", ref, ErrNotFound)
 	}
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return registry.ImageInfo{}, fmt.Errorf("dockerhub: %s: unexpected status %d", ref, resp.StatusCode)
+		return registry.ImageInfo{}, fmt.Errorf("dockerhub: %s: %w", ref, &registry.StatusError{Code: resp.StatusCode})
 	}
 
 	var data tagResponse
 	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		return registry.ImageInfo{}, fmt.Errorf("dockerhub: decode response for %s: %w", ref, err)
+		return registry.ImageInfo{}, fmt.Errorf("dockerhub: decode response for %s: %w", ref, &registry.DecodeError{Err: err})
 	}
 
+	s.logger.Debug("dockerhub: fetched tag", "ref", ref.String(),
+		"pushed", data.TagLastPushed, "digest", data.Digest)
 	return registry.ImageInfo{
 		Ref:        ref,
 		LastPushed: data.TagLastPushed.UTC(),
+		Digest:     data.Digest,
 	}, nil
 }
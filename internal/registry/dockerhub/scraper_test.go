@@ -22,7 +22,7 @@ func TestFetch_OfficialImage(t *testing.T) {
 		assert.Equal(t, "/v2/repositories/library/php/tags/8.2.30-fpm", r.URL.Path)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte(`{"tag_last_pushed":"2026-02-04T17:56:28.838962Z"}`))
+		_, _ = w.Write([]byte(`{"tag_last_pushed":"2026-02-04T17:56:28.838962Z","digest":"sha256:0123abcd"}`))
 	}))
 	defer server.Close()
 
@@ -35,6 +35,7 @@ func TestFetch_OfficialImage(t *testing.T) {
 
 	want := time.Date(2026, 2, 4, 17, 56, 28, 838962000, time.UTC)
 	assert.Equal(t, want, info.LastPushed)
+	assert.Equal(t, "sha256:0123abcd", info.Digest)
 }
 
 func TestFetch_UserImage(t *testing.T) {
@@ -83,6 +84,22 @@ func TestFetch_ServerError(t *testing.T) {
 	assert.Contains(t, err.Error(), "500")
 }
 
+func TestFetch_RateLimited(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: registry.NewTransport(server.Client().Transport)}
+	scraper := NewDockerHubScraper(client, WithBaseURL(server.URL))
+	ref := registry.ImageRef{Namespace: "library", Name: "php", Tag: "8.2.30-fpm"}
+
+	_, err := scraper.Fetch(context.Background(), ref)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, registry.ErrRateLimited), "expected ErrRateLimited, got: %v", err)
+}
+
 func TestCanHandle(t *testing.T) {
 	scraper := NewDockerHubScraper(&http.Client{})
 
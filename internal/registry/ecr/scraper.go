@@ -0,0 +1,295 @@
+// Package ecr reads image metadata from Amazon ECR and ECR Public through
+// the DescribeImages API, signed with AWS Signature Version 4.
+package ecr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wutscho/registry-ping/internal/registry"
+	"github.com/wutscho/registry-ping/internal/registry/oci"
+	"github.com/wutscho/registry-ping/internal/sigv4"
+)
+
+const (
+	publicHost         = "public.ecr.aws"
+	defaultPublicURL   = "https://public.ecr.aws"
+	publicRegion       = "us-east-1" // ECR Public's API only runs here
+	privateTarget      = "AmazonEC2ContainerRegistry_V20150921."
+	publicTarget       = "SpencerFrontendService."
+	privateService     = "ecr"
+	publicService      = "ecr-public"
+	jsonContentType    = "application/x-amz-json-1.1"
+	describeImages     = "DescribeImages"
+	describeRegistries = "DescribeRegistries"
+)
+
+// privateHost matches "<account>.dkr.ecr.<region>.amazonaws.com", also in
+// the China partition (".com.cn").
+var privateHost = regexp.MustCompile(`^(\d{12})\.dkr\.ecr\.([a-z0-9-]+)\.amazonaws\.com(\.cn)?$`)
+
+// ECRScraper fetches image push times and digests from ECR. Images on ECR
+// Public are resolved anonymously to their digest, and changes are detected
+// by digest, unless WithOwnPublicRegistry is set and they belong to the
+// credentials' own registry.
+type ECRScraper struct {
+	client    *http.Client
+	creds     sigv4.Credentials
+	endpoint  string
+	publicURL string
+	hosts     []string
+	ownPublic bool
+	public    *oci.Scraper
+	logger    *slog.Logger
+	now       func() time.Time
+
+	mu      sync.Mutex
+	aliases map[string]string // registry ID per own ECR Public alias; nil until loaded
+}
+
+// Option is a functional option for ECRScraper.
+type Option func(*ECRScraper)
+
+// WithCredentials sets the AWS credentials used to sign API requests.
+func WithCredentials(creds sigv4.Credentials) Option {
+	return func(s *ECRScraper) {
+		s.creds = creds
+	}
+}
+
+// WithEndpoint overrides the API endpoint for all regions, e.g. for a VPC
+// endpoint or testing with httptest.
+func WithEndpoint(url string) Option {
+	return func(s *ECRScraper) {
+		s.endpoint = url
+	}
+}
+
+// WithHosts restricts CanHandle to the given ECR hosts, e.g. to use
+// different credentials per account.
+func WithHosts(hosts ...string) Option {
+	return func(s *ECRScraper) {
+		s.hosts = hosts
+	}
+}
+
+// WithOwnPublicRegistry describes images of the credentials' own ECR
+// Public registry through the API, which reports push times. Their aliases
+// are looked up once with DescribeRegistries.
+func WithOwnPublicRegistry() Option {
+	return func(s *ECRScraper) {
+		s.ownPublic = true
+	}
+}
+
+// WithPublicRegistryURL overrides the ECR Public registry used for
+// anonymous digest lookups (useful for testing with httptest).
+func WithPublicRegistryURL(url string) Option {
+	return func(s *ECRScraper) {
+		s.publicURL = url
+	}
+}
+
+// WithLogger sets the logger for fetch diagnostics (default slog.Default()).
+func WithLogger(l *slog.Logger) Option {
+	return func(s *ECRScraper) {
+		s.logger = l
+	}
+}
+
+// NewECRScraper creates a new ECRScraper using the given HTTP client.
+func NewECRScraper(client *http.Client, opts ...Option) *ECRScraper {
+	s := &ECRScraper{
+		client:    client,
+		publicURL: defaultPublicURL,
+		logger:    slog.Default(),
+		now:       time.Now,
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	s.public = oci.NewScraper(client, s.publicURL, oci.WithLogger(s.logger))
+	return s
+}
+
+// CanHandle reports whether host is an ECR private registry or ECR Public,
+// and one of the configured hosts if any.
+func (s *ECRScraper) CanHandle(host string) bool {
+	if len(s.hosts) > 0 && !slices.Contains(s.hosts, host) {
+		return false
+	}
+	return host == publicHost || privateHost.MatchString(host)
+}
+
+type imageID struct {
+	ImageTag string `json:"imageTag"`
+}
+
+type describeImagesRequest struct {
+	RegistryID     string    `json:"registryId,omitempty"`
+	RepositoryName string    `json:"repositoryName"`
+	ImageIDs       []imageID `json:"imageIds"`
+}
+
+type describeImagesResponse struct {
+	ImageDetails []struct {
+		ImageDigest   string  `json:"imageDigest"`
+		ImagePushedAt float64 `json:"imagePushedAt"` // epoch seconds
+	} `json:"imageDetails"`
+}
+
+// Fetch describes the tagged image and returns its push time and digest.
+func (s *ECRScraper) Fetch(ctx context.Context, ref registry.ImageRef) (registry.ImageInfo, error) {
+	if ref.Host == publicHost {
+		return s.fetchPublic(ctx, ref)
+	}
+
+	m := privateHost.FindStringSubmatch(ref.Host)
+	if m == nil {
+		return registry.ImageInfo{}, fmt.Errorf("ecr: %s: not an ECR host", ref)
+	}
+	account, region, partition := m[1], m[2], m[3]
+	endpoint := fmt.Sprintf("https://api.ecr.%s.amazonaws.com%s", region, partition)
+	req := describeImagesRequest{RegistryID: account, RepositoryName: ref.Repository(), ImageIDs: []imageID{{ref.Tag}}}
+	return s.describeImages(ctx, ref, endpoint, region, privateService, privateTarget, req)
+}
+
+// fetchPublic describes an image of the caller's own ECR Public registry,
+// or resolves any other public image to its digest. If the own aliases
+// cannot be listed, all images are resolved anonymously.
+func (s *ECRScraper) fetchPublic(ctx context.Context, ref registry.ImageRef) (registry.ImageInfo, error) {
+	alias, repo, ok := strings.Cut(ref.Repository(), "/")
+	if !ok {
+		return registry.ImageInfo{}, fmt.Errorf("ecr: %s: image path must start with a registry alias", ref)
+	}
+	if s.ownPublic && s.creds.AccessKeyID != "" {
+		if registryID := s.ownAlias(ctx, alias); registryID != "" {
+			endpoint := fmt.Sprintf("https://api.ecr-public.%s.amazonaws.com", publicRegion)
+			req := describeImagesRequest{RegistryID: registryID, RepositoryName: repo, ImageIDs: []imageID{{ref.Tag}}}
+			return s.describeImages(ctx, ref, endpoint, publicRegion, publicService, publicTarget, req)
+		}
+	}
+	info, err := s.public.Fetch(ctx, ref)
+	if err != nil {
+		return registry.ImageInfo{}, fmt.Errorf("ecr: %w", err)
+	}
+	return info, nil
+}
+
+// ownAlias returns the registry ID if alias belongs to the credentials' own
+// ECR Public registry, or "". The aliases are loaded once; a failure is
+// logged and leaves none.
+func (s *ECRScraper) ownAlias(ctx context.Context, alias string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.aliases == nil {
+		var resp struct {
+			Registries []struct {
+				RegistryID string `json:"registryId"`
+				Aliases    []struct {
+					Name string `json:"name"`
+				} `json:"aliases"`
+			} `json:"registries"`
+		}
+		endpoint := fmt.Sprintf("https://api.ecr-public.%s.amazonaws.com", publicRegion)
+		s.aliases = make(map[string]string)
+		if err := s.call(ctx, endpoint, publicRegion, publicService, publicTarget+describeRegistries, struct{}{}, &resp); err != nil {
+			s.logger.Warn("ecr: cannot list own ECR Public registries, resolving public images anonymously", "err", err)
+			return ""
+		}
+		for _, r := range resp.Registries {
+			for _, a := range r.Aliases {
+				s.aliases[a.Name] = r.RegistryID
+			}
+		}
+	}
+	return s.aliases[alias]
+}
+
+func (s *ECRScraper) describeImages(ctx context.Context, ref registry.ImageRef, endpoint, region, service, target string, in describeImagesRequest) (registry.ImageInfo, error) {
+	var out describeImagesResponse
+	if err := s.call(ctx, endpoint, region, service, target+describeImages, in, &out); err != nil {
+		return registry.ImageInfo{}, fmt.Errorf("ecr: %s: %w", ref, err)
+	}
+	if len(out.ImageDetails) == 0 {
+		return registry.ImageInfo{}, fmt.Errorf("ecr: %s: %w", ref, registry.ErrNotFound)
+	}
+	d := out.ImageDetails[0]
+	sec, frac := math.Modf(d.ImagePushedAt)
+	info := registry.ImageInfo{
+		Ref:        ref,
+		LastPushed: time.Unix(int64(sec), int64(math.Round(frac*1e3))*int64(time.Millisecond)).UTC(),
+		Digest:     d.ImageDigest,
+	}
+	s.logger.Debug("ecr: described image", "ref", ref.String(), "pushed", info.LastPushed, "digest", info.Digest)
+	return info, nil
+}
+
+// call posts a signed JSON request for the given X-Amz-Target operation and
+// decodes the response into out. The operations used only read, so failed
+// calls are retried like GETs.
+func (s *ECRScraper) call(ctx context.Context, endpoint, region, service, target string, in, out any) error {
+	if s.endpoint != "" {
+		endpoint = s.endpoint
+	}
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(registry.Idempotent(ctx), http.MethodPost, strings.TrimSuffix(endpoint, "/")+"/", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", jsonContentType)
+	req.Header.Set("X-Amz-Target", target)
+	signer := &sigv4.Signer{Credentials: s.creds, Region: region, Service: service}
+	if err := signer.Sign(req, sigv4.HashPayload(body), s.now()); err != nil {
+		return err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return apiError(req.URL.Host, resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return &registry.DecodeError{Err: err}
+	}
+	return nil
+}
+
+// apiError converts an AWS JSON error response, such as
+// {"__type":"ImageNotFoundException","message":"..."}, into an error.
+func apiError(host string, resp *http.Response) error {
+	var e struct {
+		Type    string `json:"__type"`
+		Message string `json:"message"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&e)
+	// The type may be qualified, e.g. "com.amazonaws.ecr#ImageNotFoundException".
+	code := e.Type[strings.LastIndex(e.Type, "#")+1:]
+
+	switch {
+	case strings.HasSuffix(code, "NotFoundException"):
+		return fmt.Errorf("%s: %w", code, registry.ErrNotFound)
+	case code == "ThrottlingException" || resp.StatusCode == http.StatusTooManyRequests:
+		return &registry.RateLimitError{Host: host}
+	case code != "":
+		return fmt.Errorf("%s: %s: %w", code, e.Message, &registry.StatusError{Code: resp.StatusCode})
+	}
+	return &registry.StatusError{Code: resp.StatusCode}
+}
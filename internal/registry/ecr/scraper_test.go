@@ -0,0 +1,202 @@
+package ecr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wutscho/registry-ping/internal/registry"
+	"github.com/wutscho/registry-ping/internal/sigv4"
+)
+
+var (
+	creds   = sigv4.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}
+	private = registry.ImageRef{Host: "123456789012.dkr.ecr.eu-central-1.amazonaws.com", Namespace: "team", Name: "api", Tag: "v3"}
+)
+
+// stubAPI answers X-Amz-Target operations with the given JSON bodies and
+// records the decoded requests.
+type stubAPI struct {
+	t         *testing.T
+	responses map[string]string
+	requests  map[string]map[string]any
+	auth      []string
+}
+
+func newStubAPI(t *testing.T, responses map[string]string) (*stubAPI, *httptest.Server) {
+	api := &stubAPI{t: t, responses: responses, requests: make(map[string]map[string]any)}
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+	return api, server
+}
+
+func (a *stubAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	assert.Equal(a.t, http.MethodPost, r.Method)
+	assert.Equal(a.t, "application/x-amz-json-1.1", r.Header.Get("Content-Type"))
+	a.auth = append(a.auth, r.Header.Get("Authorization"))
+
+	target := r.Header.Get("X-Amz-Target")
+	body, _ := io.ReadAll(r.Body)
+	var req map[string]any
+	_ = json.Unmarshal(body, &req)
+	a.requests[target] = req
+
+	resp, ok := a.responses[target]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"__type":"UnknownOperationException"}`))
+		return
+	}
+	if strings.Contains(resp, "__type") {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	_, _ = w.Write([]byte(resp))
+}
+
+func TestFetch_Private(t *testing.T) {
+	api, server := newStubAPI(t, map[string]string{
+		"AmazonEC2ContainerRegistry_V20150921.DescribeImages": `{"imageDetails":[
+			{"imageDigest":"sha256:beef","imagePushedAt":1767225600.5,"imageTags":["v3"]}]}`,
+	})
+	s := NewECRScraper(server.Client(), WithCredentials(creds), WithEndpoint(server.URL))
+
+	info, err := s.Fetch(context.Background(), private)
+	require.NoError(t, err)
+	assert.Equal(t, private, info.Ref)
+	assert.Equal(t, "sha256:beef", info.Digest)
+	assert.Equal(t, time.Date(2026, 1, 1, 0, 0, 0, 500000000, time.UTC), info.LastPushed)
+
+	assert.Equal(t, map[string]any{
+		"registryId":     "123456789012",
+		"repositoryName": "team/api",
+		"imageIds":       []any{map[string]any{"imageTag": "v3"}},
+	}, api.requests["AmazonEC2ContainerRegistry_V20150921.DescribeImages"])
+	require.Len(t, api.auth, 1)
+	assert.Contains(t, api.auth[0], "Credential=AKID/")
+	assert.Contains(t, api.auth[0], "/eu-central-1/ecr/aws4_request")
+	assert.Contains(t, api.auth[0], "x-amz-target")
+}
+
+func TestFetch_PrivateErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		check func(t *testing.T, err error)
+	}{
+		{"image not found", `{"__type":"ImageNotFoundException","message":"no such tag"}`, func(t *testing.T, err error) {
+			assert.True(t, errors.Is(err, registry.ErrNotFound))
+		}},
+		{"repository not found", `{"__type":"com.amazonaws.ecr#RepositoryNotFoundException"}`, func(t *testing.T, err error) {
+			assert.True(t, errors.Is(err, registry.ErrNotFound))
+		}},
+		{"throttled", `{"__type":"ThrottlingException","message":"Rate exceeded"}`, func(t *testing.T, err error) {
+			assert.True(t, errors.Is(err, registry.ErrRateLimited))
+		}},
+		{"access denied", `{"__type":"AccessDeniedException","message":"not authorized"}`, func(t *testing.T, err error) {
+			var statusErr *registry.StatusError
+			require.True(t, errors.As(err, &statusErr))
+			assert.Equal(t, http.StatusBadRequest, statusErr.Code)
+			assert.ErrorContains(t, err, "AccessDeniedException: not authorized")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, server := newStubAPI(t, map[string]string{"AmazonEC2ContainerRegistry_V20150921.DescribeImages": tt.body})
+			_, err := NewECRScraper(server.Client(), WithCredentials(creds), WithEndpoint(server.URL)).Fetch(context.Background(), private)
+			tt.check(t, err)
+		})
+	}
+}
+
+func TestFetch_PrivateWithoutCredentials(t *testing.T) {
+	_, server := newStubAPI(t, nil)
+	_, err := NewECRScraper(server.Client(), WithEndpoint(server.URL)).Fetch(context.Background(), private)
+	assert.ErrorContains(t, err, "missing credentials")
+}
+
+func TestFetch_PublicOwnRegistry(t *testing.T) {
+	api, server := newStubAPI(t, map[string]string{
+		"SpencerFrontendService.DescribeRegistries": `{"registries":[{"registryId":"123456789012","aliases":[{"name":"myalias"}]}]}`,
+		"SpencerFrontendService.DescribeImages":     `{"imageDetails":[{"imageDigest":"sha256:cafe","imagePushedAt":1767225600}]}`,
+	})
+	s := NewECRScraper(server.Client(), WithCredentials(creds), WithEndpoint(server.URL), WithOwnPublicRegistry())
+
+	ref := registry.ImageRef{Host: "public.ecr.aws", Namespace: "myalias", Name: "tool", Tag: "1"}
+	info, err := s.Fetch(context.Background(), ref)
+	require.NoError(t, err)
+	assert.Equal(t, "sha256:cafe", info.Digest)
+	assert.Equal(t, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), info.LastPushed)
+	assert.Equal(t, "123456789012", api.requests["SpencerFrontendService.DescribeImages"]["registryId"])
+	assert.Equal(t, "tool", api.requests["SpencerFrontendService.DescribeImages"]["repositoryName"])
+	assert.Contains(t, api.auth[0], "/us-east-1/ecr-public/aws4_request")
+}
+
+func TestFetch_PublicOtherRegistry(t *testing.T) {
+	_, api := newStubAPI(t, map[string]string{
+		"SpencerFrontendService.DescribeRegistries": `{"registries":[{"registryId":"123456789012","aliases":[{"name":"myalias"}]}]}`,
+	})
+	registryServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v2/docker/library/nginx/manifests/1.27", r.URL.Path)
+		w.Header().Set("Docker-Content-Digest", "sha256:d1ce")
+	}))
+	defer registryServer.Close()
+
+	s := NewECRScraper(registryServer.Client(), WithCredentials(creds), WithEndpoint(api.URL),
+		WithPublicRegistryURL(registryServer.URL), WithOwnPublicRegistry())
+	ref := registry.ImageRef{Host: "public.ecr.aws", Namespace: "docker/library", Name: "nginx", Tag: "1.27"}
+	info, err := s.Fetch(context.Background(), ref)
+	require.NoError(t, err)
+	assert.Equal(t, "sha256:d1ce", info.Digest)
+	assert.True(t, info.LastPushed.IsZero())
+}
+
+func TestFetch_PublicAnonymous(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{"without own public registry", []Option{WithCredentials(creds)}},
+		{"aliases not listable", []Option{WithCredentials(creds), WithOwnPublicRegistry()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api, apiServer := newStubAPI(t, map[string]string{
+				"SpencerFrontendService.DescribeRegistries": `{"__type":"AccessDeniedException","message":"not authorized"}`,
+			})
+			registryServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Docker-Content-Digest", "sha256:d1ce")
+			}))
+			defer registryServer.Close()
+
+			s := NewECRScraper(registryServer.Client(), append(tt.opts, WithEndpoint(apiServer.URL), WithPublicRegistryURL(registryServer.URL))...)
+			ref := registry.ImageRef{Host: "public.ecr.aws", Namespace: "myalias", Name: "tool", Tag: "1"}
+			for range 2 {
+				info, err := s.Fetch(context.Background(), ref)
+				require.NoError(t, err)
+				assert.Equal(t, "sha256:d1ce", info.Digest)
+			}
+			assert.LessOrEqual(t, len(api.auth), 1, "aliases are listed at most once")
+		})
+	}
+}
+
+func TestCanHandle(t *testing.T) {
+	s := NewECRScraper(nil)
+	assert.True(t, s.CanHandle("123456789012.dkr.ecr.eu-central-1.amazonaws.com"))
+	assert.True(t, s.CanHandle("123456789012.dkr.ecr.cn-north-1.amazonaws.com.cn"))
+	assert.True(t, s.CanHandle("public.ecr.aws"))
+	assert.False(t, s.CanHandle("dkr.ecr.eu-central-1.amazonaws.com"))
+	assert.False(t, s.CanHandle("docker.io"))
+
+	s = NewECRScraper(nil, WithHosts("123456789012.dkr.ecr.eu-central-1.amazonaws.com"))
+	assert.True(t, s.CanHandle("123456789012.dkr.ecr.eu-central-1.amazonaws.com"))
+	assert.False(t, s.CanHandle("210987654321.dkr.ecr.eu-central-1.amazonaws.com"))
+}
@@ -0,0 +1,84 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// ErrNotFound is returned by scrapers when the requested image tag does not exist.
+var ErrNotFound = errors.New("image tag not found")
+
+// ErrRateLimited is matched by errors.Is for every *RateLimitError.
+var ErrRateLimited = errors.New("rate limited")
+
+// RateLimitError is returned when a registry keeps answering 429 or its
+// rate-limit budget is exhausted until after the request's deadline.
+type RateLimitError struct {
+	Host string
+	// Reset is when the registry is expected to accept requests again, or
+	// zero if unknown.
+	Reset time.Time
+}
+
+func (e *RateLimitError) Error() string {
+	if e.Reset.IsZero() {
+		return fmt.Sprintf("%s: %v", e.Host, ErrRateLimited)
+	}
+	return fmt.Sprintf("%s: %v until %s", e.Host, ErrRateLimited, e.Reset.UTC().Format(time.RFC3339))
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
+
+// StatusError is returned by scrapers for an unexpected HTTP response status.
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d", e.Code)
+}
+
+// DecodeError wraps a failure to parse a registry response.
+type DecodeError struct {
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorClass returns a short, stable category for a fetch error, suitable
+// as a metric label: "not_found", "rate_limited", "timeout", "network",
+// "status", "decode" or "other".
+func ErrorClass(err error) string {
+	var statusErr *StatusError
+	var netErr net.Error
+	var decodeErr *DecodeError
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return "not_found"
+	case errors.Is(err, ErrRateLimited):
+		return "rate_limited"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			return "timeout"
+		}
+		return "network"
+	case errors.As(err, &statusErr):
+		return "status"
+	case errors.As(err, &decodeErr):
+		return "decode"
+	}
+	return "other"
+}
@@ -0,0 +1,33 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("dockerhub: php:99: %w", ErrNotFound), "not_found"},
+		{&url.Error{Op: "Get", URL: "https://hub.docker.com", Err: &RateLimitError{Host: "hub.docker.com"}}, "rate_limited"},
+		{fmt.Errorf("fetch: %w", context.DeadlineExceeded), "timeout"},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, "network"},
+		{fmt.Errorf("dockerhub: %w", &StatusError{Code: 502}), "status"},
+		{&DecodeError{Err: errors.New("unexpected EOF")}, "decode"},
+		{errors.New("boom"), "other"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.want, func(t *testing.T) {
+			assert.Equal(t, tc.want, ErrorClass(tc.err))
+		})
+	}
+}
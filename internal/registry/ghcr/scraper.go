@@ -0,0 +1,243 @@
+// Package ghcr reads image metadata from the GitHub Container Registry,
+// combining the OCI manifest digest with the package versions of the
+// GitHub Packages REST API.
+package ghcr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wutscho/registry-ping/internal/registry"
+	"github.com/wutscho/registry-ping/internal/registry/oci"
+)
+
+const (
+	defaultRegistryURL = "https://ghcr.io"
+	defaultAPIURL      = "https://api.github.com"
+	// maxVersionPages bounds the search for the tag's version. Versions
+	// are listed newest first, so a current tag is nearly always on the
+	// first page.
+	maxVersionPages = 5
+)
+
+// GHCRScraper fetches image metadata from ghcr.io. Without a token, or if
+// the tag's package version cannot be found, it only reports the digest and
+// changes are detected by digest.
+type GHCRScraper struct {
+	client      *http.Client
+	registryURL string
+	apiURL      string
+	token       string
+	logger      *slog.Logger
+	manifests   *oci.Scraper
+
+	mu     sync.Mutex
+	owners map[string]string // "orgs" or "users" per package owner
+}
+
+// Option is a functional option for GHCRScraper.
+type Option func(*GHCRScraper)
+
+// WithRegistryURL overrides the registry base URL (useful for testing with httptest).
+func WithRegistryURL(url string) Option {
+	return func(s *GHCRScraper) {
+		s.registryURL = url
+	}
+}
+
+// WithAPIURL overrides the GitHub REST API base URL, e.g. for testing with
+// httptest.
+func WithAPIURL(url string) Option {
+	return func(s *GHCRScraper) {
+		s.apiURL = url
+	}
+}
+
+// WithToken sets a GitHub token with the read:packages scope. It is used for
+// the REST API and to pull private images.
+func WithToken(token string) Option {
+	return func(s *GHCRScraper) {
+		s.token = token
+	}
+}
+
+// WithLogger sets the logger for fetch diagnostics (default slog.Default()).
+func WithLogger(l *slog.Logger) Option {
+	return func(s *GHCRScraper) {
+		s.logger = l
+	}
+}
+
+// NewGHCRScraper creates a new GHCRScraper using the given HTTP client.
+func NewGHCRScraper(client *http.Client, opts ...Option) *GHCRScraper {
+	s := &GHCRScraper{
+		client:      client,
+		registryURL: defaultRegistryURL,
+		apiURL:      defaultAPIURL,
+		logger:      slog.Default(),
+		owners:      make(map[string]string),
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	ociOpts := []oci.Option{oci.WithLogger(s.logger)}
+	if s.token != "" {
+		// ghcr.io accepts any user name together with a token.
+		ociOpts = append(ociOpts, oci.WithBasicAuth("token", s.token))
+	}
+	s.manifests = oci.NewScraper(client, s.registryURL, ociOpts...)
+	return s
+}
+
+// CanHandle reports whether this scraper handles the given host.
+func (s *GHCRScraper) CanHandle(host string) bool {
+	return host == "ghcr.io"
+}
+
+type packageVersion struct {
+	Name      string    `json:"name"` // the manifest digest
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Metadata  struct {
+		Container struct {
+			Tags []string `json:"tags"`
+		} `json:"container"`
+	} `json:"metadata"`
+}
+
+// Fetch resolves the tag's digest through the registry and, with a token,
+// looks up when the matching package version was last updated. If that
+// lookup fails, the digest alone is returned.
+func (s *GHCRScraper) Fetch(ctx context.Context, ref registry.ImageRef) (registry.ImageInfo, error) {
+	info, err := s.manifests.Fetch(ctx, ref)
+	if err != nil {
+		return registry.ImageInfo{}, fmt.Errorf("ghcr: %w", err)
+	}
+	if s.token == "" {
+		return info, nil
+	}
+
+	v, err := s.findVersion(ctx, ref, info.Digest)
+	if err != nil {
+		if ctx.Err() != nil {
+			return registry.ImageInfo{}, fmt.Errorf("ghcr: package versions for %s: %w", ref, err)
+		}
+		// The digest is known already; without the push time the change
+		// is reported when it is detected, as for anonymous lookups. A
+		// token lacking read:packages gets a 403 here.
+		s.logger.Warn("ghcr: package versions unavailable, using the digest only", "ref", ref.String(), "digest", info.Digest, "err", err)
+		return info, nil
+	}
+	if v == nil {
+		s.logger.Debug("ghcr: no package version for digest", "ref", ref.String(), "digest", info.Digest)
+		return info, nil
+	}
+	// updated_at moves when a tag is added to an existing version, so a tag
+	// pointed back at an older image still counts as pushed.
+	info.LastPushed = v.UpdatedAt.UTC()
+	if info.LastPushed.IsZero() {
+		info.LastPushed = v.CreatedAt.UTC()
+	}
+	s.logger.Debug("ghcr: fetched tag", "ref", ref.String(), "pushed", info.LastPushed, "digest", info.Digest)
+	return info, nil
+}
+
+// findVersion returns the package version with the given digest, or the
+// version carrying the tag if the digest is not listed, or nil.
+func (s *GHCRScraper) findVersion(ctx context.Context, ref registry.ImageRef, digest string) (*packageVersion, error) {
+	var tagged *packageVersion
+	for page := 1; page <= maxVersionPages; page++ {
+		versions, err := s.versions(ctx, ref, page)
+		if err != nil {
+			return nil, err
+		}
+		for i := range versions {
+			v := &versions[i]
+			if v.Name == digest {
+				return v, nil
+			}
+			if tagged == nil && slices.Contains(v.Metadata.Container.Tags, ref.Tag) {
+				tagged = v
+			}
+		}
+		if len(versions) < 100 {
+			break
+		}
+	}
+	return tagged, nil
+}
+
+// versions lists a page of the package's versions. Packages are owned by an
+// organization or a user, which is tried in that order and remembered.
+func (s *GHCRScraper) versions(ctx context.Context, ref registry.ImageRef, page int) ([]packageVersion, error) {
+	s.mu.Lock()
+	owner, _ := packageOf(ref)
+	kind, known := s.owners[owner]
+	s.mu.Unlock()
+
+	kinds := []string{"orgs", "users"}
+	if known {
+		kinds = []string{kind}
+	}
+	var err error
+	for _, kind := range kinds {
+		var versions []packageVersion
+		versions, err = s.listVersions(ctx, kind, ref, page)
+		if errors.Is(err, registry.ErrNotFound) {
+			continue
+		}
+		if err == nil {
+			s.mu.Lock()
+			s.owners[owner] = kind
+			s.mu.Unlock()
+		}
+		return versions, err
+	}
+	return nil, err
+}
+
+func (s *GHCRScraper) listVersions(ctx context.Context, kind string, ref registry.ImageRef, page int) ([]packageVersion, error) {
+	owner, pkg := packageOf(ref)
+	u := fmt.Sprintf("%s/%s/%s/packages/container/%s/versions?per_page=100&page=%d",
+		s.apiURL, kind, url.PathEscape(owner), url.PathEscape(pkg), page)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+s.token)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, registry.ErrNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &registry.StatusError{Code: resp.StatusCode}
+	}
+	var versions []packageVersion
+	if err := json.NewDecoder(resp.Body).Decode(&versions); err != nil {
+		return nil, &registry.DecodeError{Err: err}
+	}
+	return versions, nil
+}
+
+// packageOf splits an image path into the owning user or organization and
+// the package name, which keeps any further path segments.
+func packageOf(ref registry.ImageRef) (owner, pkg string) {
+	owner, pkg, _ = strings.Cut(ref.Repository(), "/")
+	return owner, pkg
+}
@@ -0,0 +1,140 @@
+package ghcr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wutscho/registry-ping/internal/registry"
+)
+
+var tool = registry.ImageRef{Host: "ghcr.io", Namespace: "myorg", Name: "tool", Tag: "1.2"}
+
+// newTestServer serves the manifest digest for tool and the given package
+// versions for the owner kind ("orgs" or "users").
+func newTestServer(t *testing.T, kind, versions string) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v2/myorg/tool/manifests/1.2", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Docker-Content-Digest", "sha256:current")
+	})
+	mux.HandleFunc("/"+kind+"/myorg/packages/container/tool/versions", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer ghp_secret", r.Header.Get("Authorization"))
+		assert.Equal(t, "1", r.URL.Query().Get("page"))
+		_, _ = w.Write([]byte(versions))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestScraper(server *httptest.Server, opts ...Option) *GHCRScraper {
+	return NewGHCRScraper(server.Client(),
+		append([]Option{WithRegistryURL(server.URL), WithAPIURL(server.URL)}, opts...)...)
+}
+
+const versions = `[
+	{"name":"sha256:current","created_at":"2026-03-01T10:00:00Z","updated_at":"2026-03-02T08:30:00Z",
+	 "metadata":{"package_type":"container","container":{"tags":["1.2","latest"]}}},
+	{"name":"sha256:older","created_at":"2026-02-01T10:00:00Z","updated_at":"2026-02-01T10:00:00Z",
+	 "metadata":{"package_type":"container","container":{"tags":[]}}}
+]`
+
+func TestFetch_WithToken(t *testing.T) {
+	server := newTestServer(t, "orgs", versions)
+
+	info, err := newTestScraper(server, WithToken("ghp_secret")).Fetch(context.Background(), tool)
+	require.NoError(t, err)
+	assert.Equal(t, tool, info.Ref)
+	assert.Equal(t, "sha256:current", info.Digest)
+	assert.Equal(t, time.Date(2026, 3, 2, 8, 30, 0, 0, time.UTC), info.LastPushed)
+}
+
+func TestFetch_UserPackage(t *testing.T) {
+	server := newTestServer(t, "users", versions)
+	s := newTestScraper(server, WithToken("ghp_secret"))
+
+	for range 2 {
+		info, err := s.Fetch(context.Background(), tool)
+		require.NoError(t, err)
+		assert.False(t, info.LastPushed.IsZero())
+	}
+	assert.Equal(t, "users", s.owners["myorg"], "owner kind is remembered")
+}
+
+func TestFetch_Anonymous(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v2/myorg/tool/manifests/1.2", r.URL.Path, "no API requests without a token")
+		w.Header().Set("Docker-Content-Digest", "sha256:current")
+	}))
+	defer server.Close()
+
+	info, err := newTestScraper(server).Fetch(context.Background(), tool)
+	require.NoError(t, err)
+	assert.Equal(t, "sha256:current", info.Digest)
+	assert.True(t, info.LastPushed.IsZero())
+}
+
+func TestFetch_DigestNotListed(t *testing.T) {
+	server := newTestServer(t, "orgs", `[{"name":"sha256:other","updated_at":"2026-02-01T10:00:00Z",
+		"metadata":{"container":{"tags":["1.1"]}}}]`)
+
+	info, err := newTestScraper(server, WithToken("ghp_secret")).Fetch(context.Background(), tool)
+	require.NoError(t, err)
+	assert.Equal(t, "sha256:current", info.Digest)
+	assert.True(t, info.LastPushed.IsZero(), "falls back to digest only")
+}
+
+func TestFetch_ManifestNotFound(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	_, err := newTestScraper(server, WithToken("ghp_secret")).Fetch(context.Background(), tool)
+	assert.True(t, errors.Is(err, registry.ErrNotFound))
+}
+
+func TestFetch_APIError(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v2/myorg/tool/manifests/1.2", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Docker-Content-Digest", "sha256:current")
+	})
+	mux.HandleFunc("/orgs/myorg/packages/container/tool/versions", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	info, err := newTestScraper(server, WithToken("ghp_secret")).Fetch(context.Background(), tool)
+	require.NoError(t, err, "a token without read:packages still yields the digest")
+	assert.Equal(t, "sha256:current", info.Digest)
+	assert.True(t, info.LastPushed.IsZero())
+}
+
+func TestFetch_NestedPackage(t *testing.T) {
+	nested := registry.ImageRef{Host: "ghcr.io", Namespace: "myorg/tools", Name: "cli", Tag: "1.2"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v2/myorg/tools/cli/manifests/1.2", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Docker-Content-Digest", "sha256:current")
+	})
+	mux.HandleFunc("/orgs/myorg/packages/container/", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/orgs/myorg/packages/container/tools%2Fcli/versions", r.URL.EscapedPath())
+		_, _ = w.Write([]byte(versions))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	info, err := newTestScraper(server, WithToken("ghp_secret")).Fetch(context.Background(), nested)
+	require.NoError(t, err)
+	assert.False(t, info.LastPushed.IsZero())
+}
+
+func TestCanHandle(t *testing.T) {
+	s := NewGHCRScraper(nil)
+	assert.True(t, s.CanHandle("ghcr.io"))
+	assert.False(t, s.CanHandle("docker.io"))
+}
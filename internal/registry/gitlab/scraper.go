@@ -0,0 +1,230 @@
+// Package gitlab reads image metadata from the GitLab container registry
+// API, as served by gitlab.com and self-hosted GitLab.
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wutscho/registry-ping/internal/registry"
+)
+
+const (
+	defaultBaseURL = "https://gitlab.com"
+	// maxRepositoryPages bounds the listing of a project's registry
+	// repositories while resolving an image path.
+	maxRepositoryPages = 10
+)
+
+// GitLabScraper fetches image metadata from the GitLab REST API
+// (/projects/:id/registry/repositories/:repo_id/tags/:tag_name).
+type GitLabScraper struct {
+	client   *http.Client
+	baseURL  string
+	hosts    []string
+	token    string
+	jobToken string
+	logger   *slog.Logger
+
+	mu    sync.Mutex
+	repos map[string]repoID // resolved registry repository per image path
+}
+
+// repoID locates a registry repository in the API.
+type repoID struct {
+	project int
+	repo    int
+}
+
+// Option is a functional option for GitLabScraper.
+type Option func(*GitLabScraper)
+
+// WithBaseURL overrides the GitLab base URL, for self-hosted GitLab or
+// testing with httptest.
+func WithBaseURL(url string) Option {
+	return func(s *GitLabScraper) {
+		s.baseURL = url
+	}
+}
+
+// WithHosts sets the registry hosts CanHandle accepts
+// (default "registry.gitlab.com").
+func WithHosts(hosts ...string) Option {
+	return func(s *GitLabScraper) {
+		s.hosts = hosts
+	}
+}
+
+// WithToken authenticates with a personal, group or project access token
+// with the read_registry or read_api scope.
+func WithToken(token string) Option {
+	return func(s *GitLabScraper) {
+		s.token = token
+	}
+}
+
+// WithJobToken authenticates with a CI job token ($CI_JOB_TOKEN).
+func WithJobToken(token string) Option {
+	return func(s *GitLabScraper) {
+		s.jobToken = token
+	}
+}
+
+// WithLogger sets the logger for fetch diagnostics (default slog.Default()).
+func WithLogger(l *slog.Logger) Option {
+	return func(s *GitLabScraper) {
+		s.logger = l
+	}
+}
+
+// NewGitLabScraper creates a new GitLabScraper using the given HTTP client.
+func NewGitLabScraper(client *http.Client, opts ...Option) *GitLabScraper {
+	s := &GitLabScraper{
+		client:  client,
+		baseURL: defaultBaseURL,
+		hosts:   []string{"registry.gitlab.com"},
+		logger:  slog.Default(),
+		repos:   make(map[string]repoID),
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// CanHandle reports whether this scraper handles the given host.
+func (s *GitLabScraper) CanHandle(host string) bool {
+	return slices.Contains(s.hosts, host)
+}
+
+type tagResponse struct {
+	Digest    string    `json:"digest"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Fetch resolves the image path to its project and registry repository and
+// retrieves the tag's creation time and digest.
+func (s *GitLabScraper) Fetch(ctx context.Context, ref registry.ImageRef) (registry.ImageInfo, error) {
+	id, err := s.resolve(ctx, ref.Repository())
+	if err != nil {
+		return registry.ImageInfo{}, fmt.Errorf("gitlab: resolve %s: %w", ref, err)
+	}
+
+	var data tagResponse
+	path := fmt.Sprintf("/projects/%d/registry/repositories/%d/tags/%s", id.project, id.repo, url.PathEscape(ref.Tag))
+	if _, err := s.get(ctx, path, &data); err != nil {
+		if errors.Is(err, registry.ErrNotFound) {
+			// The repository may have been deleted and recreated; resolve
+			// it again next time.
+			s.mu.Lock()
+			delete(s.repos, ref.Repository())
+			s.mu.Unlock()
+		}
+		return registry.ImageInfo{}, fmt.Errorf("gitlab: %s: %w", ref, err)
+	}
+
+	s.logger.Debug("gitlab: fetched tag", "ref", ref.String(),
+		"pushed", data.CreatedAt, "digest", data.Digest)
+	return registry.ImageInfo{
+		Ref:        ref,
+		LastPushed: data.CreatedAt.UTC(),
+		Digest:     data.Digest,
+	}, nil
+}
+
+// resolve finds the registry repository of an image path. The project is
+// some prefix of the path ("group/sub/project" for
+// "group/sub/project/image"), so candidates are tried longest first.
+func (s *GitLabScraper) resolve(ctx context.Context, imagePath string) (repoID, error) {
+	s.mu.Lock()
+	id, ok := s.repos[imagePath]
+	s.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	segments := strings.Split(imagePath, "/")
+	for n := len(segments); n >= 2; n-- {
+		project := strings.Join(segments[:n], "/")
+		id, err := s.findRepository(ctx, project, imagePath)
+		if errors.Is(err, registry.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return repoID{}, err
+		}
+		s.mu.Lock()
+		s.repos[imagePath] = id
+		s.mu.Unlock()
+		return id, nil
+	}
+	return repoID{}, registry.ErrNotFound
+}
+
+// findRepository looks for the repository with imagePath among the registry
+// repositories of project. It returns ErrNotFound if the project does not
+// exist or has no such repository.
+func (s *GitLabScraper) findRepository(ctx context.Context, project, imagePath string) (repoID, error) {
+	for page := 1; page <= maxRepositoryPages; page++ {
+		var repos []struct {
+			ID        int    `json:"id"`
+			Path      string `json:"path"`
+			ProjectID int    `json:"project_id"`
+		}
+		path := fmt.Sprintf("/projects/%s/registry/repositories?per_page=100&page=%d", url.PathEscape(project), page)
+		header, err := s.get(ctx, path, &repos)
+		if err != nil {
+			return repoID{}, err
+		}
+		for _, r := range repos {
+			if r.Path == imagePath {
+				return repoID{project: r.ProjectID, repo: r.ID}, nil
+			}
+		}
+		if header.Get("X-Next-Page") == "" {
+			break
+		}
+	}
+	return repoID{}, registry.ErrNotFound
+}
+
+// get requests an API path below /api/v4 and decodes the JSON response
+// into v.
+func (s *GitLabScraper) get(ctx context.Context, path string, v any) (http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.baseURL+"/api/v4"+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	switch {
+	case s.token != "":
+		req.Header.Set("PRIVATE-TOKEN", s.token)
+	case s.jobToken != "":
+		req.Header.Set("JOB-TOKEN", s.jobToken)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, registry.ErrNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &registry.StatusError{Code: resp.StatusCode}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return nil, &registry.DecodeError{Err: err}
+	}
+	return resp.Header, nil
+}
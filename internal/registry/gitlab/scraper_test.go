@@ -0,0 +1,138 @@
+package gitlab
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wutscho/registry-ping/internal/registry"
+)
+
+var backend = registry.ImageRef{Host: "registry.gitlab.com", Namespace: "acme/platform/backend", Name: "api", Tag: "v2.1"}
+
+// newTestServer serves the project acme/platform/backend (id 42) with the
+// registry repository acme/platform/backend/api (id 7).
+func newTestServer(t *testing.T, check func(r *http.Request)) (*httptest.Server, *int) {
+	t.Helper()
+	var listRequests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if check != nil {
+			check(r)
+		}
+		switch r.URL.EscapedPath() {
+		case "/api/v4/projects/acme%2Fplatform%2Fbackend/registry/repositories":
+			listRequests++
+			_, _ = w.Write([]byte(`[
+				{"id":6,"path":"acme/platform/backend","project_id":42},
+				{"id":7,"path":"acme/platform/backend/api","project_id":42}
+			]`))
+		case "/api/v4/projects/42/registry/repositories/7/tags/v2.1":
+			_, _ = w.Write([]byte(`{"name":"v2.1","path":"acme/platform/backend/api:v2.1",
+				"digest":"sha256:c0ffee","created_at":"2026-04-01T09:15:00.000+02:00"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &listRequests
+}
+
+func TestFetch_NestedGroups(t *testing.T) {
+	server, listRequests := newTestServer(t, nil)
+	s := NewGitLabScraper(server.Client(), WithBaseURL(server.URL))
+
+	for range 2 {
+		info, err := s.Fetch(context.Background(), backend)
+		require.NoError(t, err)
+		assert.Equal(t, backend, info.Ref)
+		assert.Equal(t, "sha256:c0ffee", info.Digest)
+		assert.Equal(t, time.Date(2026, 4, 1, 7, 15, 0, 0, time.UTC), info.LastPushed)
+	}
+	assert.Equal(t, 1, *listRequests, "resolved repository is cached")
+}
+
+func TestFetch_ProjectRootRepository(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case "/api/v4/projects/acme%2Ftool/registry/repositories":
+			_, _ = w.Write([]byte(`[{"id":3,"path":"acme/tool","project_id":9}]`))
+		case "/api/v4/projects/9/registry/repositories/3/tags/1.0":
+			_, _ = w.Write([]byte(`{"digest":"sha256:abc","created_at":"2026-01-01T00:00:00Z"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	ref := registry.ImageRef{Host: "registry.gitlab.com", Namespace: "acme", Name: "tool", Tag: "1.0"}
+	info, err := NewGitLabScraper(server.Client(), WithBaseURL(server.URL)).Fetch(context.Background(), ref)
+	require.NoError(t, err)
+	assert.Equal(t, "sha256:abc", info.Digest)
+}
+
+func TestFetch_Tokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		opt    Option
+		header string
+		value  string
+	}{
+		{"access token", WithToken("glpat-secret"), "PRIVATE-TOKEN", "glpat-secret"},
+		{"job token", WithJobToken("job-secret"), "JOB-TOKEN", "job-secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _ := newTestServer(t, func(r *http.Request) {
+				assert.Equal(t, tt.value, r.Header.Get(tt.header))
+			})
+			_, err := NewGitLabScraper(server.Client(), WithBaseURL(server.URL), tt.opt).Fetch(context.Background(), backend)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestFetch_TagNotFound(t *testing.T) {
+	server, listRequests := newTestServer(t, nil)
+	s := NewGitLabScraper(server.Client(), WithBaseURL(server.URL))
+
+	ref := backend
+	ref.Tag = "missing"
+	for range 2 {
+		_, err := s.Fetch(context.Background(), ref)
+		assert.True(t, errors.Is(err, registry.ErrNotFound))
+	}
+	assert.Equal(t, 2, *listRequests, "repository is resolved again after a 404")
+}
+
+func TestFetch_UnknownRepository(t *testing.T) {
+	server, _ := newTestServer(t, nil)
+	ref := registry.ImageRef{Host: "registry.gitlab.com", Namespace: "acme/other", Name: "api", Tag: "v1"}
+
+	_, err := NewGitLabScraper(server.Client(), WithBaseURL(server.URL)).Fetch(context.Background(), ref)
+	assert.True(t, errors.Is(err, registry.ErrNotFound))
+}
+
+func TestFetch_Unauthorized(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	_, err := NewGitLabScraper(server.Client(), WithBaseURL(server.URL)).Fetch(context.Background(), backend)
+	var statusErr *registry.StatusError
+	require.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusUnauthorized, statusErr.Code)
+}
+
+func TestCanHandle(t *testing.T) {
+	assert.True(t, NewGitLabScraper(nil).CanHandle("registry.gitlab.com"))
+
+	s := NewGitLabScraper(nil, WithHosts("registry.corp.example", "gitlab.corp.example:5050"))
+	assert.True(t, s.CanHandle("gitlab.corp.example:5050"))
+	assert.False(t, s.CanHandle("registry.gitlab.com"))
+}
@@ -0,0 +1,169 @@
+// Package google reads image metadata from Google Artifact Registry
+// (*-docker.pkg.dev) and Container Registry (gcr.io) through the Docker v2
+// API and Google's tags/list extension.
+package google
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wutscho/registry-ping/internal/registry"
+	"github.com/wutscho/registry-ping/internal/registry/oci"
+)
+
+// GoogleScraper fetches push times and digests from the tags/list response
+// of Google's registries, which lists every manifest with its tags and
+// upload time.
+type GoogleScraper struct {
+	client      *http.Client
+	registryURL string
+	hosts       []string
+	account     *ServiceAccount
+	tokenURL    string
+	logger      *slog.Logger
+	auth        *oci.Authorizer
+	now         func() time.Time
+}
+
+// Option is a functional option for GoogleScraper.
+type Option func(*GoogleScraper)
+
+// WithRegistryURL overrides the registry base URL, which defaults to
+// "https://<host>" of each image (useful for testing with httptest).
+func WithRegistryURL(url string) Option {
+	return func(s *GoogleScraper) {
+		s.registryURL = url
+	}
+}
+
+// WithHosts restricts CanHandle to the given hosts, e.g. to use a
+// different service account per Artifact Registry location.
+func WithHosts(hosts ...string) Option {
+	return func(s *GoogleScraper) {
+		s.hosts = hosts
+	}
+}
+
+// WithServiceAccount authenticates with a service account key. Without
+// one, only public images can be read.
+func WithServiceAccount(sa *ServiceAccount) Option {
+	return func(s *GoogleScraper) {
+		s.account = sa
+	}
+}
+
+// WithTokenURL overrides the OAuth token endpoint of the service account
+// key (useful for testing with a fake).
+func WithTokenURL(url string) Option {
+	return func(s *GoogleScraper) {
+		s.tokenURL = url
+	}
+}
+
+// WithLogger sets the logger for fetch diagnostics (default slog.Default()).
+func WithLogger(l *slog.Logger) Option {
+	return func(s *GoogleScraper) {
+		s.logger = l
+	}
+}
+
+// NewGoogleScraper creates a new GoogleScraper using the given HTTP client.
+func NewGoogleScraper(client *http.Client, opts ...Option) *GoogleScraper {
+	s := &GoogleScraper{
+		client: client,
+		logger: slog.Default(),
+		now:    time.Now,
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	if s.account != nil && s.tokenURL != "" {
+		s.account.TokenURL = s.tokenURL
+	}
+	var credentials oci.CredentialsFunc
+	if s.account != nil {
+		credentials = func(ctx context.Context) (string, string, error) {
+			token, err := s.account.AccessToken(ctx, s.client, s.now())
+			// Google's registries take an OAuth access token as the
+			// password of this fixed user name.
+			return "oauth2accesstoken", token, err
+		}
+	}
+	s.auth = oci.NewAuthorizer(client, credentials)
+	return s
+}
+
+// CanHandle reports whether host is Container Registry (gcr.io and its
+// regional hosts) or an Artifact Registry location (*-docker.pkg.dev).
+func (s *GoogleScraper) CanHandle(host string) bool {
+	if len(s.hosts) > 0 {
+		return slices.Contains(s.hosts, host)
+	}
+	return host == "gcr.io" || strings.HasSuffix(host, ".gcr.io") || strings.HasSuffix(host, "-docker.pkg.dev")
+}
+
+// tagsResponse is Google's tags/list, extended with a manifest map keyed
+// by digest. Times are milliseconds since the epoch, as strings.
+type tagsResponse struct {
+	Manifest map[string]struct {
+		Tag            []string `json:"tag"`
+		TimeCreatedMs  string   `json:"timeCreatedMs"`
+		TimeUploadedMs string   `json:"timeUploadedMs"`
+	} `json:"manifest"`
+}
+
+// Fetch lists the repository's tags and returns the upload time and digest
+// of the manifest carrying the tag.
+func (s *GoogleScraper) Fetch(ctx context.Context, ref registry.ImageRef) (registry.ImageInfo, error) {
+	base := s.registryURL
+	if base == "" {
+		base = "https://" + ref.Host
+	}
+	u := fmt.Sprintf("%s/v2/%s/tags/list", strings.TrimSuffix(base, "/"), ref.Repository())
+
+	resp, err := s.auth.Do(ctx, "repository:"+ref.Repository()+":pull", func() (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	})
+	if err != nil {
+		return registry.ImageInfo{}, fmt.Errorf("google: fetch %s: %w", ref, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return registry.ImageInfo{}, fmt.Errorf("google: %s: %w", ref, registry.ErrNotFound)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return registry.ImageInfo{}, fmt.Errorf("google: %s: %w", ref, &registry.StatusError{Code: resp.StatusCode})
+	}
+
+	var data tagsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return registry.ImageInfo{}, fmt.Errorf("google: decode response for %s: %w", ref, &registry.DecodeError{Err: err})
+	}
+
+	for digest, m := range data.Manifest {
+		if !slices.Contains(m.Tag, ref.Tag) {
+			continue
+		}
+		ms := m.TimeUploadedMs
+		if ms == "" || ms == "0" {
+			ms = m.TimeCreatedMs
+		}
+		millis, err := strconv.ParseInt(ms, 10, 64)
+		if err != nil {
+			return registry.ImageInfo{}, fmt.Errorf("google: decode response for %s: %w", ref,
+				&registry.DecodeError{Err: fmt.Errorf("manifest time %q: %w", ms, err)})
+		}
+		info := registry.ImageInfo{Ref: ref, LastPushed: time.UnixMilli(millis).UTC(), Digest: digest}
+		s.logger.Debug("google: fetched tag", "ref", ref.String(), "pushed", info.LastPushed, "digest", info.Digest)
+		return info, nil
+	}
+	return registry.ImageInfo{}, fmt.Errorf("google: %s: %w", ref, registry.ErrNotFound)
+}
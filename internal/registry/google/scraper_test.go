@@ -0,0 +1,116 @@
+package google
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wutscho/registry-ping/internal/registry"
+)
+
+var image = registry.ImageRef{Host: "europe-west3-docker.pkg.dev", Namespace: "my-project/images", Name: "api", Tag: "v5"}
+
+const tagsList = `{
+	"child": [],
+	"manifest": {
+		"sha256:old": {"imageSizeBytes":"1","mediaType":"application/vnd.oci.image.index.v1+json",
+			"tag":["v4"],"timeCreatedMs":"1767225600000","timeUploadedMs":"1767225600000"},
+		"sha256:new": {"imageSizeBytes":"1","mediaType":"application/vnd.oci.image.index.v1+json",
+			"tag":["v5","latest"],"timeCreatedMs":"0","timeUploadedMs":"1772000000123"}
+	},
+	"name": "my-project/images/api",
+	"tags": ["latest","v4","v5"]
+}`
+
+// newRegistry serves tags/list behind a bearer token challenge. With
+// wantPassword set, the token service requires it as the basic password.
+func newRegistry(t *testing.T, wantPassword string) *httptest.Server {
+	t.Helper()
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/token":
+			user, pass, _ := r.BasicAuth()
+			if wantPassword != "" && (user != "oauth2accesstoken" || pass != wantPassword) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			_, _ = w.Write([]byte(`{"token":"registry-token"}`))
+		case "/v2/my-project/images/api/tags/list":
+			if r.Header.Get("Authorization") != "Bearer registry-token" {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/v2/token",service="europe-west3-docker.pkg.dev"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte(tagsList))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFetch_Anonymous(t *testing.T) {
+	server := newRegistry(t, "")
+	s := NewGoogleScraper(server.Client(), WithRegistryURL(server.URL))
+
+	info, err := s.Fetch(context.Background(), image)
+	require.NoError(t, err)
+	assert.Equal(t, image, info.Ref)
+	assert.Equal(t, "sha256:new", info.Digest)
+	assert.Equal(t, time.UnixMilli(1772000000123).UTC(), info.LastPushed)
+}
+
+func TestFetch_ServiceAccount(t *testing.T) {
+	var exchanges int
+	data, key := newKey(t, "https://oauth2.googleapis.com/token")
+	tokenServer := newTokenServer(t, key, &exchanges)
+	sa, err := ParseServiceAccount(data)
+	require.NoError(t, err)
+
+	server := newRegistry(t, "ya29.access")
+	s := NewGoogleScraper(server.Client(), WithRegistryURL(server.URL),
+		WithServiceAccount(sa), WithTokenURL(tokenServer.URL+"/token"))
+
+	info, err := s.Fetch(context.Background(), image)
+	require.NoError(t, err)
+	assert.Equal(t, "sha256:new", info.Digest)
+	assert.Equal(t, 1, exchanges)
+}
+
+func TestFetch_TagNotListed(t *testing.T) {
+	server := newRegistry(t, "")
+	ref := image
+	ref.Tag = "v6"
+
+	_, err := NewGoogleScraper(server.Client(), WithRegistryURL(server.URL)).Fetch(context.Background(), ref)
+	assert.True(t, errors.Is(err, registry.ErrNotFound))
+}
+
+func TestFetch_RepositoryNotFound(t *testing.T) {
+	server := newRegistry(t, "")
+	ref := image
+	ref.Name = "missing"
+
+	_, err := NewGoogleScraper(server.Client(), WithRegistryURL(server.URL)).Fetch(context.Background(), ref)
+	assert.True(t, errors.Is(err, registry.ErrNotFound))
+}
+
+func TestCanHandle(t *testing.T) {
+	s := NewGoogleScraper(nil)
+	for _, host := range []string{"gcr.io", "eu.gcr.io", "europe-west3-docker.pkg.dev", "us-docker.pkg.dev"} {
+		assert.True(t, s.CanHandle(host), host)
+	}
+	assert.False(t, s.CanHandle("docker.io"))
+	assert.False(t, s.CanHandle("pkg.dev"))
+
+	s = NewGoogleScraper(nil, WithHosts("us-docker.pkg.dev"))
+	assert.True(t, s.CanHandle("us-docker.pkg.dev"))
+	assert.False(t, s.CanHandle("gcr.io"))
+}
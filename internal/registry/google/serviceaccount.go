@@ -0,0 +1,159 @@
+package google
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wutscho/registry-ping/internal/registry"
+)
+
+const (
+	defaultTokenURL = "https://oauth2.googleapis.com/token"
+	tokenScope      = "https://www.googleapis.com/auth/cloud-platform.read-only"
+	// tokenLifetime is the lifetime requested for the signed assertion;
+	// Google caps it at one hour.
+	tokenLifetime = time.Hour
+	// refreshEarly renews access tokens this long before they expire.
+	refreshEarly = time.Minute
+)
+
+// ServiceAccount is a Google service account key, as downloaded in JSON
+// format. It exchanges a locally signed JWT for OAuth access tokens.
+type ServiceAccount struct {
+	Email    string
+	KeyID    string
+	TokenURL string
+	key      *rsa.PrivateKey
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// LoadServiceAccount reads a service account JSON key file.
+func LoadServiceAccount(path string) (*ServiceAccount, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("google: read service account key: %w", err)
+	}
+	return ParseServiceAccount(data)
+}
+
+// ParseServiceAccount parses a service account JSON key.
+func ParseServiceAccount(data []byte) (*ServiceAccount, error) {
+	var f struct {
+		Type         string `json:"type"`
+		ClientEmail  string `json:"client_email"`
+		PrivateKeyID string `json:"private_key_id"`
+		PrivateKey   string `json:"private_key"`
+		TokenURI     string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("google: parse service account key: %w", err)
+	}
+	if f.Type != "service_account" {
+		return nil, fmt.Errorf("google: key type %q is not service_account", f.Type)
+	}
+	block, _ := pem.Decode([]byte(f.PrivateKey))
+	if block == nil {
+		return nil, errors.New("google: service account key: no PEM private key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf("google: service account key: %w", err)
+		}
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("google: service account key is not an RSA key")
+	}
+	if f.TokenURI == "" {
+		f.TokenURI = defaultTokenURL
+	}
+	return &ServiceAccount{Email: f.ClientEmail, KeyID: f.PrivateKeyID, TokenURL: f.TokenURI, key: key}, nil
+}
+
+// AccessToken returns a cached access token, or exchanges a new JWT
+// assertion at TokenURL if it is about to expire.
+func (sa *ServiceAccount) AccessToken(ctx context.Context, client *http.Client, now time.Time) (string, error) {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+	if sa.token != "" && now.Add(refreshEarly).Before(sa.expires) {
+		return sa.token, nil
+	}
+
+	assertion, err := sa.assertion(now)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sa.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token exchange: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token exchange: %w", &registry.StatusError{Code: resp.StatusCode})
+	}
+
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return "", fmt.Errorf("token exchange: %w", &registry.DecodeError{Err: err})
+	}
+	sa.token = tok.AccessToken
+	sa.expires = now.Add(time.Duration(tok.ExpiresIn) * time.Second)
+	return sa.token, nil
+}
+
+// assertion returns the RS256-signed JWT presented to the token endpoint.
+func (sa *ServiceAccount) assertion(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": sa.KeyID})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]any{
+		"iss":   sa.Email,
+		"scope": tokenScope,
+		"aud":   sa.TokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(tokenLifetime).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, sa.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", fmt.Errorf("google: sign assertion: %w", err)
+	}
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
@@ -0,0 +1,101 @@
+package google
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newKey returns a service account JSON key with a fresh RSA key.
+func newKey(t *testing.T, tokenURL string) ([]byte, *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	data, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"client_email":   "ping@project.iam.gserviceaccount.com",
+		"private_key_id": "key-1",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":      tokenURL,
+	})
+	require.NoError(t, err)
+	return data, key
+}
+
+// newTokenServer is a fake OAuth token endpoint that verifies the JWT
+// assertion against key and counts exchanges.
+func newTokenServer(t *testing.T, key *rsa.PrivateKey, exchanges *int) *httptest.Server {
+	t.Helper()
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "urn:ietf:params:oauth:grant-type:jwt-bearer", r.PostForm.Get("grant_type"))
+
+		parts := strings.Split(r.PostForm.Get("assertion"), ".")
+		require.Len(t, parts, 3)
+		sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+		require.NoError(t, err)
+		sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		assert.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, sum[:], sig))
+
+		claims, err := base64.RawURLEncoding.DecodeString(parts[1])
+		require.NoError(t, err)
+		var c map[string]any
+		require.NoError(t, json.Unmarshal(claims, &c))
+		assert.Equal(t, "ping@project.iam.gserviceaccount.com", c["iss"])
+		assert.Equal(t, server.URL+"/token", c["aud"])
+		assert.Equal(t, tokenScope, c["scope"])
+
+		*exchanges++
+		_, _ = w.Write([]byte(`{"access_token":"ya29.access","expires_in":3600,"token_type":"Bearer"}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestServiceAccount_AccessToken(t *testing.T) {
+	var exchanges int
+	data, key := newKey(t, "")
+	server := newTokenServer(t, key, &exchanges)
+
+	sa, err := ParseServiceAccount(data)
+	require.NoError(t, err)
+	assert.Equal(t, "https://oauth2.googleapis.com/token", sa.TokenURL, "default token endpoint")
+	sa.TokenURL = server.URL + "/token"
+
+	now := time.Now()
+	for range 2 {
+		token, err := sa.AccessToken(context.Background(), server.Client(), now)
+		require.NoError(t, err)
+		assert.Equal(t, "ya29.access", token)
+	}
+	assert.Equal(t, 1, exchanges, "token is cached")
+
+	_, err = sa.AccessToken(context.Background(), server.Client(), now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 2, exchanges, "expired token is renewed")
+}
+
+func TestParseServiceAccount_Invalid(t *testing.T) {
+	_, err := ParseServiceAccount([]byte(`{"type":"authorized_user"}`))
+	assert.ErrorContains(t, err, "not service_account")
+
+	_, err = ParseServiceAccount([]byte(`{"type":"service_account","private_key":"nope"}`))
+	assert.ErrorContains(t, err, "no PEM private key")
+}
@@ -0,0 +1,164 @@
+// Package harbor reads artifact metadata from the Harbor v2 API.
+package harbor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/wutscho/registry-ping/internal/registry"
+)
+
+// HarborScraper fetches artifact push times and digests from a Harbor
+// instance (/api/v2.0/projects/<project>/repositories/<repo>/artifacts/<tag>).
+type HarborScraper struct {
+	client   *http.Client
+	baseURL  string
+	hosts    []string
+	username string
+	password string
+	scan     bool
+	logger   *slog.Logger
+}
+
+// Option is a functional option for HarborScraper.
+type Option func(*HarborScraper)
+
+// WithHosts sets the image hosts CanHandle accepts (default the host of the
+// base URL).
+func WithHosts(hosts ...string) Option {
+	return func(s *HarborScraper) {
+		s.hosts = hosts
+	}
+}
+
+// WithRobotAccount authenticates as a robot account, e.g.
+// "robot$registry-ping", with its secret.
+func WithRobotAccount(name, secret string) Option {
+	return func(s *HarborScraper) {
+		s.username = name
+		s.password = secret
+	}
+}
+
+// WithScanOverview asks Harbor for the artifact's vulnerability scan
+// summary and reports it in ImageInfo.Scan.
+func WithScanOverview() Option {
+	return func(s *HarborScraper) {
+		s.scan = true
+	}
+}
+
+// WithLogger sets the logger for fetch diagnostics (default slog.Default()).
+func WithLogger(l *slog.Logger) Option {
+	return func(s *HarborScraper) {
+		s.logger = l
+	}
+}
+
+// NewHarborScraper creates a HarborScraper for the instance at baseURL,
+// e.g. "https://harbor.example.com".
+func NewHarborScraper(client *http.Client, baseURL string, opts ...Option) *HarborScraper {
+	s := &HarborScraper{
+		client:  client,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		logger:  slog.Default(),
+	}
+	if u, err := url.Parse(s.baseURL); err == nil {
+		s.hosts = []string{u.Host}
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// CanHandle reports whether this scraper handles the given host.
+func (s *HarborScraper) CanHandle(host string) bool {
+	return slices.Contains(s.hosts, host)
+}
+
+type artifactResponse struct {
+	Digest   string    `json:"digest"`
+	PushTime time.Time `json:"push_time"`
+	// ScanOverview is keyed by report MIME type.
+	ScanOverview map[string]struct {
+		ScanStatus string    `json:"scan_status"`
+		Severity   string    `json:"severity"`
+		EndTime    time.Time `json:"end_time"`
+		Summary    struct {
+			Total   int            `json:"total"`
+			Fixable int            `json:"fixable"`
+			Summary map[string]int `json:"summary"`
+		} `json:"summary"`
+	} `json:"scan_overview"`
+}
+
+// Fetch retrieves the push time and digest of the artifact the tag points
+// to. The first path segment of the image is the Harbor project.
+func (s *HarborScraper) Fetch(ctx context.Context, ref registry.ImageRef) (registry.ImageInfo, error) {
+	project, repo, ok := strings.Cut(ref.Repository(), "/")
+	if !ok {
+		return registry.ImageInfo{}, fmt.Errorf("harbor: %s: image path must start with a project", ref)
+	}
+	// Harbor expects slashes in repository names to be encoded twice.
+	u := fmt.Sprintf("%s/api/v2.0/projects/%s/repositories/%s/artifacts/%s?with_tag=false&with_scan_overview=%t",
+		s.baseURL, url.PathEscape(project), url.PathEscape(url.PathEscape(repo)), url.PathEscape(ref.Tag), s.scan)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return registry.ImageInfo{}, fmt.Errorf("harbor: create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return registry.ImageInfo{}, fmt.Errorf("harbor: fetch %s: %w", ref, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return registry.ImageInfo{}, fmt.Errorf("harbor: %s: %w", ref, registry.ErrNotFound)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return registry.ImageInfo{}, fmt.Errorf("harbor: %s: %w", ref, &registry.StatusError{Code: resp.StatusCode})
+	}
+
+	var data artifactResponse
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return registry.ImageInfo{}, fmt.Errorf("harbor: decode response for %s: %w", ref, &registry.DecodeError{Err: err})
+	}
+
+	info := registry.ImageInfo{
+		Ref:        ref,
+		LastPushed: data.PushTime.UTC(),
+		Digest:     data.Digest,
+	}
+	// Harbor reports one overview per scanner report type; there is
+	// normally exactly one, otherwise the first by type is used.
+	if types := slices.Sorted(maps.Keys(data.ScanOverview)); len(types) > 0 {
+		o := data.ScanOverview[types[0]]
+		info.Scan = &registry.ScanSummary{
+			Status:     o.ScanStatus,
+			Severity:   o.Severity,
+			Total:      o.Summary.Total,
+			Fixable:    o.Summary.Fixable,
+			BySeverity: o.Summary.Summary,
+			ScannedAt:  o.EndTime.UTC(),
+		}
+	}
+
+	s.logger.Debug("harbor: fetched artifact", "ref", ref.String(),
+		"pushed", info.LastPushed, "digest", info.Digest)
+	return info, nil
+}
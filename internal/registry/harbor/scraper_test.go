@@ -0,0 +1,108 @@
+package harbor
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wutscho/registry-ping/internal/registry"
+)
+
+var app = registry.ImageRef{Host: "harbor.example.com", Namespace: "team/backend", Name: "api", Tag: "1.4"}
+
+const artifact = `{
+	"digest": "sha256:feed",
+	"push_time": "2026-05-02T11:00:00.123Z",
+	"pull_time": "2026-05-03T08:00:00Z",
+	"labels": [{"name": "prod"}],
+	"scan_overview": {
+		"application/vnd.security.vulnerability.report; version=1.1": {
+			"scan_status": "Success",
+			"severity": "High",
+			"end_time": "2026-05-02T11:05:00Z",
+			"summary": {"total": 7, "fixable": 4, "summary": {"High": 2, "Medium": 5}}
+		}
+	}
+}`
+
+func TestFetch_Artifact(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v2.0/projects/team/repositories/backend%252Fapi/artifacts/1.4", r.URL.EscapedPath())
+		assert.Equal(t, "false", r.URL.Query().Get("with_scan_overview"))
+		user, pass, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "robot$registry-ping", user)
+		assert.Equal(t, "s3cret", pass)
+		_, _ = w.Write([]byte(`{"digest":"sha256:feed","push_time":"2026-05-02T11:00:00.123Z"}`))
+	}))
+	defer server.Close()
+
+	s := NewHarborScraper(server.Client(), server.URL, WithRobotAccount("robot$registry-ping", "s3cret"))
+	info, err := s.Fetch(context.Background(), app)
+	require.NoError(t, err)
+	assert.Equal(t, app, info.Ref)
+	assert.Equal(t, "sha256:feed", info.Digest)
+	assert.Equal(t, time.Date(2026, 5, 2, 11, 0, 0, 123000000, time.UTC), info.LastPushed)
+	assert.Nil(t, info.Scan)
+}
+
+func TestFetch_ScanOverview(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "true", r.URL.Query().Get("with_scan_overview"))
+		_, _ = w.Write([]byte(artifact))
+	}))
+	defer server.Close()
+
+	info, err := NewHarborScraper(server.Client(), server.URL, WithScanOverview()).Fetch(context.Background(), app)
+	require.NoError(t, err)
+	require.NotNil(t, info.Scan)
+	assert.Equal(t, registry.ScanSummary{
+		Status:     "Success",
+		Severity:   "High",
+		Total:      7,
+		Fixable:    4,
+		BySeverity: map[string]int{"High": 2, "Medium": 5},
+		ScannedAt:  time.Date(2026, 5, 2, 11, 5, 0, 0, time.UTC),
+	}, *info.Scan)
+}
+
+func TestFetch_NotFound(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	_, err := NewHarborScraper(server.Client(), server.URL).Fetch(context.Background(), app)
+	assert.True(t, errors.Is(err, registry.ErrNotFound))
+}
+
+func TestFetch_Forbidden(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	_, err := NewHarborScraper(server.Client(), server.URL).Fetch(context.Background(), app)
+	var statusErr *registry.StatusError
+	require.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusForbidden, statusErr.Code)
+}
+
+func TestFetch_ProjectRequired(t *testing.T) {
+	s := NewHarborScraper(nil, "https://harbor.example.com")
+	_, err := s.Fetch(context.Background(), registry.ImageRef{Host: "harbor.example.com", Name: "api", Tag: "1"})
+	assert.ErrorContains(t, err, "must start with a project")
+}
+
+func TestCanHandle(t *testing.T) {
+	s := NewHarborScraper(nil, "https://harbor.example.com")
+	assert.True(t, s.CanHandle("harbor.example.com"))
+	assert.False(t, s.CanHandle("docker.io"))
+
+	s = NewHarborScraper(nil, "https://harbor-api.internal", WithHosts("harbor.example.com"))
+	assert.True(t, s.CanHandle("harbor.example.com"))
+	assert.False(t, s.CanHandle("harbor-api.internal"))
+}
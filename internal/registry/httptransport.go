@@ -0,0 +1,78 @@
+package registry
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// ProxyDirect as HTTPOptions.ProxyURL disables proxying, including proxies
+// set in the environment.
+const ProxyDirect = "direct"
+
+// HTTPOptions configures the connection to a single registry.
+type HTTPOptions struct {
+	// ProxyURL is the proxy for all requests, e.g. "http://proxy:3128".
+	// Empty uses HTTPS_PROXY/HTTP_PROXY/NO_PROXY from the environment;
+	// ProxyDirect connects directly.
+	ProxyURL string
+	// CAFile is a PEM bundle trusted in addition to the system roots.
+	CAFile string
+	// CertFile and KeyFile are a PEM client certificate and key for mTLS.
+	CertFile string
+	KeyFile  string
+	// InsecureSkipVerify disables server certificate verification. Only
+	// meant for lab registries.
+	InsecureSkipVerify bool
+}
+
+// NewHTTPTransport returns a copy of http.DefaultTransport configured by opts.
+func NewHTTPTransport(opts HTTPOptions) (*http.Transport, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+
+	switch opts.ProxyURL {
+	case "":
+	case ProxyDirect:
+		t.Proxy = nil
+	default:
+		u, err := url.Parse(opts.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("registry: parse proxy url: %w", err)
+		}
+		t.Proxy = http.ProxyURL(u)
+	}
+
+	if opts.CAFile == "" && opts.CertFile == "" && !opts.InsecureSkipVerify {
+		return t, nil
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: opts.InsecureSkipVerify,
+	}
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("registry: read ca file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("registry: ca file %s: no PEM certificates found", opts.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("registry: load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	t.TLSClientConfig = tlsConfig
+	return t, nil
+}
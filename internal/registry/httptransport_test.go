@@ -0,0 +1,135 @@
+package registry
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writePEM writes the DER blocks as PEM of the given type and returns the path.
+func writePEM(t *testing.T, name, typ string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600))
+	return path
+}
+
+// newClientCert creates a self-signed client certificate and returns it
+// together with the paths of its PEM cert and key files.
+func newClientCert(t *testing.T) (*x509.Certificate, string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "registry-ping"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return cert, writePEM(t, "client.pem", "CERTIFICATE", der), writePEM(t, "client-key.pem", "EC PRIVATE KEY", keyDER)
+}
+
+func get(t *testing.T, tr *http.Transport, url string) error {
+	t.Helper()
+	resp, err := (&http.Client{Transport: tr}).Get(url)
+	if err == nil {
+		resp.Body.Close()
+	}
+	return err
+}
+
+func TestNewHTTPTransport_CAFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	tr, err := NewHTTPTransport(HTTPOptions{})
+	require.NoError(t, err)
+	require.Error(t, get(t, tr, server.URL), "unknown CA must be rejected")
+
+	ca := writePEM(t, "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+	tr, err = NewHTTPTransport(HTTPOptions{CAFile: ca})
+	require.NoError(t, err)
+	require.NoError(t, get(t, tr, server.URL))
+}
+
+func TestNewHTTPTransport_InsecureSkipVerify(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	tr, err := NewHTTPTransport(HTTPOptions{InsecureSkipVerify: true})
+	require.NoError(t, err)
+	require.NoError(t, get(t, tr, server.URL))
+}
+
+func TestNewHTTPTransport_ClientCertificate(t *testing.T) {
+	clientCert, certFile, keyFile := newClientCert(t)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Len(t, r.TLS.PeerCertificates, 1)
+		assert.Equal(t, "registry-ping", r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	pool := x509.NewCertPool()
+	pool.AddCert(clientCert)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	server.StartTLS()
+	defer server.Close()
+
+	ca := writePEM(t, "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+	tr, err := NewHTTPTransport(HTTPOptions{CAFile: ca})
+	require.NoError(t, err)
+	require.Error(t, get(t, tr, server.URL), "missing client certificate must be rejected")
+
+	tr, err = NewHTTPTransport(HTTPOptions{CAFile: ca, CertFile: certFile, KeyFile: keyFile})
+	require.NoError(t, err)
+	require.NoError(t, get(t, tr, server.URL))
+}
+
+func TestNewHTTPTransport_Proxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+	}))
+	defer proxy.Close()
+
+	tr, err := NewHTTPTransport(HTTPOptions{ProxyURL: proxy.URL})
+	require.NoError(t, err)
+	require.NoError(t, get(t, tr, "http://registry.example/v2/"))
+	assert.Equal(t, "http://registry.example/v2/", proxied)
+
+	tr, err = NewHTTPTransport(HTTPOptions{ProxyURL: ProxyDirect})
+	require.NoError(t, err)
+	assert.Nil(t, tr.Proxy)
+}
+
+func TestNewHTTPTransport_Errors(t *testing.T) {
+	_, err := NewHTTPTransport(HTTPOptions{CAFile: "/nonexistent/ca.pem"})
+	require.Error(t, err)
+
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	require.NoError(t, os.WriteFile(empty, nil, 0o600))
+	_, err = NewHTTPTransport(HTTPOptions{CAFile: empty})
+	require.ErrorContains(t, err, "no PEM certificates")
+
+	_, err = NewHTTPTransport(HTTPOptions{CertFile: empty, KeyFile: empty})
+	require.ErrorContains(t, err, "client certificate")
+}
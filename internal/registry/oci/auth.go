@@ -0,0 +1,164 @@
+package oci
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/wutscho/registry-ping/internal/registry"
+)
+
+// CredentialsFunc returns the user name and password for a registry's token
+// service, or empty strings for anonymous access. It is called whenever a
+// new token is needed, so it may return short-lived credentials.
+type CredentialsFunc func(ctx context.Context) (username, password string, err error)
+
+// Authorizer answers the 401 challenges of a distribution API registry with
+// basic credentials or a bearer token from the challenge's realm, and
+// caches the resulting Authorization header per scope.
+type Authorizer struct {
+	client      *http.Client
+	credentials CredentialsFunc
+
+	mu     sync.Mutex
+	tokens map[string]string // Authorization header per scope
+}
+
+// NewAuthorizer creates an Authorizer fetching tokens with client. A nil
+// credentials function means anonymous access.
+func NewAuthorizer(client *http.Client, credentials CredentialsFunc) *Authorizer {
+	if credentials == nil {
+		credentials = func(context.Context) (string, string, error) { return "", "", nil }
+	}
+	return &Authorizer{client: client, credentials: credentials, tokens: make(map[string]string)}
+}
+
+// Do sends the request built by newRequest with the cached authorization for
+// scope, e.g. "repository:library/php:pull". On a 401 it answers the
+// challenge and sends a new request once.
+func (a *Authorizer) Do(ctx context.Context, scope string, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	a.mu.Lock()
+	auth := a.tokens[scope]
+	a.mu.Unlock()
+
+	resp, err := a.send(newRequest, auth)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+
+	auth, err = a.authorize(ctx, challenge, scope)
+	if err != nil {
+		return nil, err
+	}
+	a.mu.Lock()
+	a.tokens[scope] = auth
+	a.mu.Unlock()
+	return a.send(newRequest, auth)
+}
+
+func (a *Authorizer) send(newRequest func() (*http.Request, error), auth string) (*http.Response, error) {
+	req, err := newRequest()
+	if err != nil {
+		return nil, err
+	}
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	return a.client.Do(req)
+}
+
+// authorize answers a WWW-Authenticate challenge with an Authorization
+// header value: basic credentials, or a bearer token from the realm.
+func (a *Authorizer) authorize(ctx context.Context, challenge, scope string) (string, error) {
+	username, password, err := a.credentials(ctx)
+	if err != nil {
+		return "", fmt.Errorf("credentials: %w", err)
+	}
+
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if username == "" {
+			return "", &registry.StatusError{Code: http.StatusUnauthorized}
+		}
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password)), nil
+	case "bearer":
+	default:
+		return "", fmt.Errorf("unsupported auth challenge %q: %w", scheme, &registry.StatusError{Code: http.StatusUnauthorized})
+	}
+
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Scheme == "" {
+		return "", fmt.Errorf("invalid token realm %q", params["realm"])
+	}
+	q := realm.Query()
+	if params["service"] != "" {
+		q.Set("service", params["service"])
+	}
+	if params["scope"] != "" {
+		scope = params["scope"]
+	}
+	q.Set("scope", scope)
+	realm.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token: %w", &registry.StatusError{Code: resp.StatusCode})
+	}
+
+	var tok struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return "", fmt.Errorf("token: %w", &registry.DecodeError{Err: err})
+	}
+	if tok.Token == "" {
+		tok.Token = tok.AccessToken
+	}
+	return "Bearer " + tok.Token, nil
+}
+
+// parseChallenge splits a WWW-Authenticate value such as
+// `Bearer realm="https://auth.example/token",service="registry"` into its
+// scheme and parameters.
+func parseChallenge(h string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(h), " ")
+	params := make(map[string]string)
+	for rest != "" {
+		var key, value string
+		key, rest, _ = strings.Cut(strings.TrimLeft(rest, " ,"), "=")
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		if key = strings.ToLower(strings.TrimSpace(key)); key != "" {
+			params[key] = value
+		}
+	}
+	return scheme, params
+}
@@ -0,0 +1,62 @@
+package oci
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthorizer_RenewsExpiredToken(t *testing.T) {
+	var server *httptest.Server
+	valid := ""
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			_, pass, _ := r.BasicAuth()
+			valid = "Bearer for-" + pass
+			_, _ = w.Write([]byte(`{"token":"for-` + pass + `"}`))
+			return
+		}
+		if r.Header.Get("Authorization") != valid || valid == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}))
+	defer server.Close()
+
+	calls := 0
+	a := NewAuthorizer(server.Client(), func(context.Context) (string, string, error) {
+		calls++
+		return "oauth2accesstoken", []string{"", "first", "second"}[calls], nil
+	})
+	get := func() (*http.Request, error) { return http.NewRequest(http.MethodGet, server.URL+"/v2/", nil) }
+
+	resp, err := a.Do(context.Background(), "repository:a:pull", get)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// The registry token expires; the next request fetches a new one with
+	// fresh credentials.
+	valid = "expired"
+	resp, err = a.Do(context.Background(), "repository:a:pull", get)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, "Bearer for-second", valid)
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/php:pull,push"`)
+	assert.Equal(t, "Bearer", scheme)
+	assert.Equal(t, map[string]string{
+		"realm":   "https://auth.docker.io/token",
+		"service": "registry.docker.io",
+		"scope":   "repository:library/php:pull,push",
+	}, params)
+}
@@ -0,0 +1,163 @@
+// Package oci reads image digests through the OCI distribution API (/v2/),
+// as served by every registry and pull-through cache.
+package oci
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/wutscho/registry-ping/internal/registry"
+)
+
+// manifestAccept lists the manifest media types, index types first so
+// multi-platform tags resolve to the digest of their index, the same digest
+// registries' own APIs report.
+var manifestAccept = strings.Join([]string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}, ", ")
+
+// Scraper fetches manifest digests from a registry's distribution API. The
+// API does not report push times, so ImageInfo.LastPushed is always zero and
+// changes are detected by digest.
+type Scraper struct {
+	client   *http.Client
+	baseURL  string
+	hosts    []string
+	prefix   string
+	username string
+	password string
+	logger   *slog.Logger
+	auth     *Authorizer
+}
+
+// Option is a functional option for Scraper.
+type Option func(*Scraper)
+
+// WithHosts sets the image hosts CanHandle accepts. Without hosts the
+// scraper is only used explicitly, e.g. as a mirror.
+func WithHosts(hosts ...string) Option {
+	return func(s *Scraper) {
+		s.hosts = hosts
+	}
+}
+
+// WithRepositoryPrefix prepends prefix to every repository path, for
+// caches serving an upstream under a project, e.g. "dockerhub-proxy".
+func WithRepositoryPrefix(prefix string) Option {
+	return func(s *Scraper) {
+		s.prefix = strings.Trim(prefix, "/")
+	}
+}
+
+// WithBasicAuth sets credentials for the registry's token service, or for
+// basic auth if the registry asks for it.
+func WithBasicAuth(username, password string) Option {
+	return func(s *Scraper) {
+		s.username = username
+		s.password = password
+	}
+}
+
+// WithLogger sets the logger for fetch diagnostics (default slog.Default()).
+func WithLogger(l *slog.Logger) Option {
+	return func(s *Scraper) {
+		s.logger = l
+	}
+}
+
+// NewScraper creates a Scraper for the registry at baseURL,
+// e.g. "https://mirror.example.com".
+func NewScraper(client *http.Client, baseURL string, opts ...Option) *Scraper {
+	s := &Scraper{
+		client:  client,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		logger:  slog.Default(),
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	var credentials CredentialsFunc
+	if s.username != "" {
+		credentials = func(context.Context) (string, string, error) { return s.username, s.password, nil }
+	}
+	s.auth = NewAuthorizer(client, credentials)
+	return s
+}
+
+// CanHandle reports whether host is one of the configured hosts.
+func (s *Scraper) CanHandle(host string) bool {
+	return slices.Contains(s.hosts, host)
+}
+
+// Fetch resolves the tag to its manifest digest with a HEAD request. If the
+// registry omits Docker-Content-Digest, the manifest is downloaded and
+// hashed instead.
+func (s *Scraper) Fetch(ctx context.Context, ref registry.ImageRef) (registry.ImageInfo, error) {
+	repo := ref.Repository()
+	if s.prefix != "" {
+		repo = s.prefix + "/" + repo
+	}
+	manifestURL := fmt.Sprintf("%s/v2/%s/manifests/%s", s.baseURL, repo, url.PathEscape(ref.Tag))
+
+	resp, err := s.do(ctx, http.MethodHead, manifestURL, repo)
+	if err != nil {
+		return registry.ImageInfo{}, fmt.Errorf("oci: fetch %s: %w", ref, err)
+	}
+	resp.Body.Close()
+	if err := checkStatus(resp, ref); err != nil {
+		return registry.ImageInfo{}, err
+	}
+
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		resp, err := s.do(ctx, http.MethodGet, manifestURL, repo)
+		if err != nil {
+			return registry.ImageInfo{}, fmt.Errorf("oci: fetch %s: %w", ref, err)
+		}
+		defer resp.Body.Close()
+		if err := checkStatus(resp, ref); err != nil {
+			return registry.ImageInfo{}, err
+		}
+		h := sha256.New()
+		if _, err := io.Copy(h, resp.Body); err != nil {
+			return registry.ImageInfo{}, fmt.Errorf("oci: read manifest for %s: %w", ref, err)
+		}
+		digest = "sha256:" + hex.EncodeToString(h.Sum(nil))
+	}
+
+	s.logger.Debug("oci: resolved tag", "ref", ref.String(), "registry", s.baseURL, "digest", digest)
+	return registry.ImageInfo{Ref: ref, Digest: digest}, nil
+}
+
+func checkStatus(resp *http.Response, ref registry.ImageRef) error {
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("oci: %s: %w", ref, registry.ErrNotFound)
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		return fmt.Errorf("oci: %s: %w", ref, &registry.StatusError{Code: resp.StatusCode})
+	}
+	return nil
+}
+
+// do sends a manifest request, answering a 401 challenge once.
+func (s *Scraper) do(ctx context.Context, method, manifestURL, repo string) (*http.Response, error) {
+	return s.auth.Do(ctx, "repository:"+repo+":pull", func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, method, manifestURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", manifestAccept)
+		return req, nil
+	})
+}
@@ -0,0 +1,129 @@
+package oci
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wutscho/registry-ping/internal/registry"
+)
+
+var php = registry.ImageRef{Namespace: "library", Name: "php", Tag: "8.2.30-fpm"}
+
+func TestFetch_HeadDigest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodHead, r.Method)
+		assert.Equal(t, "/v2/library/php/manifests/8.2.30-fpm", r.URL.Path)
+		assert.Contains(t, r.Header.Get("Accept"), "application/vnd.oci.image.index.v1+json")
+		w.Header().Set("Docker-Content-Digest", "sha256:abc")
+	}))
+	defer server.Close()
+
+	info, err := NewScraper(server.Client(), server.URL).Fetch(context.Background(), php)
+	require.NoError(t, err)
+	assert.Equal(t, "sha256:abc", info.Digest)
+	assert.True(t, info.LastPushed.IsZero())
+	assert.Equal(t, php, info.Ref)
+}
+
+func TestFetch_RepositoryPrefix(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v2/dockerhub-proxy/library/php/manifests/8.2.30-fpm", r.URL.Path)
+		w.Header().Set("Docker-Content-Digest", "sha256:abc")
+	}))
+	defer server.Close()
+
+	info, err := NewScraper(server.Client(), server.URL, WithRepositoryPrefix("/dockerhub-proxy/")).Fetch(context.Background(), php)
+	require.NoError(t, err)
+	assert.Equal(t, "sha256:abc", info.Digest)
+}
+
+func TestFetch_HashesManifestWithoutDigestHeader(t *testing.T) {
+	manifest := `{"schemaVersion":2}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(manifest))
+	}))
+	defer server.Close()
+
+	info, err := NewScraper(server.Client(), server.URL).Fetch(context.Background(), php)
+	require.NoError(t, err)
+	sum := sha256.Sum256([]byte(manifest))
+	assert.Equal(t, "sha256:"+hex.EncodeToString(sum[:]), info.Digest)
+}
+
+func TestFetch_BearerTokenChallenge(t *testing.T) {
+	var tokenRequests int
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			tokenRequests++
+			assert.Equal(t, "registry.example", r.URL.Query().Get("service"))
+			assert.Equal(t, "repository:library/php:pull", r.URL.Query().Get("scope"))
+			user, pass, ok := r.BasicAuth()
+			assert.True(t, ok)
+			assert.Equal(t, "robot", user)
+			assert.Equal(t, "secret", pass)
+			w.Write([]byte(`{"token":"t0k3n"}`))
+		default:
+			if r.Header.Get("Authorization") != "Bearer t0k3n" {
+				w.Header().Set("WWW-Authenticate",
+					`Bearer realm="`+server.URL+`/token",service="registry.example",scope="repository:library/php:pull"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Docker-Content-Digest", "sha256:abc")
+		}
+	}))
+	defer server.Close()
+
+	s := NewScraper(server.Client(), server.URL, WithBasicAuth("robot", "secret"))
+	for range 2 {
+		info, err := s.Fetch(context.Background(), php)
+		require.NoError(t, err)
+		assert.Equal(t, "sha256:abc", info.Digest)
+	}
+	assert.Equal(t, 1, tokenRequests, "token is reused")
+}
+
+func TestFetch_BasicChallenge(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, _, ok := r.BasicAuth(); !ok || user != "robot" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", "sha256:abc")
+	}))
+	defer server.Close()
+
+	_, err := NewScraper(server.Client(), server.URL).Fetch(context.Background(), php)
+	require.Error(t, err)
+
+	info, err := NewScraper(server.Client(), server.URL, WithBasicAuth("robot", "x")).Fetch(context.Background(), php)
+	require.NoError(t, err)
+	assert.Equal(t, "sha256:abc", info.Digest)
+}
+
+func TestFetch_NotFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	_, err := NewScraper(server.Client(), server.URL).Fetch(context.Background(), php)
+	assert.True(t, errors.Is(err, registry.ErrNotFound), "expected ErrNotFound, got: %v", err)
+}
+
+func TestCanHandle(t *testing.T) {
+	assert.False(t, NewScraper(http.DefaultClient, "https://mirror").CanHandle(""))
+	s := NewScraper(http.DefaultClient, "https://r.example", WithHosts("r.example"))
+	assert.True(t, s.CanHandle("r.example"))
+	assert.False(t, s.CanHandle("ghcr.io"))
+}
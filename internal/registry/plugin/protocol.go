@@ -0,0 +1,98 @@
+package plugin
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/wutscho/registry-ping/internal/registry"
+)
+
+// ProtocolVersion is the plugin protocol version registry-ping speaks.
+const ProtocolVersion = 1
+
+// Capabilities a plugin may declare in its handshake.
+const (
+	// CapabilityPushTime: fetch reports last_pushed.
+	CapabilityPushTime = "push_time"
+	// CapabilityDigest: fetch reports digest.
+	CapabilityDigest = "digest"
+	// CapabilityScan: fetch may report a vulnerability scan summary.
+	CapabilityScan = "scan"
+	// CapabilityTags: the tags method lists a repository's tags.
+	CapabilityTags = "tags"
+)
+
+// Error codes a plugin may answer with instead of a result.
+const (
+	CodeNotFound    = "not_found"
+	CodeRateLimited = "rate_limited"
+)
+
+// handshake is the output of the capabilities method.
+type handshake struct {
+	Protocol     int      `json:"protocol"`
+	Capabilities []string `json:"capabilities"`
+}
+
+// imageRef is the input of the fetch and tags methods.
+type imageRef struct {
+	Host       string `json:"host"`
+	Namespace  string `json:"namespace"`
+	Name       string `json:"name"`
+	Tag        string `json:"tag"`
+	Repository string `json:"repository"`
+	// Ref is the whole image ref, as used for the state key.
+	Ref string `json:"ref"`
+}
+
+func newImageRef(ref registry.ImageRef) imageRef {
+	return imageRef{
+		Host:       registry.CanonicalHost(ref.Host),
+		Namespace:  ref.Namespace,
+		Name:       ref.Name,
+		Tag:        ref.Tag,
+		Repository: ref.Repository(),
+		Ref:        ref.String(),
+	}
+}
+
+// response is the output of the fetch and tags methods. Error is set
+// instead of the result fields if the call failed.
+type response struct {
+	LastPushed time.Time    `json:"last_pushed"`
+	Digest     string       `json:"digest"`
+	Scan       *scanSummary `json:"scan"`
+	Tags       []string     `json:"tags"`
+	Error      *errorReply  `json:"error"`
+}
+
+type scanSummary struct {
+	Status     string         `json:"status"`
+	Severity   string         `json:"severity"`
+	Total      int            `json:"total"`
+	Fixable    int            `json:"fixable"`
+	BySeverity map[string]int `json:"by_severity"`
+	ScannedAt  time.Time      `json:"scanned_at"`
+}
+
+type errorReply struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// err maps the reply to the registry's error values, so not found tags and
+// rate limits are classified as with the built-in scrapers.
+func (e *errorReply) err(ref registry.ImageRef) error {
+	switch e.Code {
+	case CodeNotFound:
+		if e.Message != "" {
+			return fmt.Errorf("%s: %w", e.Message, registry.ErrNotFound)
+		}
+		return registry.ErrNotFound
+	case CodeRateLimited:
+		return &registry.RateLimitError{Host: registry.CanonicalHost(ref.Host)}
+	case "":
+		return fmt.Errorf("%s", e.Message)
+	}
+	return fmt.Errorf("%s: %s", e.Code, e.Message)
+}
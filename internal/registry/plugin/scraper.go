@@ -0,0 +1,320 @@
+// Package plugin runs external executables as scrapers, for registries and
+// artifact stores without a built-in scraper.
+//
+// A plugin is called once per method, with the method name appended to its
+// command line as the last argument:
+//
+//   - capabilities: no input. Prints {"protocol": 1, "capabilities": [...]}
+//     with any of "push_time", "digest", "scan" and "tags". It is called
+//     before the first fetch or tags call; fields of capabilities not
+//     declared are ignored in later responses.
+//   - fetch: reads the image ref as JSON from stdin, with "host",
+//     "namespace", "name", "tag", "repository" and "ref". Prints
+//     {"last_pushed": "<RFC 3339>", "digest": "sha256:...", "scan": {...}}.
+//     Without push times, changes are detected by digest.
+//   - tags: only with the "tags" capability. Reads the image ref like fetch
+//     and prints the tags of its repository as {"tags": ["1.2", ...]}.
+//
+// A plugin that fails exits with a non-zero status; the end of its stderr
+// becomes part of the error. To report a missing tag or a rate limit, it
+// prints {"error": {"code": "not_found" or "rate_limited", "message": "..."}}
+// instead. On success, stderr is logged at debug level.
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wutscho/registry-ping/internal/registry"
+)
+
+const (
+	defaultTimeout = 10 * time.Second
+	// maxStderr is how much of the end of a plugin's stderr is kept.
+	maxStderr = 4 << 10
+	// waitDelay bounds the wait for a plugin's output pipes to close after
+	// it was killed, in case it left children holding them.
+	waitDelay = time.Second
+)
+
+// PluginScraper fetches image metadata by running an external executable.
+type PluginScraper struct {
+	name    string
+	command []string
+	hosts   []string
+	env     []string
+	timeout time.Duration
+	logger  *slog.Logger
+
+	mu   sync.Mutex
+	caps map[string]bool // nil until the handshake succeeded
+	// handshake is closed when the running handshake ends; nil if none is
+	// running.
+	handshake chan struct{}
+}
+
+// Option is a functional option for PluginScraper.
+type Option func(*PluginScraper)
+
+// WithHosts sets the patterns of the image hosts CanHandle accepts, in the
+// syntax of path.Match, e.g. "*.artifacts.corp.example". Docker Hub is
+// matched as "docker.io".
+func WithHosts(patterns ...string) Option {
+	return func(s *PluginScraper) {
+		s.hosts = patterns
+	}
+}
+
+// WithEnv adds "KEY=value" entries to the plugin's environment, which is
+// otherwise inherited.
+func WithEnv(env ...string) Option {
+	return func(s *PluginScraper) {
+		s.env = env
+	}
+}
+
+// WithTimeout bounds each call of the plugin (default 10s). A plugin
+// still running then is killed.
+func WithTimeout(d time.Duration) Option {
+	return func(s *PluginScraper) {
+		if d > 0 {
+			s.timeout = d
+		}
+	}
+}
+
+// WithLogger sets the logger for call diagnostics (default slog.Default()).
+func WithLogger(l *slog.Logger) Option {
+	return func(s *PluginScraper) {
+		s.logger = l
+	}
+}
+
+// NewPluginScraper creates a PluginScraper named name, used in errors and
+// logs, that runs command: the executable, absolute or looked up in PATH,
+// and its leading arguments.
+func NewPluginScraper(name string, command []string, opts ...Option) *PluginScraper {
+	s := &PluginScraper{
+		name:    name,
+		command: command,
+		timeout: defaultTimeout,
+		logger:  slog.Default(),
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// CanHandle reports whether host matches one of the configured patterns.
+func (s *PluginScraper) CanHandle(host string) bool {
+	host = registry.CanonicalHost(host)
+	return slices.ContainsFunc(s.hosts, func(pattern string) bool {
+		ok, _ := path.Match(pattern, host)
+		return ok
+	})
+}
+
+// Fetch runs the plugin's fetch method for ref.
+func (s *PluginScraper) Fetch(ctx context.Context, ref registry.ImageRef) (registry.ImageInfo, error) {
+	caps, err := s.capabilities(ctx)
+	if err != nil {
+		return registry.ImageInfo{}, fmt.Errorf("plugin %s: %w", s.name, err)
+	}
+	resp, err := s.call(ctx, "fetch", ref)
+	if err != nil {
+		return registry.ImageInfo{}, fmt.Errorf("plugin %s: fetch %s: %w", s.name, ref, err)
+	}
+
+	info := registry.ImageInfo{Ref: ref}
+	if caps[CapabilityPushTime] {
+		info.LastPushed = resp.LastPushed
+	}
+	if caps[CapabilityDigest] {
+		info.Digest = resp.Digest
+	}
+	if caps[CapabilityScan] && resp.Scan != nil {
+		info.Scan = &registry.ScanSummary{
+			Status:     resp.Scan.Status,
+			Severity:   resp.Scan.Severity,
+			Total:      resp.Scan.Total,
+			Fixable:    resp.Scan.Fixable,
+			BySeverity: resp.Scan.BySeverity,
+			ScannedAt:  resp.Scan.ScannedAt,
+		}
+	}
+	if info.LastPushed.IsZero() && info.Digest == "" {
+		return registry.ImageInfo{}, fmt.Errorf("plugin %s: fetch %s: %w", s.name, ref,
+			&registry.DecodeError{Err: errors.New("response has neither last_pushed nor digest")})
+	}
+	return info, nil
+}
+
+// Tags runs the plugin's tags method, listing the tags of ref's repository.
+// Plugins not declaring the tags capability fail with errors.ErrUnsupported.
+func (s *PluginScraper) Tags(ctx context.Context, ref registry.ImageRef) ([]string, error) {
+	caps, err := s.capabilities(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %w", s.name, err)
+	}
+	if !caps[CapabilityTags] {
+		return nil, fmt.Errorf("plugin %s: tags: %w", s.name, errors.ErrUnsupported)
+	}
+	resp, err := s.call(ctx, "tags", ref)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: tags %s: %w", s.name, ref.Repository(), err)
+	}
+	return resp.Tags, nil
+}
+
+// capabilities returns the capabilities the plugin declared, running the
+// handshake on first use. Concurrent callers wait for a running handshake
+// rather than start their own, but the plugin runs without s.mu held. A
+// failed handshake is retried on the next call.
+func (s *PluginScraper) capabilities(ctx context.Context) (map[string]bool, error) {
+	for {
+		s.mu.Lock()
+		if s.caps != nil {
+			caps := s.caps
+			s.mu.Unlock()
+			return caps, nil
+		}
+		running := s.handshake
+		if running == nil {
+			s.handshake = make(chan struct{})
+		}
+		s.mu.Unlock()
+
+		if running == nil {
+			break
+		}
+		select {
+		case <-running:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("capabilities: %w", ctx.Err())
+		}
+	}
+
+	caps, err := s.shake(ctx)
+	s.mu.Lock()
+	s.caps = caps
+	close(s.handshake)
+	s.handshake = nil
+	s.mu.Unlock()
+	return caps, err
+}
+
+// shake runs the capabilities method and checks its answer.
+func (s *PluginScraper) shake(ctx context.Context) (map[string]bool, error) {
+	out, err := s.run(ctx, "capabilities", nil)
+	if err != nil {
+		return nil, err
+	}
+	var hs handshake
+	if err := json.Unmarshal(out, &hs); err != nil {
+		return nil, fmt.Errorf("capabilities: %w", &registry.DecodeError{Err: err})
+	}
+	if hs.Protocol != ProtocolVersion {
+		return nil, fmt.Errorf("capabilities: plugin speaks protocol %d, want %d", hs.Protocol, ProtocolVersion)
+	}
+	caps := make(map[string]bool, len(hs.Capabilities))
+	for _, c := range hs.Capabilities {
+		caps[c] = true
+	}
+	if !caps[CapabilityPushTime] && !caps[CapabilityDigest] {
+		return nil, fmt.Errorf("capabilities: plugin reports neither %s nor %s", CapabilityPushTime, CapabilityDigest)
+	}
+	s.logger.Debug("plugin: handshake", "plugin", s.name, "capabilities", hs.Capabilities)
+	return caps, nil
+}
+
+// call runs method with ref as input. An error reply is returned as error,
+// whatever the plugin's exit status.
+func (s *PluginScraper) call(ctx context.Context, method string, ref registry.ImageRef) (response, error) {
+	out, runErr := s.run(ctx, method, newImageRef(ref))
+	var resp response
+	err := json.Unmarshal(out, &resp)
+	switch {
+	case err == nil && resp.Error != nil:
+		return response{}, resp.Error.err(ref)
+	case runErr != nil:
+		return response{}, runErr
+	case err != nil:
+		return response{}, &registry.DecodeError{Err: err}
+	}
+	return resp, nil
+}
+
+// run executes the plugin's method with input, if not nil, as JSON on
+// stdin and returns its stdout. Errors include the end of stderr.
+func (s *PluginScraper) run(ctx context.Context, method string, input any) ([]byte, error) {
+	var stdin []byte
+	if input != nil {
+		var err error
+		if stdin, err = json.Marshal(input); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, s.command[0], append(slices.Clone(s.command[1:]), method)...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Env = append(os.Environ(), s.env...)
+	cmd.WaitDelay = waitDelay
+	var stdout bytes.Buffer
+	stderr := &tailBuffer{max: maxStderr}
+	cmd.Stdout = &stdout
+	cmd.Stderr = stderr
+
+	start := time.Now()
+	err := cmd.Run()
+	log := s.logger.With("plugin", s.name, "method", method, "duration", time.Since(start))
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		log.Debug("plugin: timed out", "stderr", stderr.String())
+		return nil, fmt.Errorf("%s: timed out after %s: %w", method, s.timeout, context.DeadlineExceeded)
+	case ctx.Err() != nil:
+		return nil, fmt.Errorf("%s: %w", method, ctx.Err())
+	case err != nil:
+		log.Debug("plugin: failed", "err", err, "stderr", stderr.String())
+		if msg := stderr.String(); msg != "" {
+			return stdout.Bytes(), fmt.Errorf("%s: %w: %s", method, err, msg)
+		}
+		return stdout.Bytes(), fmt.Errorf("%s: %w", method, err)
+	}
+	if msg := stderr.String(); msg != "" {
+		log.Debug("plugin: stderr", "stderr", msg)
+	}
+	return stdout.Bytes(), nil
+}
+
+// tailBuffer keeps the last max bytes written to it.
+type tailBuffer struct {
+	max int
+	buf []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	if over := len(b.buf) - b.max; over > 0 {
+		b.buf = b.buf[over:]
+	}
+	return len(p), nil
+}
+
+// String returns the kept output with surrounding whitespace trimmed.
+func (b *tailBuffer) String() string {
+	return strings.TrimSpace(string(b.buf))
+}
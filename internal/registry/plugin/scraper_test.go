@@ -0,0 +1,205 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wutscho/registry-ping/internal/registry"
+)
+
+var app = registry.ImageRef{Host: "artifacts.corp.example", Namespace: "team", Name: "app", Tag: "1.2"}
+
+// TestHelperPlugin is not a test: it is the plugin executable run by the
+// tests below, behaving as PLUGIN_MODE says.
+func TestHelperPlugin(t *testing.T) {
+	mode := os.Getenv("PLUGIN_MODE")
+	if mode == "" {
+		return
+	}
+	method := os.Args[len(os.Args)-1]
+	if calls := os.Getenv("PLUGIN_CALLS"); calls != "" {
+		f, _ := os.OpenFile(calls, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		fmt.Fprintln(f, method)
+		f.Close()
+	}
+
+	if method == "capabilities" {
+		switch mode {
+		case "slow_handshake":
+			time.Sleep(200 * time.Millisecond)
+			fmt.Print(`{"protocol":1,"capabilities":["digest"]}`)
+		case "digest":
+			fmt.Print(`{"protocol":1,"capabilities":["digest"]}`)
+		case "protocol2":
+			fmt.Print(`{"protocol":2,"capabilities":["digest"]}`)
+		default:
+			fmt.Print(`{"protocol":1,"capabilities":["push_time","digest","scan","tags"]}`)
+		}
+		os.Exit(0)
+	}
+
+	var ref imageRef
+	if err := json.NewDecoder(os.Stdin).Decode(&ref); err != nil {
+		fmt.Fprintln(os.Stderr, "bad input:", err)
+		os.Exit(2)
+	}
+	fmt.Fprintln(os.Stderr, "looking up", ref.Ref)
+	switch mode {
+	case "not_found":
+		fmt.Print(`{"error":{"code":"not_found","message":"no such tag"}}`)
+		os.Exit(1)
+	case "crash":
+		fmt.Fprintln(os.Stderr, "store unreachable")
+		os.Exit(3)
+	case "slow":
+		time.Sleep(10 * time.Second)
+	}
+	switch method {
+	case "fetch":
+		fmt.Printf(`{"last_pushed":"2026-03-01T10:00:00Z","digest":"sha256:%s","scan":{"severity":"High","total":3}}`,
+			strings.ReplaceAll(ref.Repository, "/", "-")+"-"+ref.Tag)
+	case "tags":
+		fmt.Print(`{"tags":["1.1","1.2","latest"]}`)
+	}
+	os.Exit(0)
+}
+
+func newTestPlugin(t *testing.T, mode string, opts ...Option) (*PluginScraper, string) {
+	t.Helper()
+	calls := filepath.Join(t.TempDir(), "calls")
+	opts = append([]Option{
+		WithHosts("*.corp.example"),
+		WithEnv("PLUGIN_MODE="+mode, "PLUGIN_CALLS="+calls),
+	}, opts...)
+	return NewPluginScraper("test", []string{os.Args[0], "-test.run=^TestHelperPlugin$", "--"}, opts...), calls
+}
+
+func TestFetch(t *testing.T) {
+	s, calls := newTestPlugin(t, "full")
+
+	for range 2 {
+		info, err := s.Fetch(context.Background(), app)
+		require.NoError(t, err)
+		assert.Equal(t, app, info.Ref)
+		assert.Equal(t, time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC), info.LastPushed.UTC())
+		assert.Equal(t, "sha256:team-app-1.2", info.Digest)
+		require.NotNil(t, info.Scan)
+		assert.Equal(t, "High", info.Scan.Severity)
+		assert.Equal(t, 3, info.Scan.Total)
+	}
+
+	b, err := os.ReadFile(calls)
+	require.NoError(t, err)
+	assert.Equal(t, "capabilities\nfetch\nfetch\n", string(b), "handshake runs once")
+}
+
+func TestFetch_IgnoresUndeclaredFields(t *testing.T) {
+	s, _ := newTestPlugin(t, "digest")
+
+	info, err := s.Fetch(context.Background(), app)
+	require.NoError(t, err)
+	assert.True(t, info.LastPushed.IsZero(), "push_time not declared")
+	assert.Nil(t, info.Scan)
+	assert.Equal(t, "sha256:team-app-1.2", info.Digest)
+}
+
+func TestFetch_ErrorReply(t *testing.T) {
+	s, _ := newTestPlugin(t, "not_found")
+
+	_, err := s.Fetch(context.Background(), app)
+	assert.True(t, errors.Is(err, registry.ErrNotFound), "expected ErrNotFound, got: %v", err)
+	assert.Contains(t, err.Error(), "no such tag")
+}
+
+func TestFetch_Failure(t *testing.T) {
+	s, _ := newTestPlugin(t, "crash")
+
+	_, err := s.Fetch(context.Background(), app)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exit status 3")
+	assert.Contains(t, err.Error(), "store unreachable")
+	assert.Equal(t, "other", registry.ErrorClass(err))
+}
+
+func TestFetch_Timeout(t *testing.T) {
+	s, _ := newTestPlugin(t, "slow", WithTimeout(200*time.Millisecond))
+
+	start := time.Now()
+	_, err := s.Fetch(context.Background(), app)
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Equal(t, "timeout", registry.ErrorClass(err))
+}
+
+func TestFetch_ProtocolMismatch(t *testing.T) {
+	s, _ := newTestPlugin(t, "protocol2")
+
+	_, err := s.Fetch(context.Background(), app)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "protocol 2, want 1")
+}
+
+func TestFetch_ConcurrentHandshake(t *testing.T) {
+	s, calls := newTestPlugin(t, "slow_handshake")
+
+	// A caller giving up does not wait for the handshake of another.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := s.Fetch(context.Background(), app)
+		assert.NoError(t, err)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := s.Fetch(ctx, app)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Go(func() {
+			_, err := s.Fetch(context.Background(), app)
+			assert.NoError(t, err)
+		})
+	}
+	wg.Wait()
+	<-done
+
+	b, err := os.ReadFile(calls)
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(b), "capabilities"), "handshake runs once")
+	assert.Equal(t, 5, strings.Count(string(b), "fetch"))
+}
+
+func TestTags(t *testing.T) {
+	s, _ := newTestPlugin(t, "full")
+
+	tags, err := s.Tags(context.Background(), app)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1.1", "1.2", "latest"}, tags)
+
+	s, calls := newTestPlugin(t, "digest")
+	_, err = s.Tags(context.Background(), app)
+	assert.ErrorIs(t, err, errors.ErrUnsupported)
+	b, err := os.ReadFile(calls)
+	require.NoError(t, err)
+	assert.Equal(t, "capabilities\n", string(b), "tags is not called undeclared")
+}
+
+func TestCanHandle(t *testing.T) {
+	s := NewPluginScraper("test", []string{"true"}, WithHosts("*.corp.example", "docker.io"))
+	assert.True(t, s.CanHandle("artifacts.corp.example"))
+	assert.True(t, s.CanHandle(""))
+	assert.False(t, s.CanHandle("corp.example"))
+	assert.False(t, s.CanHandle("ghcr.io"))
+}
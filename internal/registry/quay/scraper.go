@@ -0,0 +1,159 @@
+// Package quay reads tag metadata from the Quay API, as served by quay.io
+// and self-hosted Red Hat Quay.
+package quay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/wutscho/registry-ping/internal/registry"
+)
+
+const defaultBaseURL = "https://quay.io"
+
+// QuayScraper fetches image metadata from the Quay tag API
+// (/api/v1/repository/<ns>/<repo>/tag/).
+type QuayScraper struct {
+	client   *http.Client
+	baseURL  string
+	hosts    []string
+	token    string
+	username string
+	password string
+	logger   *slog.Logger
+}
+
+// Option is a functional option for QuayScraper.
+type Option func(*QuayScraper)
+
+// WithBaseURL overrides the Quay base URL, for self-hosted Red Hat Quay or
+// testing with httptest.
+func WithBaseURL(url string) Option {
+	return func(s *QuayScraper) {
+		s.baseURL = url
+	}
+}
+
+// WithHosts sets the image hosts CanHandle accepts (default "quay.io").
+func WithHosts(hosts ...string) Option {
+	return func(s *QuayScraper) {
+		s.hosts = hosts
+	}
+}
+
+// WithToken authenticates with an OAuth application token, needed for
+// private repositories.
+func WithToken(token string) Option {
+	return func(s *QuayScraper) {
+		s.token = token
+	}
+}
+
+// WithRobotAccount authenticates as a robot account, e.g. "org+ping", with
+// its token.
+func WithRobotAccount(name, token string) Option {
+	return func(s *QuayScraper) {
+		s.username = name
+		s.password = token
+	}
+}
+
+// WithLogger sets the logger for fetch diagnostics (default slog.Default()).
+func WithLogger(l *slog.Logger) Option {
+	return func(s *QuayScraper) {
+		s.logger = l
+	}
+}
+
+// NewQuayScraper creates a new QuayScraper using the given HTTP client.
+func NewQuayScraper(client *http.Client, opts ...Option) *QuayScraper {
+	s := &QuayScraper{
+		client:  client,
+		baseURL: defaultBaseURL,
+		hosts:   []string{"quay.io"},
+		logger:  slog.Default(),
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// CanHandle reports whether this scraper handles the given host.
+func (s *QuayScraper) CanHandle(host string) bool {
+	return slices.Contains(s.hosts, host)
+}
+
+// tagResponse is a page of a tag's history, newest first. Entries with an
+// end_ts are no longer active: the tag was moved or deleted.
+type tagResponse struct {
+	Tags []struct {
+		Name           string `json:"name"`
+		StartTS        int64  `json:"start_ts"`
+		EndTS          *int64 `json:"end_ts"`
+		ManifestDigest string `json:"manifest_digest"`
+	} `json:"tags"`
+}
+
+// Fetch retrieves the history of the tag and returns the start time and
+// manifest digest of its active entry.
+func (s *QuayScraper) Fetch(ctx context.Context, ref registry.ImageRef) (registry.ImageInfo, error) {
+	u := fmt.Sprintf("%s/api/v1/repository/%s/tag/?specificTag=%s",
+		s.baseURL, ref.Repository(), url.QueryEscape(ref.Tag))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return registry.ImageInfo{}, fmt.Errorf("quay: create request: %w", err)
+	}
+	switch {
+	case s.token != "":
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	case s.username != "":
+		req.SetBasicAuth(s.username, s.password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return registry.ImageInfo{}, fmt.Errorf("quay: fetch %s: %w", ref, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return registry.ImageInfo{}, fmt.Errorf("quay: %s: %w", ref, registry.ErrNotFound)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return registry.ImageInfo{}, fmt.Errorf("quay: %s: %w", ref, &registry.StatusError{Code: resp.StatusCode})
+	}
+
+	var data tagResponse
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return registry.ImageInfo{}, fmt.Errorf("quay: decode response for %s: %w", ref, &registry.DecodeError{Err: err})
+	}
+
+	var info registry.ImageInfo
+	found := false
+	for _, t := range data.Tags {
+		if t.Name != ref.Tag || t.EndTS != nil {
+			continue
+		}
+		pushed := time.Unix(t.StartTS, 0).UTC()
+		if !found || pushed.After(info.LastPushed) {
+			info = registry.ImageInfo{Ref: ref, LastPushed: pushed, Digest: t.ManifestDigest}
+			found = true
+		}
+	}
+	if !found {
+		// Only expired entries: the tag existed but has been deleted.
+		return registry.ImageInfo{}, fmt.Errorf("quay: %s: %w", ref, registry.ErrNotFound)
+	}
+
+	s.logger.Debug("quay: fetched tag", "ref", ref.String(),
+		"pushed", info.LastPushed, "digest", info.Digest, "history", len(data.Tags))
+	return info, nil
+}
@@ -0,0 +1,111 @@
+package quay
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wutscho/registry-ping/internal/registry"
+)
+
+var prometheus = registry.ImageRef{Host: "quay.io", Namespace: "prometheus", Name: "node-exporter", Tag: "v1.8.2"}
+
+func newTestScraper(server *httptest.Server, opts ...Option) *QuayScraper {
+	return NewQuayScraper(server.Client(), append([]Option{WithBaseURL(server.URL)}, opts...)...)
+}
+
+func TestFetch_ActiveTag(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/repository/prometheus/node-exporter/tag/", r.URL.Path)
+		assert.Equal(t, "v1.8.2", r.URL.Query().Get("specificTag"))
+		assert.Empty(t, r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"tags":[
+			{"name":"v1.8.2","start_ts":1721900000,"manifest_digest":"sha256:new","is_manifest_list":true},
+			{"name":"v1.8.2","start_ts":1721800000,"end_ts":1721900000,"manifest_digest":"sha256:old"}
+		],"page":1,"has_additional":false}`))
+	}))
+	defer server.Close()
+
+	info, err := newTestScraper(server).Fetch(context.Background(), prometheus)
+	require.NoError(t, err)
+	assert.Equal(t, prometheus, info.Ref)
+	assert.Equal(t, time.Unix(1721900000, 0).UTC(), info.LastPushed)
+	assert.Equal(t, "sha256:new", info.Digest)
+}
+
+func TestFetch_DeletedTag(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"tags":[{"name":"v1.8.2","start_ts":1721800000,"end_ts":1721900000,"manifest_digest":"sha256:old"}]}`))
+	}))
+	defer server.Close()
+
+	_, err := newTestScraper(server).Fetch(context.Background(), prometheus)
+	assert.True(t, errors.Is(err, registry.ErrNotFound))
+}
+
+func TestFetch_NotFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	_, err := newTestScraper(server).Fetch(context.Background(), prometheus)
+	assert.True(t, errors.Is(err, registry.ErrNotFound))
+}
+
+func TestFetch_Unauthorized(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	_, err := newTestScraper(server).Fetch(context.Background(), prometheus)
+	var statusErr *registry.StatusError
+	require.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusUnauthorized, statusErr.Code)
+}
+
+func TestFetch_Credentials(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  Option
+		want func(t *testing.T, r *http.Request)
+	}{
+		{"token", WithToken("oauth-token"), func(t *testing.T, r *http.Request) {
+			assert.Equal(t, "Bearer oauth-token", r.Header.Get("Authorization"))
+		}},
+		{"robot", WithRobotAccount("prometheus+ping", "robot-token"), func(t *testing.T, r *http.Request) {
+			user, pass, ok := r.BasicAuth()
+			assert.True(t, ok)
+			assert.Equal(t, "prometheus+ping", user)
+			assert.Equal(t, "robot-token", pass)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tt.want(t, r)
+				_, _ = w.Write([]byte(`{"tags":[{"name":"v1.8.2","start_ts":1721900000}]}`))
+			}))
+			defer server.Close()
+
+			_, err := newTestScraper(server, tt.opt).Fetch(context.Background(), prometheus)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestCanHandle(t *testing.T) {
+	assert.True(t, NewQuayScraper(nil).CanHandle("quay.io"))
+	assert.False(t, NewQuayScraper(nil).CanHandle("docker.io"))
+
+	s := NewQuayScraper(nil, WithHosts("quay.corp.example"))
+	assert.True(t, s.CanHandle("quay.corp.example"))
+	assert.False(t, s.CanHandle("quay.io"))
+}
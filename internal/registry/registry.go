@@ -1,23 +1,122 @@
 package registry
 
-import "fmt"
+import (
+	"context"
+	"errors"
+	"fmt"
+)
 
 // ScraperRegistry holds a list of scrapers and selects the right one for a given image.
 type ScraperRegistry struct {
 	scrapers []Scraper
+	mirrors  map[string]mirrorSet
+}
+
+// MirrorMode decides when the mirrors of a registry are asked.
+type MirrorMode int
+
+const (
+	// MirrorFallback asks the mirrors only if the registry itself fails,
+	// e.g. because it is rate limiting.
+	MirrorFallback MirrorMode = iota
+	// MirrorFirst asks the mirrors first and the registry only if all of
+	// them fail.
+	MirrorFirst
+)
+
+// Source is a named scraper in a Chain.
+type Source struct {
+	// Name identifies the source in ImageInfo.Source, e.g. the mirror host.
+	Name    string
+	Scraper Scraper
+}
+
+type mirrorSet struct {
+	mode    MirrorMode
+	sources []Source
 }
 
 // NewScraperRegistry creates a ScraperRegistry with the given scrapers.
 func NewScraperRegistry(scrapers ...Scraper) *ScraperRegistry {
-	return &ScraperRegistry{scrapers: scrapers}
+	return &ScraperRegistry{scrapers: scrapers, mirrors: make(map[string]mirrorSet)}
+}
+
+// SetMirrors declares mirrors, such as pull-through caches, for the registry
+// host (as in image refs; "docker.io" for Docker Hub). They are tried in the
+// given order.
+func (r *ScraperRegistry) SetMirrors(host string, mode MirrorMode, mirrors ...Source) {
+	r.mirrors[CanonicalHost(host)] = mirrorSet{mode: mode, sources: mirrors}
 }
 
 // For returns the first scraper that can handle the image's registry host.
+// If the host has mirrors, it returns a *Chain of the scraper and its
+// mirrors instead.
 func (r *ScraperRegistry) For(ref ImageRef) (Scraper, error) {
+	var upstream Scraper
 	for _, s := range r.scrapers {
 		if s.CanHandle(ref.Host) {
-			return s, nil
+			upstream = s
+			break
 		}
 	}
-	return nil, fmt.Errorf("no scraper registered for host %q", ref.Host)
+
+	host := CanonicalHost(ref.Host)
+	ms, ok := r.mirrors[host]
+	switch {
+	case !ok && upstream == nil:
+		return nil, fmt.Errorf("no scraper registered for host %q", ref.Host)
+	case !ok:
+		return upstream, nil
+	case upstream == nil:
+		return &Chain{sources: ms.sources, upstream: -1}, nil
+	}
+
+	c := &Chain{}
+	if ms.mode == MirrorFirst {
+		c.sources = append(append(c.sources, ms.sources...), Source{Name: host, Scraper: upstream})
+		c.upstream = len(ms.sources)
+	} else {
+		c.sources = append([]Source{{Name: host, Scraper: upstream}}, ms.sources...)
+	}
+	return c, nil
+}
+
+// Chain is a Scraper that asks its sources in order until one answers,
+// recording the answering source in ImageInfo.Source. The image ref, and so
+// the state key, stays the canonical one whichever source answered.
+//
+// A failure moves on to the next source, except when the registry itself
+// reports the tag as not found: a mirror cannot know better.
+type Chain struct {
+	sources  []Source
+	upstream int // index of the registry itself in sources, -1 if none
+}
+
+// Sources returns the sources in the order they are asked.
+func (c *Chain) Sources() []Source {
+	return c.sources
+}
+
+// Fetch asks each source in turn. If all fail, their errors are joined.
+func (c *Chain) Fetch(ctx context.Context, ref ImageRef) (ImageInfo, error) {
+	var errs []error
+	for i, src := range c.sources {
+		info, err := src.Scraper.Fetch(ctx, ref)
+		if err == nil {
+			info.Ref = ref
+			info.Source = src.Name
+			return info, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", src.Name, err))
+		if (i == c.upstream && errors.Is(err, ErrNotFound)) || ctx.Err() != nil {
+			break
+		}
+	}
+	return ImageInfo{}, errors.Join(errs...)
+}
+
+// CanHandle always reports true; a Chain is only returned for hosts it
+// was built for.
+func (c *Chain) CanHandle(string) bool {
+	return true
 }
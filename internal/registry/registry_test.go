@@ -0,0 +1,134 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeScraper struct {
+	hosts []string
+	info  ImageInfo
+	err   error
+	calls int
+}
+
+func (f *fakeScraper) Fetch(_ context.Context, ref ImageRef) (ImageInfo, error) {
+	f.calls++
+	if f.err != nil {
+		return ImageInfo{}, f.err
+	}
+	info := f.info
+	info.Ref = ImageRef{Host: "mirror.example", Name: "rewritten", Tag: ref.Tag}
+	return info, nil
+}
+
+func (f *fakeScraper) CanHandle(host string) bool {
+	for _, h := range f.hosts {
+		if h == host {
+			return true
+		}
+	}
+	return false
+}
+
+var phpRef = ImageRef{Namespace: "library", Name: "php", Tag: "8"}
+
+func TestScraperRegistry_ForWithoutMirrors(t *testing.T) {
+	hub := &fakeScraper{hosts: []string{""}}
+	r := NewScraperRegistry(hub)
+
+	s, err := r.For(phpRef)
+	require.NoError(t, err)
+	assert.Same(t, hub, s)
+
+	_, err = r.For(ImageRef{Host: "ghcr.io", Name: "x", Tag: "1"})
+	require.Error(t, err)
+}
+
+func TestScraperRegistry_MirrorFallback(t *testing.T) {
+	hub := &fakeScraper{hosts: []string{""}, err: fmt.Errorf("dockerhub: %w", &RateLimitError{Host: "hub.docker.com"})}
+	mirror := &fakeScraper{info: ImageInfo{Digest: "sha256:abc"}}
+	r := NewScraperRegistry(hub)
+	r.SetMirrors("docker.io", MirrorFallback, Source{Name: "mirror.example", Scraper: mirror})
+
+	s, err := r.For(phpRef)
+	require.NoError(t, err)
+	info, err := s.Fetch(context.Background(), phpRef)
+	require.NoError(t, err)
+	assert.Equal(t, ImageInfo{Ref: phpRef, Digest: "sha256:abc", Source: "mirror.example"}, info)
+	assert.Equal(t, 1, hub.calls)
+
+	hub.err = nil
+	hub.info = ImageInfo{LastPushed: time.Unix(1, 0), Digest: "sha256:abc"}
+	info, err = s.Fetch(context.Background(), phpRef)
+	require.NoError(t, err)
+	assert.Equal(t, "docker.io", info.Source)
+	assert.Equal(t, 1, mirror.calls, "mirror is only asked when the registry fails")
+}
+
+func TestScraperRegistry_MirrorFirst(t *testing.T) {
+	hub := &fakeScraper{hosts: []string{""}, info: ImageInfo{Digest: "sha256:abc"}}
+	broken := &fakeScraper{err: errors.New("connection refused")}
+	mirror := &fakeScraper{info: ImageInfo{Digest: "sha256:abc"}}
+	r := NewScraperRegistry(hub)
+	r.SetMirrors("", MirrorFirst,
+		Source{Name: "broken.example", Scraper: broken},
+		Source{Name: "mirror.example", Scraper: mirror})
+
+	s, err := r.For(phpRef)
+	require.NoError(t, err)
+	info, err := s.Fetch(context.Background(), phpRef)
+	require.NoError(t, err)
+	assert.Equal(t, "mirror.example", info.Source)
+	assert.Equal(t, 0, hub.calls)
+
+	chain := s.(*Chain)
+	require.Len(t, chain.Sources(), 3)
+	assert.Equal(t, "docker.io", chain.Sources()[2].Name)
+}
+
+func TestChain_NotFoundFromRegistryIsFinal(t *testing.T) {
+	hub := &fakeScraper{hosts: []string{""}, err: fmt.Errorf("dockerhub: %w", ErrNotFound)}
+	mirror := &fakeScraper{info: ImageInfo{Digest: "sha256:abc"}}
+	r := NewScraperRegistry(hub)
+	r.SetMirrors("docker.io", MirrorFallback, Source{Name: "mirror.example", Scraper: mirror})
+
+	s, err := r.For(phpRef)
+	require.NoError(t, err)
+	_, err = s.Fetch(context.Background(), phpRef)
+	require.ErrorIs(t, err, ErrNotFound)
+	assert.Equal(t, 0, mirror.calls)
+}
+
+func TestChain_AllFail(t *testing.T) {
+	hub := &fakeScraper{hosts: []string{""}, err: &RateLimitError{Host: "hub.docker.com"}}
+	mirror := &fakeScraper{err: &StatusError{Code: 502}}
+	r := NewScraperRegistry(hub)
+	r.SetMirrors("docker.io", MirrorFallback, Source{Name: "mirror.example", Scraper: mirror})
+
+	s, err := r.For(phpRef)
+	require.NoError(t, err)
+	_, err = s.Fetch(context.Background(), phpRef)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrRateLimited)
+	assert.Contains(t, err.Error(), "docker.io: ")
+	assert.Contains(t, err.Error(), "mirror.example: unexpected status 502")
+}
+
+func TestScraperRegistry_MirrorsOnlyHost(t *testing.T) {
+	mirror := &fakeScraper{info: ImageInfo{Digest: "sha256:abc"}}
+	r := NewScraperRegistry()
+	r.SetMirrors("quay.io", MirrorFallback, Source{Name: "mirror.example", Scraper: mirror})
+
+	s, err := r.For(ImageRef{Host: "quay.io", Namespace: "org", Name: "img", Tag: "1"})
+	require.NoError(t, err)
+	info, err := s.Fetch(context.Background(), ImageRef{Host: "quay.io", Namespace: "org", Name: "img", Tag: "1"})
+	require.NoError(t, err)
+	assert.Equal(t, "mirror.example", info.Source)
+}
@@ -0,0 +1,355 @@
+package registry
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxAttempts = 4
+	defaultBaseDelay   = 500 * time.Millisecond
+	defaultMaxDelay    = 30 * time.Second
+	// defaultBlockedFor is assumed when a registry reports an exhausted
+	// budget without saying when it resets.
+	defaultBlockedFor = time.Minute
+)
+
+// Transport is the http.RoundTripper shared by all scrapers. It retries
+// idempotent requests (see Idempotent) on network errors, 429 and 5xx responses with
+// jittered exponential backoff, honouring Retry-After. It also tracks the
+// rate-limit budget each host reports in RateLimit-* (or X-RateLimit-*)
+// headers and fails fast with a *RateLimitError while it is exhausted,
+// rather than spending requests that would be refused.
+type Transport struct {
+	next        http.RoundTripper
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	logger      *slog.Logger
+	now         func() time.Time
+	// sleep waits for d or until ctx is done.
+	sleep func(ctx context.Context, d time.Duration) error
+	// jitter returns a random duration in [0, d).
+	jitter func(d time.Duration) time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]*budget
+}
+
+// budget is the rate-limit state last reported by a host.
+type budget struct {
+	remaining int
+	reset     time.Time // when an exhausted budget is refilled
+}
+
+// TransportOption is a functional option for Transport.
+type TransportOption func(*Transport)
+
+// WithMaxAttempts sets how often a request is tried in total (default 4).
+func WithMaxAttempts(n int) TransportOption {
+	return func(t *Transport) {
+		t.maxAttempts = max(n, 1)
+	}
+}
+
+// WithBackoff sets the base and maximum delay between attempts
+// (default 500ms and 30s). A Retry-After longer than max is not waited for.
+func WithBackoff(base, max time.Duration) TransportOption {
+	return func(t *Transport) {
+		t.baseDelay = base
+		t.maxDelay = max
+	}
+}
+
+// WithTransportLogger sets the logger for retries (default slog.Default()).
+func WithTransportLogger(l *slog.Logger) TransportOption {
+	return func(t *Transport) {
+		t.logger = l
+	}
+}
+
+// NewTransport creates a Transport sending requests through next, or
+// http.DefaultTransport if nil.
+func NewTransport(next http.RoundTripper, opts ...TransportOption) *Transport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	t := &Transport{
+		next:        next,
+		maxAttempts: defaultMaxAttempts,
+		baseDelay:   defaultBaseDelay,
+		maxDelay:    defaultMaxDelay,
+		logger:      slog.Default(),
+		now:         time.Now,
+		sleep:       sleepContext,
+		jitter: func(d time.Duration) time.Duration {
+			if d <= 0 {
+				return 0
+			}
+			return rand.N(d)
+		},
+		hosts: make(map[string]*budget),
+	}
+	for _, o := range opts {
+		o(t)
+	}
+	return t
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	host := req.URL.Host
+
+	if reset, ok := t.exhausted(host); ok && !t.canWait(ctx, reset.Sub(t.now())) {
+		return nil, &RateLimitError{Host: host, Reset: reset}
+	} else if ok {
+		if err := t.sleep(ctx, reset.Sub(t.now())); err != nil {
+			return nil, err
+		}
+	}
+
+	retryable := isIdempotent(req) && (req.Body == nil || req.Body == http.NoBody || req.GetBody != nil)
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+
+		resp, err := t.next.RoundTrip(req)
+		if err == nil {
+			t.record(host, resp)
+		}
+		if !retryable || attempt >= t.maxAttempts || !shouldRetry(ctx, resp, err) {
+			if err == nil && resp.StatusCode == http.StatusTooManyRequests {
+				reset, _ := t.exhausted(host)
+				drain(resp)
+				return nil, &RateLimitError{Host: host, Reset: reset}
+			}
+			return resp, err
+		}
+
+		delay := t.backoff(attempt)
+		reason := "error"
+		if err == nil {
+			reason = strconv.Itoa(resp.StatusCode)
+			if at, ok := retryAfter(resp.Header, t.now()); ok {
+				delay = max(at.Sub(t.now()), 0)
+			}
+		}
+		if !t.canWait(ctx, delay) {
+			if err == nil && resp.StatusCode == http.StatusTooManyRequests {
+				drain(resp)
+				return nil, &RateLimitError{Host: host, Reset: t.now().Add(delay)}
+			}
+			return resp, err
+		}
+		if err == nil {
+			drain(resp)
+		}
+
+		t.logger.Debug("retrying request", "method", req.Method, "host", host,
+			"attempt", attempt, "reason", reason, "delay", delay, "err", err)
+		if err := t.sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// backoff returns the jittered delay after the given failed attempt: a
+// random duration up to base·2^(attempt-1), capped at the maximum delay.
+func (t *Transport) backoff(attempt int) time.Duration {
+	d := t.baseDelay
+	for i := 1; i < attempt && d < t.maxDelay; i++ {
+		d *= 2
+	}
+	return t.jitter(min(d, t.maxDelay))
+}
+
+// canWait reports whether waiting d stays within the maximum delay and the
+// request's deadline.
+func (t *Transport) canWait(ctx context.Context, d time.Duration) bool {
+	if d > t.maxDelay {
+		return false
+	}
+	if deadline, ok := ctx.Deadline(); ok && t.now().Add(d).After(deadline) {
+		return false
+	}
+	return true
+}
+
+// exhausted reports whether host has no budget left, and until when.
+func (t *Transport) exhausted(host string) (time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b, ok := t.hosts[host]
+	if !ok || b.remaining != 0 {
+		return time.Time{}, false
+	}
+	if !t.now().Before(b.reset) {
+		delete(t.hosts, host)
+		return time.Time{}, false
+	}
+	return b.reset, true
+}
+
+// record updates the budget of host from the rate-limit headers of resp.
+func (t *Transport) record(host string, resp *http.Response) {
+	remaining, window, ok := parseRateLimit(resp.Header, "Remaining")
+	if !ok && resp.StatusCode != http.StatusTooManyRequests {
+		// An accepted request without headers ends an earlier 429 block.
+		if resp.StatusCode < 500 {
+			t.mu.Lock()
+			delete(t.hosts, host)
+			t.mu.Unlock()
+		}
+		return
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		remaining = 0
+	}
+
+	now := t.now()
+	b := &budget{remaining: remaining}
+	if remaining == 0 {
+		switch {
+		case headerTime(resp.Header, now, &b.reset):
+		case window > 0:
+			b.reset = now.Add(window)
+		default:
+			b.reset = now.Add(defaultBlockedFor)
+		}
+	}
+
+	t.mu.Lock()
+	t.hosts[host] = b
+	t.mu.Unlock()
+	if remaining == 0 {
+		t.logger.Debug("rate limit exhausted", "host", host, "reset", b.reset)
+	}
+}
+
+// headerTime sets reset from Retry-After or a RateLimit-Reset header and
+// reports whether one was present.
+func headerTime(h http.Header, now time.Time, reset *time.Time) bool {
+	if at, ok := retryAfter(h, now); ok {
+		*reset = at
+		return true
+	}
+	for _, name := range []string{"RateLimit-Reset", "X-RateLimit-Reset"} {
+		v, err := strconv.ParseInt(strings.TrimSpace(h.Get(name)), 10, 64)
+		if err != nil {
+			continue
+		}
+		// Values beyond a year of seconds are Unix timestamps (GitHub
+		// style), smaller ones are delta seconds (IETF draft style).
+		if v > 365*24*3600 {
+			*reset = time.Unix(v, 0)
+		} else {
+			*reset = now.Add(time.Duration(v) * time.Second)
+		}
+		return true
+	}
+	return false
+}
+
+// parseRateLimit parses RateLimit-<field> or X-RateLimit-<field>, accepting
+// Docker Hub's "76;w=21600" form and returning its window.
+func parseRateLimit(h http.Header, field string) (int, time.Duration, bool) {
+	v := h.Get("RateLimit-" + field)
+	if v == "" {
+		v = h.Get("X-RateLimit-" + field)
+	}
+	if v == "" {
+		return 0, 0, false
+	}
+	value, params, _ := strings.Cut(v, ";")
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return 0, 0, false
+	}
+	var window time.Duration
+	for _, p := range strings.Split(params, ";") {
+		if w, ok := strings.CutPrefix(strings.TrimSpace(p), "w="); ok {
+			if secs, err := strconv.Atoi(w); err == nil {
+				window = time.Duration(secs) * time.Second
+			}
+		}
+	}
+	return n, window, true
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date.
+func retryAfter(h http.Header, now time.Time) (time.Time, bool) {
+	v := strings.TrimSpace(h.Get("Retry-After"))
+	if v == "" {
+		return time.Time{}, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return now.Add(time.Duration(max(secs, 0)) * time.Second), true
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		return at, true
+	}
+	return time.Time{}, false
+}
+
+type idempotentKey struct{}
+
+// Idempotent returns a context marking the requests made with it as safe to
+// retry although their method is not idempotent, such as API calls that are
+// POSTs but only read or issue tokens.
+func Idempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, true)
+}
+
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	marked, _ := req.Context().Value(idempotentKey{}).(bool)
+	return marked
+}
+
+// shouldRetry reports whether a response or transport error is transient.
+func shouldRetry(ctx context.Context, resp *http.Response, err error) bool {
+	if err != nil {
+		return ctx.Err() == nil
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// drain discards the rest of a response that will not be returned, so its
+// connection can be reused.
+func drain(resp *http.Response) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+}
@@ -0,0 +1,212 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestTransport returns a Transport that records its sleeps instead of
+// waiting and uses the maximum backoff instead of a random one.
+func newTestTransport(next http.RoundTripper, opts ...TransportOption) (*Transport, *[]time.Duration) {
+	var slept []time.Duration
+	t := NewTransport(next, opts...)
+	t.sleep = func(_ context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return nil
+	}
+	t.jitter = func(d time.Duration) time.Duration { return d }
+	return t, &slept
+}
+
+func TestTransport_RetriesTransientStatus(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	tr, slept := newTestTransport(server.Client().Transport)
+	resp, err := (&http.Client{Transport: tr}).Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(3), calls.Load())
+	assert.Equal(t, []time.Duration{500 * time.Millisecond, time.Second}, *slept)
+}
+
+func TestTransport_GivesUpAfterMaxAttempts(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	tr, _ := newTestTransport(server.Client().Transport, WithMaxAttempts(2))
+	resp, err := (&http.Client{Transport: tr}).Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestTransport_DoesNotRetryPost(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	tr, _ := newTestTransport(server.Client().Transport)
+	resp, err := (&http.Client{Transport: tr}).Post(server.URL, "text/plain", strings.NewReader("x"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestTransport_RetriesPostMarkedIdempotent(t *testing.T) {
+	var calls atomic.Int32
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if calls.Add(1) < 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	tr, _ := newTestTransport(server.Client().Transport)
+	req, err := http.NewRequestWithContext(Idempotent(context.Background()), http.MethodPost, server.URL, strings.NewReader("x"))
+	require.NoError(t, err)
+	resp, err := (&http.Client{Transport: tr}).Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"x", "x"}, bodies, "the body is sent again on retry")
+}
+
+func TestTransport_HonoursRetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+	}))
+	defer server.Close()
+
+	tr, slept := newTestTransport(server.Client().Transport)
+	resp, err := (&http.Client{Transport: tr}).Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, *slept, 1)
+	assert.InDelta(t, 7*time.Second, (*slept)[0], float64(time.Second))
+}
+
+func TestTransport_RetryAfterBeyondMaxDelayIsRateLimited(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	tr, slept := newTestTransport(server.Client().Transport)
+	client := &http.Client{Transport: tr}
+	_, err := client.Get(server.URL)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrRateLimited))
+	assert.Equal(t, "rate_limited", ErrorClass(err))
+	var rlErr *RateLimitError
+	require.ErrorAs(t, err, &rlErr)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), rlErr.Reset, 5*time.Second)
+	assert.Empty(t, *slept)
+
+	// The host stays blocked without further requests.
+	_, err = client.Get(server.URL)
+	require.ErrorIs(t, err, ErrRateLimited)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestTransport_ExhaustedBudgetFailsFast(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("RateLimit-Limit", "100;w=21600")
+		w.Header().Set("RateLimit-Remaining", "0;w=21600")
+	}))
+	defer server.Close()
+
+	tr, _ := newTestTransport(server.Client().Transport)
+	client := &http.Client{Transport: tr}
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err, "the request that used up the budget succeeds")
+	resp.Body.Close()
+
+	_, err = client.Get(server.URL)
+	var rlErr *RateLimitError
+	require.ErrorAs(t, err, &rlErr)
+	assert.Equal(t, strings.TrimPrefix(server.URL, "http://"), rlErr.Host)
+	assert.WithinDuration(t, time.Now().Add(6*time.Hour), rlErr.Reset, 5*time.Second)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestTransport_WaitsForShortReset(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", "2")
+			return
+		}
+		w.Header().Set("X-RateLimit-Remaining", "59")
+	}))
+	defer server.Close()
+
+	tr, slept := newTestTransport(server.Client().Transport)
+	client := &http.Client{Transport: tr}
+	for range 2 {
+		resp, err := client.Get(server.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	assert.Equal(t, int32(2), calls.Load())
+	require.Len(t, *slept, 1)
+	assert.InDelta(t, 2*time.Second, (*slept)[0], float64(time.Second))
+}
+
+func TestParseRateLimit(t *testing.T) {
+	h := http.Header{"Ratelimit-Remaining": {"76;w=21600"}}
+	n, window, ok := parseRateLimit(h, "Remaining")
+	require.True(t, ok)
+	assert.Equal(t, 76, n)
+	assert.Equal(t, 6*time.Hour, window)
+
+	_, _, ok = parseRateLimit(http.Header{}, "Remaining")
+	assert.False(t, ok)
+}
@@ -9,13 +9,15 @@ import (
 // ImageRef identifies a specific tagged image in a container registry.
 type ImageRef struct {
 	Host      string // "" = Docker Hub
-	Namespace string // "library" for official Docker Hub images
+	Namespace string // "library" for official Docker Hub images; may contain "/"
 	Name      string
 	Tag       string
 }
 
 // ParseImageRef parses a string like "php:8.2.30-fpm", "myorg/img:1.0", or
-// "ghcr.io/org/img:latest" into an ImageRef. A tag is required.
+// "ghcr.io/org/img:latest" into an ImageRef. A tag is required. Outside
+// Docker Hub, nested paths like "gitlab.example.com/group/sub/img:1" keep
+// all but the last segment in Namespace.
 func ParseImageRef(s string) (ImageRef, error) {
 	// Split off tag at last ':'
 	lastColon := strings.LastIndex(s, ":")
@@ -49,7 +51,13 @@ func ParseImageRef(s string) (ImageRef, error) {
 		namespace = segments[0]
 		name = segments[1]
 	default:
-		return ImageRef{}, fmt.Errorf("image ref %q: unsupported path format", s)
+		// Docker Hub has exactly one namespace level; other registries
+		// allow nested groups, kept together in Namespace.
+		if host == "" {
+			return ImageRef{}, fmt.Errorf("image ref %q: unsupported path format", s)
+		}
+		namespace = strings.Join(segments[:len(segments)-1], "/")
+		name = segments[len(segments)-1]
 	}
 
 	if name == "" {
@@ -65,14 +73,16 @@ func ParseImageRef(s string) (ImageRef, error) {
 }
 
 // String returns a human-readable image reference. "library/" is omitted for
-// Docker Hub official images. Used as the state file key.
+// Docker Hub official images, whatever alias names the host; on other
+// registries it is a regular namespace (e.g. Harbor's default project).
+// Used as the state file key.
 func (r ImageRef) String() string {
 	var b strings.Builder
 	if r.Host != "" {
 		b.WriteString(r.Host)
 		b.WriteByte('/')
 	}
-	if r.Namespace != "" && r.Namespace != "library" {
+	if r.Namespace != "" && (r.Namespace != "library" || CanonicalHost(r.Host) != "docker.io") {
 		b.WriteString(r.Namespace)
 		b.WriteByte('/')
 	}
@@ -82,8 +92,55 @@ func (r ImageRef) String() string {
 	return b.String()
 }
 
+// Repository returns the repository path as used by the distribution API,
+// e.g. "library/php" or "org/img".
+func (r ImageRef) Repository() string {
+	if r.Namespace == "" {
+		return r.Name
+	}
+	return r.Namespace + "/" + r.Name
+}
+
+// CanonicalHost returns the registry host of an image ref with Docker Hub's
+// aliases ("" and "index.docker.io") folded into "docker.io".
+func CanonicalHost(host string) string {
+	switch host {
+	case "", "index.docker.io", "registry-1.docker.io":
+		return "docker.io"
+	}
+	return host
+}
+
 // ImageInfo holds the fetched metadata for an image tag.
 type ImageInfo struct {
-	Ref        ImageRef
+	Ref ImageRef
+	// LastPushed is when the tag was last pushed. It is zero if the source
+	// does not report push times, such as a plain distribution API mirror;
+	// changes are then detected by Digest alone.
 	LastPushed time.Time
+	// Digest is the manifest (list) digest, e.g. "sha256:...", if the
+	// registry reports one. For multi-platform images it is always the
+	// digest of the index, whichever source answered.
+	Digest string
+	// Source names the registry or mirror that answered, if the image's
+	// registry has mirrors configured (see ScraperRegistry.SetMirrors).
+	Source string
+	// Scan is the registry's vulnerability scan summary of the image, if
+	// the scraper was asked for it and the registry has one (Harbor).
+	Scan *ScanSummary
+}
+
+// ScanSummary summarizes a registry-side vulnerability scan.
+type ScanSummary struct {
+	// Status is the scanner's status, e.g. "Success" or "Running".
+	Status string
+	// Severity is the highest severity found, e.g. "High" or "None".
+	Severity string
+	// Total and Fixable count the vulnerabilities found.
+	Total   int
+	Fixable int
+	// BySeverity counts the vulnerabilities per severity, e.g. "Critical".
+	BySeverity map[string]int
+	// ScannedAt is when the scan finished.
+	ScannedAt time.Time
 }
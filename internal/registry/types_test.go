@@ -29,6 +29,14 @@ func TestParseImageRef(t *testing.T) {
 			input: "nginx:1.25-alpine",
 			want:  ImageRef{Host: "", Namespace: "library", Name: "nginx", Tag: "1.25-alpine"},
 		},
+		{
+			input: "registry.gitlab.com/group/sub/project/img:v1",
+			want:  ImageRef{Host: "registry.gitlab.com", Namespace: "group/sub/project", Name: "img", Tag: "v1"},
+		},
+		{
+			input:   "a/b/c:1",
+			wantErr: true,
+		},
 		{
 			input:   "php",
 			wantErr: true,
@@ -69,6 +77,14 @@ func TestImageRefString(t *testing.T) {
 			ref:  ImageRef{Host: "ghcr.io", Namespace: "org", Name: "img", Tag: "latest"},
 			want: "ghcr.io/org/img:latest",
 		},
+		{
+			ref:  ImageRef{Host: "docker.io", Namespace: "library", Name: "nginx", Tag: "1"},
+			want: "docker.io/nginx:1",
+		},
+		{
+			ref:  ImageRef{Host: "harbor.example.com", Namespace: "library", Name: "nginx", Tag: "v1"},
+			want: "harbor.example.com/library/nginx:v1",
+		},
 	}
 
 	for _, tc := range tests {
@@ -77,3 +93,10 @@ func TestImageRefString(t *testing.T) {
 		})
 	}
 }
+
+func TestImageRefRepository(t *testing.T) {
+	assert.Equal(t, "library/php", ImageRef{Namespace: "library", Name: "php"}.Repository())
+	assert.Equal(t, "org/img", ImageRef{Host: "ghcr.io", Namespace: "org", Name: "img"}.Repository())
+	assert.Equal(t, "img", ImageRef{Host: "localhost:5000", Name: "img"}.Repository())
+	assert.Equal(t, "group/sub/img", ImageRef{Host: "gitlab.example.com", Namespace: "group/sub", Name: "img"}.Repository())
+}
@@ -0,0 +1,106 @@
+package sigv4
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LoadCredentials resolves credentials like the AWS CLI does, for the
+// static-key cases: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY (plus
+// AWS_SESSION_TOKEN) from the environment, then the profile in the shared
+// credentials file (AWS_SHARED_CREDENTIALS_FILE, default
+// ~/.aws/credentials), then the same profile in the shared config file
+// (AWS_CONFIG_FILE, default ~/.aws/config). An empty profile means
+// AWS_PROFILE, or "default". The environment is skipped if a profile is
+// given explicitly.
+func LoadCredentials(profile string) (Credentials, error) {
+	if profile == "" {
+		if creds := (Credentials{
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}); creds.AccessKeyID != "" {
+			return creds, nil
+		}
+		profile = os.Getenv("AWS_PROFILE")
+	}
+	if profile == "" {
+		profile = "default"
+	}
+
+	home, _ := os.UserHomeDir()
+	files := []struct {
+		path    string
+		section string
+	}{
+		{envOr("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(home, ".aws", "credentials")), profile},
+		// The config file prefixes every profile but the default one.
+		{envOr("AWS_CONFIG_FILE", filepath.Join(home, ".aws", "config")), configSection(profile)},
+	}
+	for _, f := range files {
+		values, err := readSection(f.path, f.section)
+		if err != nil {
+			return Credentials{}, err
+		}
+		if values["aws_access_key_id"] != "" {
+			return Credentials{
+				AccessKeyID:     values["aws_access_key_id"],
+				SecretAccessKey: values["aws_secret_access_key"],
+				SessionToken:    values["aws_session_token"],
+			}, nil
+		}
+	}
+	return Credentials{}, fmt.Errorf("sigv4: no credentials found for profile %q", profile)
+}
+
+func envOr(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func configSection(profile string) string {
+	if profile == "default" {
+		return profile
+	}
+	return "profile " + profile
+}
+
+// readSection returns the key/value pairs of one section of an INI file.
+// A missing file has no sections.
+func readSection(path, section string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("sigv4: %w", err)
+	}
+	defer f.Close()
+
+	values := make(map[string]string)
+	in := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || line[0] == '#' || line[0] == ';':
+		case line[0] == '[':
+			in = strings.TrimSpace(strings.Trim(line, "[]")) == section
+		case in:
+			if key, value, ok := strings.Cut(line, "="); ok {
+				values[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("sigv4: read %s: %w", path, err)
+	}
+	return values, nil
+}
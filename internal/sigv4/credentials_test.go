@@ -0,0 +1,76 @@
+package sigv4
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupAWSFiles points the shared credentials and config files at a temp
+// directory and clears the credential environment.
+func setupAWSFiles(t *testing.T, credentials, config string) {
+	t.Helper()
+	dir := t.TempDir()
+	credsPath := filepath.Join(dir, "credentials")
+	configPath := filepath.Join(dir, "config")
+	require.NoError(t, os.WriteFile(credsPath, []byte(credentials), 0o600))
+	require.NoError(t, os.WriteFile(configPath, []byte(config), 0o600))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", credsPath)
+	t.Setenv("AWS_CONFIG_FILE", configPath)
+	for _, name := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_PROFILE"} {
+		t.Setenv(name, "")
+	}
+}
+
+const sharedCredentials = `
+[default]
+aws_access_key_id = DEFAULTKEY
+aws_secret_access_key = defaultsecret
+
+# team account
+[ci]
+aws_access_key_id=CIKEY
+aws_secret_access_key=cisecret
+aws_session_token=citoken
+`
+
+func TestLoadCredentials_Environment(t *testing.T) {
+	setupAWSFiles(t, sharedCredentials, "")
+	t.Setenv("AWS_ACCESS_KEY_ID", "ENVKEY")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "envsecret")
+
+	creds, err := LoadCredentials("")
+	require.NoError(t, err)
+	assert.Equal(t, Credentials{AccessKeyID: "ENVKEY", SecretAccessKey: "envsecret"}, creds)
+
+	creds, err = LoadCredentials("ci")
+	require.NoError(t, err)
+	assert.Equal(t, "CIKEY", creds.AccessKeyID, "an explicit profile wins over the environment")
+}
+
+func TestLoadCredentials_Profiles(t *testing.T) {
+	setupAWSFiles(t, sharedCredentials, "")
+
+	creds, err := LoadCredentials("")
+	require.NoError(t, err)
+	assert.Equal(t, "DEFAULTKEY", creds.AccessKeyID)
+
+	t.Setenv("AWS_PROFILE", "ci")
+	creds, err = LoadCredentials("")
+	require.NoError(t, err)
+	assert.Equal(t, Credentials{AccessKeyID: "CIKEY", SecretAccessKey: "cisecret", SessionToken: "citoken"}, creds)
+}
+
+func TestLoadCredentials_ConfigFile(t *testing.T) {
+	setupAWSFiles(t, "", "[profile prod]\nregion = eu-west-1\naws_access_key_id = PRODKEY\naws_secret_access_key = prodsecret\n")
+
+	creds, err := LoadCredentials("prod")
+	require.NoError(t, err)
+	assert.Equal(t, "PRODKEY", creds.AccessKeyID)
+
+	_, err = LoadCredentials("missing")
+	assert.ErrorContains(t, err, `no credentials found for profile "missing"`)
+}
@@ -11,11 +11,12 @@ import (
 // Writes are atomic (write to .tmp then os.Rename).
 type JSONStateStore struct {
 	path string
+	options
 }
 
 // NewJSONStateStore creates a JSONStateStore that reads/writes the given file path.
-func NewJSONStateStore(path string) *JSONStateStore {
-	return &JSONStateStore{path: path}
+func NewJSONStateStore(path string, opts ...Option) *JSONStateStore {
+	return &JSONStateStore{path: path, options: newOptions(opts)}
 }
 
 func (s *JSONStateStore) load() (map[string]ImageState, error) {
@@ -43,6 +44,11 @@ func (s *JSONStateStore) Load(key string) (ImageState, bool, error) {
 	return st, ok, nil
 }
 
+// LoadAll retrieves the states of all keys.
+func (s *JSONStateStore) LoadAll() (map[string]ImageState, error) {
+	return s.load()
+}
+
 // Save writes the state for key atomically.
 func (s *JSONStateStore) Save(key string, st ImageState) error {
 	m, err := s.load()
@@ -63,5 +69,6 @@ func (s *JSONStateStore) Save(key string, st ImageState) error {
 	if err := os.Rename(tmp, s.path); err != nil {
 		return fmt.Errorf("state: rename %s -> %s: %w", tmp, s.path, err)
 	}
+	s.logger.Debug("state: saved", "key", key, "path", s.path, "bytes", len(data))
 	return nil
 }
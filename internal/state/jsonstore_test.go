@@ -57,6 +57,13 @@ func TestJSONStateStore_MultipleKeys(t *testing.T) {
 	require.NoError(t, err)
 	assert.True(t, found2)
 	assert.Equal(t, ts2, st2.LastPushed)
+
+	all, err := s.LoadAll()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]ImageState{
+		"php:8.2.30-fpm":    {LastPushed: ts1},
+		"nginx:1.25-alpine": {LastPushed: ts2},
+	}, all)
 }
 
 func TestJSONStateStore_AtomicRename(t *testing.T) {
@@ -70,3 +77,41 @@ func TestJSONStateStore_AtomicRename(t *testing.T) {
 	_, err := os.Stat(s.path + ".tmp")
 	assert.True(t, os.IsNotExist(err), "tmp file should have been renamed away")
 }
+
+func TestJSONStateStore_OutboxRoundTrip(t *testing.T) {
+	s := tempStore(t)
+	key := "php:8.2.30-fpm"
+	ts := time.Date(2026, 2, 4, 17, 56, 28, 0, time.UTC)
+	st := ImageState{
+		LastPushed: ts,
+		Outbox: []PendingEvent{{
+			NewPushed:   ts,
+			IsFirstSeen: true,
+			CreatedAt:   ts,
+			Sinks: map[string]*Delivery{
+				"stdout":  {Delivered: true, Attempts: 1},
+				"webhook": {Attempts: 2, NextAttempt: ts.Add(2 * time.Minute), LastError: "503"},
+			},
+		}},
+	}
+
+	require.NoError(t, s.Save(key, st))
+
+	got, found, err := s.Load(key)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, st, got)
+	assert.False(t, got.Outbox[0].Done())
+}
+
+func TestImageState_AddHistoryCapped(t *testing.T) {
+	var st ImageState
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range MaxHistory + 5 {
+		st.AddHistory(HistoryEntry{Pushed: base.Add(time.Duration(i) * time.Hour)})
+	}
+
+	require.Len(t, st.History, MaxHistory)
+	assert.Equal(t, base.Add(5*time.Hour), st.History[0].Pushed)
+	assert.Equal(t, base.Add(time.Duration(MaxHistory+4)*time.Hour), st.History[MaxHistory-1].Pushed)
+}
@@ -0,0 +1,265 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wutscho/registry-ping/internal/sigv4"
+)
+
+// ErrConflict is returned when a conditional write keeps losing against
+// concurrent writers.
+var ErrConflict = errors.New("state: concurrent modification")
+
+const defaultS3Retries = 5
+
+// S3Options configures an S3StateStore.
+type S3Options struct {
+	// Endpoint is the base URL of the S3-compatible service,
+	// e.g. "https://s3.eu-central-1.amazonaws.com" or "http://localhost:9000".
+	Endpoint string
+	Region   string
+	Bucket   string
+	// Key is the object key of the state document.
+	Key string
+	// PathStyle addresses the bucket as endpoint/bucket/key instead of
+	// bucket.endpoint/key. Most self-hosted S3 implementations need this.
+	PathStyle   bool
+	Credentials sigv4.Credentials
+}
+
+// S3StateStore persists image states as a single JSON object in an
+// S3-compatible bucket. Writes use ETag-based conditional PUTs (If-Match /
+// If-None-Match) so concurrent runs never silently overwrite each other.
+//
+// Save also refuses to replace an entry that another writer changed since
+// this store loaded it: a run loads an image's state, fetches the registry
+// and then saves, and a concurrent run may have recorded a change (and its
+// pending notifications) for the same image in between.
+type S3StateStore struct {
+	client  *http.Client
+	opts    S3Options
+	signer  *sigv4.Signer
+	retries int
+	now     func() time.Time
+	options
+
+	mu sync.Mutex
+	// read holds the JSON encoding of each entry as last loaded or saved,
+	// or nil for an entry that did not exist.
+	read map[string][]byte
+}
+
+// NewS3StateStore creates an S3StateStore using the given HTTP client.
+func NewS3StateStore(client *http.Client, opts S3Options, options ...Option) *S3StateStore {
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+	return &S3StateStore{
+		client: client,
+		opts:   opts,
+		signer: &sigv4.Signer{
+			Credentials: opts.Credentials,
+			Region:      opts.Region,
+			Service:     "s3",
+		},
+		retries: defaultS3Retries,
+		now:     time.Now,
+		options: newOptions(options),
+		read:    make(map[string][]byte),
+	}
+}
+
+func (s *S3StateStore) objectURL() (string, error) {
+	u, err := url.Parse(s.opts.Endpoint)
+	if err != nil {
+		return "", fmt.Errorf("state: parse s3 endpoint %q: %w", s.opts.Endpoint, err)
+	}
+	key := strings.TrimPrefix(s.opts.Key, "/")
+	if s.opts.PathStyle {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.opts.Bucket + "/" + key
+	} else {
+		u.Host = s.opts.Bucket + "." + u.Host
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + key
+	}
+	return u.String(), nil
+}
+
+func (s *S3StateStore) newRequest(method string, body []byte) (*http.Request, error) {
+	objectURL, err := s.objectURL()
+	if err != nil {
+		return nil, err
+	}
+	// StateStore has no context parameter; the client's timeout bounds each call.
+	req, err := http.NewRequestWithContext(context.Background(), method, objectURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("state: create s3 request: %w", err)
+	}
+	hash := sigv4.HashPayload(body)
+	req.Header.Set("X-Amz-Content-Sha256", hash)
+	return req, nil
+}
+
+func (s *S3StateStore) do(req *http.Request) (*http.Response, error) {
+	if err := s.signer.Sign(req, req.Header.Get("X-Amz-Content-Sha256"), s.now()); err != nil {
+		return nil, fmt.Errorf("state: sign s3 request: %w", err)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("state: s3 %s %s: %w", req.Method, req.URL.Path, err)
+	}
+	return resp, nil
+}
+
+// load fetches the state document and its ETag. A missing object yields an
+// empty map and an empty ETag.
+func (s *S3StateStore) load() (map[string]ImageState, string, error) {
+	req, err := s.newRequest(http.MethodGet, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return make(map[string]ImageState), "", nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("state: s3 get %s: unexpected status %d", s.opts.Key, resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("state: read s3 object %s: %w", s.opts.Key, err)
+	}
+	m := make(map[string]ImageState)
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, "", fmt.Errorf("state: parse s3 object %s: %w", s.opts.Key, err)
+		}
+	}
+	return m, resp.Header.Get("ETag"), nil
+}
+
+// Load retrieves the stored state for key.
+func (s *S3StateStore) Load(key string) (ImageState, bool, error) {
+	m, _, err := s.load()
+	if err != nil {
+		return ImageState{}, false, err
+	}
+	st, ok := m[key]
+	s.remember(key, st, ok)
+	return st, ok, nil
+}
+
+// remember records the entry for key as read, for Save to compare with.
+func (s *S3StateStore) remember(key string, st ImageState, found bool) {
+	var data []byte
+	if found {
+		data, _ = json.Marshal(st)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.read[key] = data
+}
+
+// modified reports whether the entry for key in m differs from the one
+// this store last read or wrote. Entries it has not read count as
+// unmodified.
+func (s *S3StateStore) modified(m map[string]ImageState, key string) bool {
+	s.mu.Lock()
+	read, ok := s.read[key]
+	s.mu.Unlock()
+	if !ok {
+		return false
+	}
+	st, found := m[key]
+	if !found {
+		return read != nil
+	}
+	data, _ := json.Marshal(st)
+	return !bytes.Equal(data, read)
+}
+
+// LoadAll retrieves the states of all keys.
+func (s *S3StateStore) LoadAll() (map[string]ImageState, error) {
+	m, _, err := s.load()
+	return m, err
+}
+
+// Save writes the state for key with a conditional PUT. If another writer
+// changed the document in between, the document is re-read and the update
+// re-applied, up to a fixed number of attempts. If the entry for key itself
+// was changed by another writer since it was loaded, Save fails with
+// ErrConflict and leaves that writer's entry in place.
+func (s *S3StateStore) Save(key string, st ImageState) error {
+	for attempt := range s.retries {
+		m, etag, err := s.load()
+		if err != nil {
+			return err
+		}
+		if s.modified(m, key) {
+			return fmt.Errorf("state: s3 put %s: %s was changed by another writer: %w", s.opts.Key, key, ErrConflict)
+		}
+		m[key] = st
+
+		ok, err := s.put(m, etag)
+		if err != nil {
+			return err
+		}
+		if ok {
+			s.remember(key, st, true)
+			s.logger.Debug("state: saved", "key", key, "object", s.opts.Key, "attempt", attempt+1)
+			return nil
+		}
+		s.logger.Debug("state: conditional write lost, retrying", "key", key, "object", s.opts.Key, "attempt", attempt+1)
+	}
+	return fmt.Errorf("state: s3 put %s: %w", s.opts.Key, ErrConflict)
+}
+
+// put writes m conditionally on etag. It returns false if the precondition
+// failed because the object was modified (or created) concurrently.
+func (s *S3StateStore) put(m map[string]ImageState, etag string) (bool, error) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return false, fmt.Errorf("state: marshal: %w", err)
+	}
+
+	req, err := s.newRequest(http.MethodPut, data)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if etag == "" {
+		req.Header.Set("If-None-Match", "*")
+	} else {
+		req.Header.Set("If-Match", etag)
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode == http.StatusPreconditionFailed, resp.StatusCode == http.StatusConflict:
+		return false, nil
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		return false, fmt.Errorf("state: s3 put %s: unexpected status %d", s.opts.Key, resp.StatusCode)
+	}
+	return true, nil
+}
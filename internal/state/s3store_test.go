@@ -0,0 +1,215 @@
+package state
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wutscho/registry-ping/internal/sigv4"
+)
+
+// fakeS3 is a minimal single-object S3 stand-in supporting GET and
+// conditional PUT.
+type fakeS3 struct {
+	t         *testing.T
+	mu        sync.Mutex
+	path      string
+	body      []byte
+	etag      string
+	puts      int
+	beforePut func(f *fakeS3)
+}
+
+func (f *fakeS3) set(body []byte) {
+	sum := md5.Sum(body)
+	f.body = body
+	f.etag = `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	assert.Equal(f.t, f.path, r.URL.Path)
+	assert.True(f.t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 "))
+
+	switch r.Method {
+	case http.MethodGet:
+		if f.etag == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", f.etag)
+		_, _ = w.Write(f.body)
+	case http.MethodPut:
+		f.puts++
+		if f.beforePut != nil {
+			hook := f.beforePut
+			f.beforePut = nil
+			hook(f)
+		}
+		if r.Header.Get("If-None-Match") == "*" && f.etag != "" {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		if m := r.Header.Get("If-Match"); m != "" && m != f.etag {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		require.NoError(f.t, err)
+		f.set(body)
+		w.Header().Set("ETag", f.etag)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newS3Store(t *testing.T) (*S3StateStore, *fakeS3) {
+	t.Helper()
+	fake := &fakeS3{t: t, path: "/ci-state/registry-ping/state.json"}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	s := NewS3StateStore(server.Client(), S3Options{
+		Endpoint:    server.URL,
+		Bucket:      "ci-state",
+		Key:         "registry-ping/state.json",
+		PathStyle:   true,
+		Credentials: sigv4.Credentials{AccessKeyID: "AK", SecretAccessKey: "SK"},
+	})
+	return s, fake
+}
+
+func TestS3StateStore_NonExistentObject(t *testing.T) {
+	s, _ := newS3Store(t)
+
+	st, found, err := s.Load("php:8.2.30-fpm")
+	require.NoError(t, err)
+	assert.False(t, found)
+	assert.Zero(t, st)
+}
+
+func TestS3StateStore_RoundTrip(t *testing.T) {
+	s, _ := newS3Store(t)
+	ts1 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	ts2 := time.Date(2026, 2, 4, 17, 56, 28, 0, time.UTC)
+
+	require.NoError(t, s.Save("php:8.2.30-fpm", ImageState{LastPushed: ts1}))
+	require.NoError(t, s.Save("nginx:1.25-alpine", ImageState{LastPushed: ts2}))
+
+	st, found, err := s.Load("php:8.2.30-fpm")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, ts1, st.LastPushed)
+
+	st, found, err = s.Load("nginx:1.25-alpine")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, ts2, st.LastPushed)
+
+	all, err := s.LoadAll()
+	require.NoError(t, err)
+	assert.Len(t, all, 2)
+}
+
+func TestS3StateStore_ConcurrentWriteRetried(t *testing.T) {
+	s, fake := newS3Store(t)
+	ts := time.Date(2026, 2, 4, 17, 56, 28, 0, time.UTC)
+
+	require.NoError(t, s.Save("php:8.2.30-fpm", ImageState{LastPushed: ts}))
+
+	// Another run writes its own key between our GET and PUT.
+	fake.beforePut = func(f *fakeS3) {
+		f.set([]byte(`{"php:8.2.30-fpm":{"last_pushed":"2026-02-04T17:56:28Z"},"redis:7":{"last_pushed":"2026-03-01T00:00:00Z"}}`))
+	}
+	require.NoError(t, s.Save("nginx:1.25-alpine", ImageState{LastPushed: ts}))
+	assert.Equal(t, 3, fake.puts, "first put must fail its precondition and be retried")
+
+	_, found, err := s.Load("redis:7")
+	require.NoError(t, err)
+	assert.True(t, found, "concurrent update must not be lost")
+
+	_, found, err = s.Load("nginx:1.25-alpine")
+	require.NoError(t, err)
+	assert.True(t, found)
+}
+
+func TestS3StateStore_EntryChangedSinceLoad(t *testing.T) {
+	s, fake := newS3Store(t)
+	ts1 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	ts2 := time.Date(2026, 2, 4, 17, 56, 28, 0, time.UTC)
+	require.NoError(t, s.Save("php:8.2.30-fpm", ImageState{LastPushed: ts1}))
+
+	_, _, err := s.Load("php:8.2.30-fpm")
+	require.NoError(t, err)
+	_, found, err := s.Load("nginx:1.25-alpine")
+	require.NoError(t, err)
+	require.False(t, found)
+
+	// Another run records a change of both images after our Load.
+	fake.mu.Lock()
+	fake.set([]byte(`{"php:8.2.30-fpm":{"last_pushed":"2026-03-01T00:00:00Z","outbox":[{"new_pushed":"2026-03-01T00:00:00Z"}]},` +
+		`"nginx:1.25-alpine":{"last_pushed":"2026-03-01T00:00:00Z"}}`))
+	fake.mu.Unlock()
+	puts := fake.puts
+
+	err = s.Save("php:8.2.30-fpm", ImageState{LastPushed: ts2})
+	assert.True(t, errors.Is(err, ErrConflict), "expected ErrConflict, got: %v", err)
+	err = s.Save("nginx:1.25-alpine", ImageState{LastPushed: ts2})
+	assert.True(t, errors.Is(err, ErrConflict), "expected ErrConflict, got: %v", err)
+	assert.Equal(t, puts, fake.puts, "the other run's entries must not be replaced")
+
+	// A fresh Load picks up the other run's entry, which can then be updated.
+	st, _, err := s.Load("php:8.2.30-fpm")
+	require.NoError(t, err)
+	require.Len(t, st.Outbox, 1)
+	st.LastPushed = ts2
+	require.NoError(t, s.Save("php:8.2.30-fpm", st))
+	require.NoError(t, s.Save("php:8.2.30-fpm", st), "saving again after an own save is fine")
+}
+
+func TestS3StateStore_PersistentConflict(t *testing.T) {
+	fake := &fakeS3{t: t, path: "/ci-state/state.json"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		fake.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	s := NewS3StateStore(server.Client(), S3Options{
+		Endpoint:    server.URL,
+		Bucket:      "ci-state",
+		Key:         "state.json",
+		PathStyle:   true,
+		Credentials: sigv4.Credentials{AccessKeyID: "AK", SecretAccessKey: "SK"},
+	})
+
+	err := s.Save("php:8.2.30-fpm", ImageState{})
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrConflict), "expected ErrConflict, got: %v", err)
+}
+
+func TestS3StateStore_VirtualHostedURL(t *testing.T) {
+	s := NewS3StateStore(http.DefaultClient, S3Options{
+		Endpoint: "https://s3.eu-central-1.amazonaws.com",
+		Bucket:   "ci-state",
+		Key:      "/state.json",
+	})
+
+	got, err := s.objectURL()
+	require.NoError(t, err)
+	assert.Equal(t, "https://ci-state.s3.eu-central-1.amazonaws.com/state.json", got)
+}
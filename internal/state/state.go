@@ -1,10 +1,81 @@
 package state
 
-import "time"
+import (
+	"log/slog"
+	"time"
+)
 
 // ImageState holds the persisted metadata for a single image tag.
 type ImageState struct {
 	LastPushed time.Time `json:"last_pushed"`
+	Digest     string    `json:"digest,omitempty"`
+	// Version and AppVersion are the latest release of a Helm chart; they
+	// are empty for images.
+	Version    string `json:"version,omitempty"`
+	AppVersion string `json:"app_version,omitempty"`
+	// History lists the detected changes, oldest first, capped at
+	// MaxHistory entries.
+	History []HistoryEntry `json:"history,omitempty"`
+	// Outbox holds change notifications not yet delivered to every sink.
+	// It is saved together with LastPushed so a detected change is never lost
+	// when a notifier fails.
+	Outbox []PendingEvent `json:"outbox,omitempty"`
+}
+
+// MaxHistory is the number of changes kept in ImageState.History.
+const MaxHistory = 20
+
+// HistoryEntry records one detected change of an image tag or new release
+// of a chart.
+type HistoryEntry struct {
+	Pushed     time.Time `json:"pushed"`
+	Digest     string    `json:"digest,omitempty"`
+	Version    string    `json:"version,omitempty"`
+	AppVersion string    `json:"app_version,omitempty"`
+	DetectedAt time.Time `json:"detected_at"`
+}
+
+// AddHistory appends e to the history, dropping the oldest entries beyond
+// MaxHistory.
+func (s *ImageState) AddHistory(e HistoryEntry) {
+	s.History = append(s.History, e)
+	if n := len(s.History) - MaxHistory; n > 0 {
+		s.History = append([]HistoryEntry(nil), s.History[n:]...)
+	}
+}
+
+// PendingEvent is a recorded change awaiting delivery. Deliveries are
+// tracked per sink (notifier name) so a sink that already received the
+// event is not notified again when another one is retried.
+type PendingEvent struct {
+	OldPushed   time.Time `json:"old_pushed,omitzero"`
+	NewPushed   time.Time `json:"new_pushed"`
+	IsFirstSeen bool      `json:"is_first_seen,omitempty"`
+	// The chart versions and app versions before and after a chart change.
+	OldVersion    string               `json:"old_version,omitempty"`
+	NewVersion    string               `json:"new_version,omitempty"`
+	OldAppVersion string               `json:"old_app_version,omitempty"`
+	NewAppVersion string               `json:"new_app_version,omitempty"`
+	CreatedAt     time.Time            `json:"created_at"`
+	Sinks         map[string]*Delivery `json:"sinks"`
+}
+
+// Delivery is the delivery status of a PendingEvent for one sink.
+type Delivery struct {
+	Delivered   bool      `json:"delivered"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"next_attempt,omitzero"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+// Done reports whether every sink has received the event.
+func (e *PendingEvent) Done() bool {
+	for _, d := range e.Sinks {
+		if !d.Delivered {
+			return false
+		}
+	}
+	return true
 }
 
 // StateStore persists and retrieves image states by key.
@@ -14,6 +85,31 @@ type StateStore interface {
 	// Returns (state, true, nil) if found, (zero, false, nil) if not found,
 	// or (zero, false, err) on I/O error.
 	Load(key string) (ImageState, bool, error)
+	// LoadAll retrieves the states of all keys at once.
+	LoadAll() (map[string]ImageState, error)
 	// Save stores the state for the given key.
 	Save(key string, s ImageState) error
 }
+
+// Option is a functional option for the state stores.
+type Option func(*options)
+
+type options struct {
+	logger *slog.Logger
+}
+
+// WithLogger sets the logger for load and save diagnostics
+// (default slog.Default()).
+func WithLogger(l *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{logger: slog.Default()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
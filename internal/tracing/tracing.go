@@ -0,0 +1,279 @@
+// Package tracing records OpenTelemetry-compatible spans and exports them in
+// the OTLP/JSON encoding, either to an OTLP/HTTP collector or to a local
+// JSON-lines file.
+//
+// It implements the small subset of the OpenTelemetry tracing model the
+// checker needs: nested spans carried in a context.Context, attributes,
+// error status and optional W3C trace context propagation on outgoing HTTP
+// requests.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// maxBuffered bounds the spans kept between flushes, so a failing exporter
+// cannot grow memory without bound.
+const maxBuffered = 4096
+
+// maxBatch is the most spans sent in one export request.
+const maxBatch = 512
+
+// defaultExportTimeout bounds each background export.
+const defaultExportTimeout = 10 * time.Second
+
+// Span kinds, as in the OTLP SpanKind enum.
+const (
+	KindInternal = 1
+	KindClient   = 3
+)
+
+// Status codes, as in the OTLP Status.StatusCode enum.
+const (
+	StatusUnset = 0
+	StatusOK    = 1
+	StatusError = 2
+)
+
+// Attr is a span attribute. Value is a string, bool, int64 or float64.
+type Attr struct {
+	Key   string
+	Value any
+}
+
+// String returns a string attribute.
+func String(key, value string) Attr { return Attr{Key: key, Value: value} }
+
+// Int returns an integer attribute.
+func Int(key string, value int) Attr { return Attr{Key: key, Value: int64(value)} }
+
+// Bool returns a boolean attribute.
+func Bool(key string, value bool) Attr { return Attr{Key: key, Value: value} }
+
+// Exporter sends finished spans to a tracing backend.
+type Exporter interface {
+	Export(ctx context.Context, service string, spans []*Span) error
+}
+
+// Tracer creates spans and hands them to its Exporter. Spans are buffered
+// and exported in the background when a root span ends, so a slow collector
+// does not hold up the traced work; Shutdown exports what is left. All
+// methods are safe to call on a nil *Tracer, which records nothing.
+type Tracer struct {
+	exporter  Exporter
+	service   string
+	logger    *slog.Logger
+	now       func() time.Time
+	timeout   time.Duration
+	propagate bool
+
+	mu     sync.Mutex
+	buffer []*Span
+
+	flush    chan struct{} // wakes the export goroutine
+	stop     chan struct{}
+	done     chan struct{} // closed when the export goroutine has returned
+	stopOnce sync.Once
+}
+
+// Option is a functional option for Tracer.
+type Option func(*Tracer)
+
+// WithLogger sets the logger for export failures (default slog.Default()).
+func WithLogger(l *slog.Logger) Option {
+	return func(t *Tracer) {
+		t.logger = l
+	}
+}
+
+// WithExportTimeout bounds each background export (default 10s).
+func WithExportTimeout(d time.Duration) Option {
+	return func(t *Tracer) {
+		t.timeout = d
+	}
+}
+
+// WithPropagation sends the W3C traceparent header on traced requests made
+// through Transport. It is off by default, as registries are mostly run by
+// third parties who have no use for the trace IDs.
+func WithPropagation() Option {
+	return func(t *Tracer) {
+		t.propagate = true
+	}
+}
+
+// NewTracer creates a Tracer exporting to exp under the given service name
+// and starts its export goroutine, which runs until Shutdown.
+func NewTracer(exp Exporter, service string, opts ...Option) *Tracer {
+	t := &Tracer{
+		exporter: exp,
+		service:  service,
+		logger:   slog.Default(),
+		now:      time.Now,
+		timeout:  defaultExportTimeout,
+		flush:    make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for _, o := range opts {
+		o(t)
+	}
+	go t.run()
+	return t
+}
+
+// run exports the buffered spans whenever a root span ends.
+func (t *Tracer) run() {
+	defer close(t.done)
+	for {
+		select {
+		case <-t.flush:
+			ctx, cancel := context.WithTimeout(context.Background(), t.timeout)
+			if err := t.Flush(ctx); err != nil {
+				t.logger.Warn("tracing: dropped spans", "err", err)
+			}
+			cancel()
+		case <-t.stop:
+			return
+		}
+	}
+}
+
+// Shutdown stops the export goroutine, waiting for an export in progress,
+// and exports the spans still buffered. It gives up when ctx is done.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	t.stopOnce.Do(func() { close(t.stop) })
+	select {
+	case <-t.done:
+	case <-ctx.Done():
+		return fmt.Errorf("tracing: shutdown: %w", ctx.Err())
+	}
+	return t.Flush(ctx)
+}
+
+// Span is a single timed operation. All methods are safe to call on a nil
+// *Span.
+type Span struct {
+	tracer *Tracer
+
+	TraceID  [16]byte
+	SpanID   [8]byte
+	ParentID [8]byte // zero for root spans
+	Name     string
+	Kind     int
+	Start    time.Time
+	End      time.Time
+	Attrs    []Attr
+	Status   int
+	Message  string
+}
+
+type spanKey struct{}
+
+// SpanFromContext returns the span carried by ctx, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// Start begins an internal span as a child of the span in ctx, if any, and
+// returns a context carrying it.
+func (t *Tracer) Start(ctx context.Context, name string, attrs ...Attr) (context.Context, *Span) {
+	return t.start(ctx, name, KindInternal, attrs)
+}
+
+func (t *Tracer) start(ctx context.Context, name string, kind int, attrs []Attr) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	s := &Span{
+		tracer: t,
+		Name:   name,
+		Kind:   kind,
+		Start:  t.now(),
+		Attrs:  attrs,
+	}
+	if parent := SpanFromContext(ctx); parent != nil {
+		s.TraceID = parent.TraceID
+		s.ParentID = parent.SpanID
+	} else {
+		_, _ = rand.Read(s.TraceID[:])
+	}
+	_, _ = rand.Read(s.SpanID[:])
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// SetAttributes adds attributes to the span.
+func (s *Span) SetAttributes(attrs ...Attr) {
+	if s == nil {
+		return
+	}
+	s.Attrs = append(s.Attrs, attrs...)
+}
+
+// SetError marks the span as failed with err. A nil err is ignored.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.Status = StatusError
+	s.Message = err.Error()
+}
+
+// Finish ends the span. Ending a root span starts an export of all
+// buffered spans in the background; export failures are logged.
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	t := s.tracer
+	s.End = t.now()
+
+	t.mu.Lock()
+	if len(t.buffer) < maxBuffered {
+		t.buffer = append(t.buffer, s)
+	}
+	t.mu.Unlock()
+
+	if s.ParentID == ([8]byte{}) {
+		select {
+		case t.flush <- struct{}{}:
+		default: // an export is already pending and will take these spans
+		}
+	}
+}
+
+// Flush exports all buffered spans in batches of up to maxBatch. Spans are
+// dropped if an export fails.
+func (t *Tracer) Flush(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	spans := t.buffer
+	t.buffer = nil
+	t.mu.Unlock()
+
+	for len(spans) > 0 {
+		n := min(len(spans), maxBatch)
+		if err := t.exporter.Export(ctx, t.service, spans[:n]); err != nil {
+			return fmt.Errorf("%d spans: %w", len(spans), err)
+		}
+		spans = spans[n:]
+	}
+	return nil
+}
+
+// traceparent formats the W3C trace context header for s.
+func (s *Span) traceparent() string {
+	return "00-" + hex.EncodeToString(s.TraceID[:]) + "-" + hex.EncodeToString(s.SpanID[:]) + "-01"
+}
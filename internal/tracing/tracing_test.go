@@ -0,0 +1,277 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func (e *recordingExporter) Export(_ context.Context, _ string, spans []*Span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *recordingExporter) byName(name string) *Span {
+	for _, s := range e.spans {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+func TestTracer_NestedSpansExportedWithRoot(t *testing.T) {
+	exp := &recordingExporter{}
+	tr := NewTracer(exp, "test")
+
+	ctx, root := tr.Start(context.Background(), "run")
+	_, child := tr.Start(ctx, "check", String("image.ref", "php:8"))
+	child.SetError(errors.New("boom"))
+	child.Finish()
+	assert.Empty(t, exp.spans, "children are buffered until the root ends")
+	root.Finish()
+	require.NoError(t, tr.Shutdown(context.Background()))
+
+	require.Len(t, exp.spans, 2)
+	r, c := exp.byName("run"), exp.byName("check")
+	assert.Equal(t, r.TraceID, c.TraceID)
+	assert.Equal(t, r.SpanID, c.ParentID)
+	assert.Equal(t, [8]byte{}, r.ParentID)
+	assert.Equal(t, StatusError, c.Status)
+	assert.Equal(t, "boom", c.Message)
+	assert.Equal(t, []Attr{String("image.ref", "php:8")}, c.Attrs)
+}
+
+func TestTracer_NilIsNoop(t *testing.T) {
+	var tr *Tracer
+	ctx, span := tr.Start(context.Background(), "run")
+	span.SetAttributes(Bool("x", true))
+	span.SetError(errors.New("boom"))
+	span.Finish()
+	assert.Nil(t, SpanFromContext(ctx))
+	assert.NoError(t, tr.Flush(ctx))
+	assert.NoError(t, tr.Shutdown(ctx))
+}
+
+// blockingExporter blocks each export until its context is done or release
+// is closed.
+type blockingExporter struct {
+	release chan struct{}
+	ctxErr  chan error
+}
+
+func (e *blockingExporter) Export(ctx context.Context, _ string, _ []*Span) error {
+	select {
+	case <-e.release:
+		return nil
+	case <-ctx.Done():
+		e.ctxErr <- ctx.Err()
+		return ctx.Err()
+	}
+}
+
+func TestTracer_ExportsInBackgroundWithTimeout(t *testing.T) {
+	exp := &blockingExporter{release: make(chan struct{}), ctxErr: make(chan error, 1)}
+	tr := NewTracer(exp, "test", WithExportTimeout(10*time.Millisecond))
+
+	_, root := tr.Start(context.Background(), "run")
+	finished := make(chan struct{})
+	go func() {
+		root.Finish()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatal("Finish waited for the export")
+	}
+
+	select {
+	case err := <-exp.ctxErr:
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	case <-time.After(time.Second):
+		t.Fatal("export was not cancelled after its timeout")
+	}
+	require.NoError(t, tr.Shutdown(context.Background()))
+}
+
+func TestTracer_FlushBatches(t *testing.T) {
+	exp := &batchCounter{}
+	tr := NewTracer(exp, "test")
+	ctx, root := tr.Start(context.Background(), "run")
+	for range maxBatch {
+		_, span := tr.Start(ctx, "check")
+		span.Finish()
+	}
+	root.Finish()
+	require.NoError(t, tr.Shutdown(context.Background()))
+
+	assert.Equal(t, []int{maxBatch, 1}, exp.sizes)
+}
+
+type batchCounter struct {
+	mu    sync.Mutex
+	sizes []int
+}
+
+func (e *batchCounter) Export(_ context.Context, _ string, spans []*Span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.sizes = append(e.sizes, len(spans))
+	return nil
+}
+
+func TestTransport_PropagatesAndRecords(t *testing.T) {
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("Traceparent")
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	exp := &recordingExporter{}
+	tr := NewTracer(exp, "test", WithPropagation())
+	client := &http.Client{Transport: tr.Transport(server.Client().Transport)}
+
+	ctx, root := tr.Start(context.Background(), "check")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/v2/x?token=abc", nil)
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	root.Finish()
+	require.NoError(t, tr.Shutdown(context.Background()))
+
+	span := exp.byName("HTTP GET")
+	require.NotNil(t, span)
+	assert.Equal(t, KindClient, span.Kind)
+	assert.Equal(t, root.SpanID, span.ParentID)
+	assert.Equal(t, span.traceparent(), traceparent)
+	assert.Contains(t, span.Attrs, Int("http.response.status_code", 404))
+	assert.Contains(t, span.Attrs, String("url.full", server.URL+"/v2/x?token=REDACTED"))
+	assert.Equal(t, StatusError, span.Status)
+}
+
+func TestTransport_NoTraceparentByDefault(t *testing.T) {
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("Traceparent")
+	}))
+	defer server.Close()
+
+	exp := &recordingExporter{}
+	tr := NewTracer(exp, "test")
+	client := &http.Client{Transport: tr.Transport(server.Client().Transport)}
+
+	ctx, root := tr.Start(context.Background(), "check")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	root.Finish()
+	require.NoError(t, tr.Shutdown(context.Background()))
+
+	assert.Empty(t, traceparent)
+	assert.NotNil(t, exp.byName("HTTP GET"), "the request is still traced")
+}
+
+func TestTransport_UntracedRequestPassesThrough(t *testing.T) {
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("Traceparent")
+	}))
+	defer server.Close()
+
+	exp := &recordingExporter{}
+	tr := NewTracer(exp, "test")
+	client := &http.Client{Transport: tr.Transport(server.Client().Transport)}
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Empty(t, traceparent)
+	require.NoError(t, tr.Flush(context.Background()))
+	assert.Empty(t, exp.spans)
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var got map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "k", r.Header.Get("X-Api-Key"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+	}))
+	defer server.Close()
+
+	tr := NewTracer(NewOTLPExporter(server.Client(), server.URL+"/", map[string]string{"X-Api-Key": "k"}), "registry-ping")
+	_, span := tr.Start(context.Background(), "run", Int("images", 3))
+	span.Finish()
+	require.NoError(t, tr.Shutdown(context.Background()))
+
+	rs := got["resourceSpans"].([]any)[0].(map[string]any)
+	attr := rs["resource"].(map[string]any)["attributes"].([]any)[0].(map[string]any)
+	assert.Equal(t, "service.name", attr["key"])
+	assert.Equal(t, "registry-ping", attr["value"].(map[string]any)["stringValue"])
+
+	s := rs["scopeSpans"].([]any)[0].(map[string]any)["spans"].([]any)[0].(map[string]any)
+	assert.Equal(t, "run", s["name"])
+	assert.Len(t, s["traceId"], 32)
+	assert.Len(t, s["spanId"], 16)
+	assert.NotContains(t, s, "parentSpanId")
+	assert.Equal(t, map[string]any{"key": "images", "value": map[string]any{"intValue": "3"}},
+		s["attributes"].([]any)[0])
+}
+
+func TestOTLPExporter_ServerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	exp := NewOTLPExporter(server.Client(), server.URL, nil)
+	err := exp.Export(context.Background(), "test", []*Span{{Name: "run"}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "503")
+}
+
+func TestFileExporter_AppendsLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	tr := NewTracer(NewFileExporter(path), "test")
+
+	for range 2 {
+		_, span := tr.Start(context.Background(), "run")
+		span.Finish()
+		require.NoError(t, tr.Flush(context.Background()))
+	}
+	require.NoError(t, tr.Shutdown(context.Background()))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+	for _, line := range lines {
+		var req otlpRequest
+		require.NoError(t, json.Unmarshal([]byte(line), &req))
+		assert.Equal(t, "run", req.ResourceSpans[0].ScopeSpans[0].Spans[0].Name)
+	}
+}
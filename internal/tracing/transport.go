@@ -0,0 +1,53 @@
+package tracing
+
+import (
+	"net/http"
+
+	"github.com/wutscho/registry-ping/internal/logging"
+)
+
+// Transport returns an http.RoundTripper that records a client span for
+// every request made within a traced context and, with WithPropagation,
+// passes it on to the server in the W3C traceparent header. Requests
+// without a span in their context are passed through untraced.
+func (t *Tracer) Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if t == nil {
+		return next
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if SpanFromContext(req.Context()) == nil {
+			return next.RoundTrip(req)
+		}
+		ctx, span := t.start(req.Context(), "HTTP "+req.Method, KindClient, []Attr{
+			String("http.request.method", req.Method),
+			String("server.address", req.URL.Host),
+			String("url.full", logging.RedactURL(req.URL)),
+		})
+		defer span.Finish()
+
+		req = req.Clone(ctx)
+		if t.propagate {
+			req.Header.Set("Traceparent", span.traceparent())
+		}
+		resp, err := next.RoundTrip(req)
+		if err != nil {
+			span.SetError(err)
+			return resp, err
+		}
+		span.SetAttributes(Int("http.response.status_code", resp.StatusCode))
+		if resp.StatusCode >= 400 {
+			span.Status = StatusError
+			span.Message = http.StatusText(resp.StatusCode)
+		}
+		return resp, nil
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}